@@ -41,6 +41,7 @@ export const API_ENDPOINTS = {
   
   // 司机位置相关
   DRIVER_LOCATION: '/api/rides/location',
+  ORDER_DRIVER_LOCATION: '/api/orders/{id}/driver-location',
 }
 
 // 角色定义
@@ -28,6 +28,8 @@ const DriverHome = () => {
   const orderPollingTimerRef = useRef(null);
   // 后台任务定时器引用（位置上传等）
   const backgroundTaskTimerRef = useRef(null);
+  // 位置上传间隔（毫秒），由服务端根据订单情况调整
+  const uploadIntervalRef = useRef(5000);
 
   const checkUnfinishedOrder = async () => {
     try {
@@ -92,8 +94,14 @@ const DriverHome = () => {
     try {
       const location = await getCurrentLocation();
       setUserLocation(location);
-      await uploadDriverLocation(location);
+      const res = await uploadDriverLocation(location);
       console.log("位置上传成功:", location);
+      // 服务端要求调整上传间隔时（如订单发起紧急求助）重新启动后台任务
+      const interval = res?.data?.upload_interval;
+      if (interval && interval * 1000 !== uploadIntervalRef.current) {
+        uploadIntervalRef.current = interval * 1000;
+        startBackgroundTasks();
+      }
     } catch (error) {
       console.error("位置上传失败：", error);
       // 不中断程序，继续尝试上传
@@ -139,10 +147,10 @@ const DriverHome = () => {
       clearInterval(backgroundTaskTimerRef.current);
     }
 
-    // 设置新的定时器，每30秒执行一次后台任务
+    // 设置新的定时器，按服务端建议的间隔执行后台任务，默认5秒
     backgroundTaskTimerRef.current = setInterval(async () => {
       await backgroundTasks();
-    }, 5000); // 5秒执行一次
+    }, uploadIntervalRef.current);
   };
 
   // 停止后台任务
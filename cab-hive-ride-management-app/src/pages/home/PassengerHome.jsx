@@ -4,7 +4,7 @@ import { View } from "@tarojs/components";
 import { getUnfinishedOrder, OrderStatus } from "../../services/order";
 import RideOrderPage from "../../components/RideOrder";
 import WaitingForDriver from "../../components/WaitingForDriver";
-import { getDriverLocation } from "../../services/location";
+import { getOrderDriverLocation } from "../../services/location";
 import WaitingForDriverArrive from "../../components/WaitingForDriverArrive";
 import { getDriverInfo } from "../../services/driver";
 import { getVehicleDetail } from "../../services/vehicle";
@@ -21,9 +21,9 @@ const PassengerHome = () => {
   const [vehicleInfo, setVehicleInfo] = useState(null);
 
   // 获取司机位置
-  const fetchDriverLocation = async (driverId) => {
+  const fetchDriverLocation = async (orderId) => {
     try {
-      const result = await getDriverLocation(driverId);
+      const result = await getOrderDriverLocation(orderId);
       if (result.success && result.data) {
         setDriverLocation(result.data);
       }
@@ -71,7 +71,7 @@ const PassengerHome = () => {
               res.data.status === OrderStatus.DriverArrived) &&
             res.data.driver_open_id
           ) {
-            fetchDriverLocation(res.data.driver_open_id);
+            fetchDriverLocation(res.data.id);
 
             if (!driverInfo || driverInfo.id !== res.data.driver_open_id) {
               // 获取司机信息
@@ -30,15 +30,10 @@ export default function PaymentPage() {
     
     try {
       // 创建支付订单并获取支付链接
-      const url = await createPaymentOrder(
-        orderInfo.id, 
-        orderInfo.fare, 
-        `订单-${orderInfo.id}`, 
-        orderInfo.user_open_id
-      );
+      const result = await createPaymentOrder(orderInfo.id, `订单-${orderInfo.id}`, 'alipay');
       
       Taro.hideLoading();
-      setPayUrl(url);
+      setPayUrl(result.pay_url);
       
       // 检查一次支付状态
       checkPaymentStatus(orderInfo.id);
@@ -51,6 +46,36 @@ export default function PaymentPage() {
     }
   };
   
+  // 处理微信支付按钮点击，在小程序内直接调起微信支付
+  const handleWeChatPayment = async () => {
+    if (!orderInfo) return;
+    
+    Taro.showLoading({ title: '正在创建支付订单...' });
+    
+    try {
+      const result = await createPaymentOrder(orderInfo.id, `订单-${orderInfo.id}`, 'wechat');
+      Taro.hideLoading();
+      
+      const params = result.pay_params;
+      await Taro.requestPayment({
+        timeStamp: params.timeStamp,
+        nonceStr: params.nonceStr,
+        package: params.package,
+        signType: params.signType,
+        paySign: params.paySign
+      });
+      
+      // 支付完成后以服务端收到的支付结果为准
+      checkPaymentStatus(orderInfo.id);
+    } catch (error) {
+      Taro.hideLoading();
+      Taro.showToast({
+        title: '微信支付未完成: ' + (error.errMsg || error.message),
+        icon: 'none'
+      });
+    }
+  };
+  
   // 检查支付状态
   const checkPaymentStatus = async (orderId) => {
     setPaymentStatus('pending');
@@ -123,11 +148,7 @@ export default function PaymentPage() {
         <View className="payment-methods">
           <Text className="head">选择以下支付方式付款</Text>
           <View className="item">
-            <Button className="btn wx" onClick={() => {
-              // 微信支付逻辑
-              console.log('微信支付');
-            }}
-            />
+            <Button className="btn wx" onClick={handleWeChatPayment} />
             <Button className="btn alipay" onClick={handlePayment}></Button>
           </View>
         </View>
@@ -364,7 +364,8 @@ export const uploadDriverLocation = async (location) => {
       method: 'POST',
       data: {
         latitude,
-        longitude
+        longitude,
+        timestamp: location.timestamp || Date.now()
       }
     });
     
@@ -394,6 +395,32 @@ export const getDriverLocation = async (driverId) => {
       method: 'GET'
     });
     
+    return result;
+  } catch (error) {
+    console.error('获取司机位置失败:', error);
+    throw error;
+  }
+};
+
+/**
+ * 获取订单承接司机的位置
+ * @param {number} orderId 订单ID
+ * @returns {Promise<Object>} 司机位置信息
+ */
+export const getOrderDriverLocation = async (orderId) => {
+  if (!orderId) {
+    throw new Error('订单ID不能为空');
+  }
+  
+  try {
+    const request = (await import('../utils/request')).default;
+    const { API_ENDPOINTS } = await import('../config/api');
+    
+    const result = await request({
+      url: API_ENDPOINTS.ORDER_DRIVER_LOCATION.replace('{id}', orderId),
+      method: 'GET'
+    });
+    
     return result;
   } catch (error) {
     console.error('获取司机位置失败:', error);
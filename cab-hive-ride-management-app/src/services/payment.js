@@ -1,10 +1,11 @@
 import request from '../utils/request';
 
 // 1. 创建支付订单
-export const createPaymentOrder = async (orderId, amount, subject, userId) => {
+// provider: 支付渠道 alipay（返回支付链接）或 wechat（返回小程序调起支付的参数），支付金额以服务端订单费用为准
+export const createPaymentOrder = async (orderId, subject, provider = 'alipay') => {
   try {
     // 参数验证
-    if (!orderId || !amount || !subject || !userId) {
+    if (!orderId || !subject) {
       throw new Error('缺少必要参数');
     }
     
@@ -13,15 +14,14 @@ export const createPaymentOrder = async (orderId, amount, subject, userId) => {
       method: 'POST',
       data: {
         order_id: `${orderId}`,     // 订单ID
-        amount: amount,        // 支付金额
         subject: subject,      // 商品标题
-        user_id: userId        // 用户ID
+        provider: provider     // 支付渠道
       }
     });
     
     if (response.success) {
-      // 成功获取支付链接
-      return response.data.pay_url;
+      // 成功获取支付链接或支付参数
+      return response.data;
     } else {
       throw new Error(response.message || '创建支付订单失败');
     }
@@ -32,7 +32,7 @@ export const createPaymentOrder = async (orderId, amount, subject, userId) => {
 };
 
 // 4. 查询支付状态
-export const queryPaymentStatus = async (orderId) => {
+export const queryPaymentStatus = async (orderId, provider = 'alipay') => {
   try {
     if (!orderId) {
       throw new Error('缺少订单ID');
@@ -42,7 +42,8 @@ export const queryPaymentStatus = async (orderId) => {
       url: '/api/payment/query',
       method: 'POST',
       data: {
-        order_id: `${orderId}`
+        order_id: `${orderId}`,
+        provider: provider
       }
     });
     
@@ -58,15 +59,15 @@ export const queryPaymentStatus = async (orderId) => {
 };
 
 // 定期查询支付状态（可选）
-export const pollPaymentStatus = async (orderId, maxAttempts = 10) => {
+export const pollPaymentStatus = async (orderId, provider = 'alipay', maxAttempts = 10) => {
   if (!orderId) {
     return { success: false, message: '缺少订单ID' };
   }
   
   for (let i = 0; i < maxAttempts; i++) {
     try {
-      const result = await queryPaymentStatus(orderId);
-      if (result && result.trade_status === 'TRADE_SUCCESS') {
+      const result = await queryPaymentStatus(orderId, provider);
+      if (result && result.status === 'success') {
         return { success: true, data: result };
       }
       // 等待一段时间后再次查询
@@ -8,17 +8,24 @@ const (
 )
 
 type Config struct {
-	Host     string `envconfig:"HOST"`
-	Port     string `envconfig:"PORT"`
-	Prefix   string `envconfig:"PREFIX"`
-	Mode     Mode   `envconfig:"MODE"`
-	Postgres Postgres
-	Redis    Redis
-	JWT      JWT
-	Log      Log
-	WeChat   WeChat `yaml:"wechat"`
-	OSS      OSS    `yaml:"oss"`
-	AliPay   AliPay `yaml:"alipay"`
+	Host        string `envconfig:"HOST"`
+	Port        string `envconfig:"PORT"`
+	Prefix      string `envconfig:"PREFIX"`
+	Mode        Mode   `envconfig:"MODE"`
+	Postgres    Postgres
+	Redis       Redis
+	JWT         JWT
+	Log         Log
+	WeChat      WeChat      `yaml:"wechat"`
+	OSS         OSS         `yaml:"oss"`
+	AliPay      AliPay      `yaml:"alipay"`
+	Payment     Payment     `yaml:"payment"`
+	Fare        Fare        `yaml:"fare"`
+	Dispatch    Dispatch    `yaml:"dispatch"`
+	Reputation  Reputation  `yaml:"reputation"`
+	Reservation Reservation `yaml:"reservation"`
+	GPS         GPS         `yaml:"gps"`
+	Safety      Safety      `yaml:"safety"`
 }
 
 // OSS 配置
@@ -61,6 +68,22 @@ type WeChat struct {
 	AppSecret string `envconfig:"APP_SECRET" yaml:"app_secret" mapstructure:"app_secret"`
 	Token     string `envconfig:"TOKEN" yaml:"token" mapstructure:"token"`
 	AESKey    string `envconfig:"AES_KEY" yaml:"aes_key" mapstructure:"aes_key"`
+
+	MiniProgramState string          `yaml:"miniprogram_state" mapstructure:"miniprogram_state"` // 订阅消息跳转的小程序版本：developer、trial、formal，为空时为正式版
+	Templates        WeChatTemplates `yaml:"templates" mapstructure:"templates"`                 // 订阅消息模板
+}
+
+// WeChatTemplates 小程序订阅消息模板配置，模板ID为空时不发送对应的消息
+type WeChatTemplates struct {
+	ReservationReminder WeChatTemplate `yaml:"reservation_reminder" mapstructure:"reservation_reminder"` // 预约订单出发提醒，发送给认领的司机
+	PaymentReminder     WeChatTemplate `yaml:"payment_reminder" mapstructure:"payment_reminder"`         // 待付款提醒，发送给未付款的乘客
+	NoDriver            WeChatTemplate `yaml:"no_driver" mapstructure:"no_driver"`                       // 无司机接单通知，达到最大派单轮次时发送给乘客
+}
+
+// WeChatTemplate 订阅消息模板
+type WeChatTemplate struct {
+	ID   string `yaml:"id" mapstructure:"id"`     // 模板ID
+	Page string `yaml:"page" mapstructure:"page"` // 点击消息打开的小程序页面
 }
 
 type AliPay struct {
@@ -73,3 +96,117 @@ type AliPay struct {
 	SellerID     string `yaml:"seller_id" mapstructure:"seller_id"`
 	IsProduction bool   `yaml:"is_production" mapstructure:"is_production"`
 }
+
+// Payment 支付渠道配置，支付宝沿用 alipay 配置
+type Payment struct {
+	DefaultProvider string    `yaml:"default_provider" mapstructure:"default_provider"` // 未指定支付渠道时使用的渠道: alipay, wechat, mock
+	WeChatPay       WeChatPay `yaml:"wechatpay" mapstructure:"wechatpay"`               // 微信支付配置
+	Mock            MockPay   `yaml:"mock" mapstructure:"mock"`                         // 模拟支付配置
+	RefundQuery     int       `yaml:"refund_query" mapstructure:"refund_query"`         // 查询处理中退款结果的间隔（秒）
+	ReconcileTime   string    `yaml:"reconcile_time" mapstructure:"reconcile_time"`     // 每天自动对账前一天账单的时间，格式为 HH:MM
+	UnpaidRemind    []int     `yaml:"unpaid_remind" mapstructure:"unpaid_remind"`       // 行程结束后向未付款乘客发送付款提醒的时间点（秒），按从小到大排列
+	UnpaidDeadline  int       `yaml:"unpaid_deadline" mapstructure:"unpaid_deadline"`   // 行程结束后的付款期限（秒），超过期限仍未付款的乘客记为欠费
+	UnpaidCheck     int       `yaml:"unpaid_check" mapstructure:"unpaid_check"`         // 扫描未付款订单的间隔（秒）
+}
+
+// WeChatPay 微信支付 APIv3 配置
+type WeChatPay struct {
+	AppID             string `yaml:"app_id" mapstructure:"app_id"`                           // 小程序AppID，为空时使用 wechat.app_id
+	MchID             string `yaml:"mch_id" mapstructure:"mch_id"`                           // 商户号
+	SerialNo          string `yaml:"serial_no" mapstructure:"serial_no"`                     // 商户API证书序列号
+	PrivateKey        string `yaml:"private_key" mapstructure:"private_key"`                 // 商户API私钥（PEM格式）
+	APIv3Key          string `yaml:"api_v3_key" mapstructure:"api_v3_key"`                   // APIv3密钥，用于解密通知内容
+	PlatformPublicKey string `yaml:"platform_public_key" mapstructure:"platform_public_key"` // 微信支付公钥或平台证书（PEM格式），用于验证应答和通知签名
+	PlatformSerial    string `yaml:"platform_serial" mapstructure:"platform_serial"`         // 微信支付公钥ID或平台证书序列号
+	NotifyURL         string `yaml:"notify_url" mapstructure:"notify_url"`                   // 支付结果通知地址
+	ServerURL         string `yaml:"server_url" mapstructure:"server_url"`                   // 接口地址，默认为 https://api.mch.weixin.qq.com
+}
+
+// MockPay 模拟支付配置
+type MockPay struct {
+	Enabled bool   `yaml:"enabled" mapstructure:"enabled"` // 是否启用模拟支付，生产环境不要开启
+	Secret  string `yaml:"secret" mapstructure:"secret"`   // 模拟支付通知的签名密钥
+}
+
+// Fare 计价配置
+type Fare struct {
+	DefaultVehicleType string     `yaml:"default_vehicle_type" mapstructure:"default_vehicle_type"` // 未指定车型时使用的车型
+	QuoteTTL           int        `yaml:"quote_ttl" mapstructure:"quote_ttl"`                       // 报价有效期（秒）
+	Rules              []FareRule `yaml:"rules" mapstructure:"rules"`                               // 各车型计价规则
+}
+
+// Dispatch 派单配置
+type Dispatch struct {
+	LowRatingThreshold     float64   `yaml:"low_rating_threshold" mapstructure:"low_rating_threshold"`         // 低评分阈值，平均评分低于该值的司机只匹配近距离订单，0表示不限制
+	LowRatingMinCount      int       `yaml:"low_rating_min_count" mapstructure:"low_rating_min_count"`         // 评价次数达到该值后才按评分限制，避免新司机被个别评价影响
+	LowRatingMaxDistance   float64   `yaml:"low_rating_max_distance" mapstructure:"low_rating_max_distance"`   // 低评分司机可匹配订单的最大距离（公里）
+	SearchRadii            []float64 `yaml:"search_radii" mapstructure:"search_radii"`                         // 按起点搜索订单的半径扩展步长（公里），从小到大依次搜索
+	SearchLimit            int       `yaml:"search_limit" mapstructure:"search_limit"`                         // 每个半径最多取回的订单数量
+	HeartbeatTimeout       int       `yaml:"heartbeat_timeout" mapstructure:"heartbeat_timeout"`               // 司机超过该时间（秒）未上报位置自动下线
+	HeartbeatCheckInterval int       `yaml:"heartbeat_check_interval" mapstructure:"heartbeat_check_interval"` // 心跳检测间隔（秒）
+	AutoDispatch           bool      `yaml:"auto_dispatch" mapstructure:"auto_dispatch"`                       // 是否开启系统自动派单
+	DispatchInterval       int       `yaml:"dispatch_interval" mapstructure:"dispatch_interval"`               // 自动派单扫描间隔（秒）
+	OfferTimeout           int       `yaml:"offer_timeout" mapstructure:"offer_timeout"`                       // 司机响应派单邀请的时限（秒）
+	OfferRadius            float64   `yaml:"offer_radius" mapstructure:"offer_radius"`                         // 派单时搜索空闲司机的半径（公里）
+	MaxRounds              int       `yaml:"max_rounds" mapstructure:"max_rounds"`                             // 最多派单轮次，超过后停止派单并提示乘客
+	Strategy               string    `yaml:"strategy" mapstructure:"strategy"`                                 // 派单策略: nearest, rating, fairness, batch
+	RatingWeight           float64   `yaml:"rating_weight" mapstructure:"rating_weight"`                       // rating 策略中司机评分每低于满分1星增加的排序距离（公里）
+	FairnessWeight         float64   `yaml:"fairness_weight" mapstructure:"fairness_weight"`                   // fairness 策略中司机每空闲1分钟减少的排序距离（公里）
+	BatchInterval          int       `yaml:"batch_interval" mapstructure:"batch_interval"`                     // batch 策略收集订单和司机的时间窗口（秒）
+}
+
+// Reputation 乘客信誉配置
+type Reputation struct {
+	MinCount        int     `yaml:"min_count" mapstructure:"min_count"`               // 司机评价次数达到该值后才按信誉分处理
+	LowThreshold    float64 `yaml:"low_threshold" mapstructure:"low_threshold"`       // 低信誉阈值，低于该值的乘客订单在派单时降低优先级，0表示不处理
+	DispatchPenalty float64 `yaml:"dispatch_penalty" mapstructure:"dispatch_penalty"` // 低信誉乘客订单在派单排序时额外增加的距离（公里）
+	BlockThreshold  float64 `yaml:"block_threshold" mapstructure:"block_threshold"`   // 禁止下单阈值，低于该值的乘客不能创建订单，0表示不禁止
+}
+
+// Reservation 预约单配置
+type Reservation struct {
+	LeadTime            int     `yaml:"lead_time" mapstructure:"lead_time"`                         // 距预约时间不超过该值（秒）时将预约单转为即时单
+	CheckInterval       int     `yaml:"check_interval" mapstructure:"check_interval"`               // 预约单调度扫描间隔（秒）
+	OverdueBoost        float64 `yaml:"overdue_boost" mapstructure:"overdue_boost"`                 // 已过预约时间仍未派出的订单在派单排序时减少的距离（公里）
+	ClaimHorizon        int     `yaml:"claim_horizon" mapstructure:"claim_horizon"`                 // 司机可以认领多久以内（秒）的预约订单
+	ClaimBuffer         int     `yaml:"claim_buffer" mapstructure:"claim_buffer"`                   // 同一司机认领的两个预约订单之间至少间隔的时间（秒），在订单预计时长之外计算
+	CancelPenaltyWindow int     `yaml:"cancel_penalty_window" mapstructure:"cancel_penalty_window"` // 距预约时间不超过该值（秒）时放弃认领计为违约
+	PenaltyLimit        int     `yaml:"penalty_limit" mapstructure:"penalty_limit"`                 // 统计周期内违约次数达到该值的司机不能认领预约订单
+	PenaltyDays         int     `yaml:"penalty_days" mapstructure:"penalty_days"`                   // 违约次数的统计周期（天）
+	RemindBefore        int     `yaml:"remind_before" mapstructure:"remind_before"`                 // 距预约时间不超过该值（秒）时提醒认领的司机上线
+}
+
+// GPS 司机位置处理配置
+type GPS struct {
+	MaxSpeed       float64 `yaml:"max_speed" mapstructure:"max_speed"`             // 相邻两次定位之间的最大合理车速（公里/小时），超过时丢弃该定位
+	SmoothWindow   int     `yaml:"smooth_window" mapstructure:"smooth_window"`     // 中值滤波使用的最近定位数量
+	MinStep        float64 `yaml:"min_step" mapstructure:"min_step"`               // 里程累加的最小位移（米），小于该值视为定位漂移
+	UploadInterval int     `yaml:"upload_interval" mapstructure:"upload_interval"` // 建议司机端上传位置的间隔（秒）
+}
+
+// Safety 行程安全配置
+type Safety struct {
+	DeviationThreshold float64 `yaml:"deviation_threshold" mapstructure:"deviation_threshold"` // 司机偏离规划路线超过该距离（米）视为偏航
+	DeviationDwell     int     `yaml:"deviation_dwell" mapstructure:"deviation_dwell"`         // 持续偏航超过该时间（秒）后产生告警
+	SOSUploadInterval  int     `yaml:"sos_upload_interval" mapstructure:"sos_upload_interval"` // 有未处理完成的紧急求助时建议所有进行中订单的司机端上传位置的间隔（秒）
+	IncidentRemind     int     `yaml:"incident_remind" mapstructure:"incident_remind"`         // 紧急求助未被确认时重复推送给管理员的间隔（秒）
+	ShareTTL           int     `yaml:"share_ttl" mapstructure:"share_ttl"`                     // 行程分享链接的有效期（秒），订单结束后链接立即失效
+	ShareBaseURL       string  `yaml:"share_base_url" mapstructure:"share_base_url"`           // 行程分享链接的访问地址前缀，例如 https://cab-hive.example.com，为空时只返回路径
+}
+
+// FareRule 单个车型的计价规则，金额单位为元
+type FareRule struct {
+	VehicleType        string  `yaml:"vehicle_type" mapstructure:"vehicle_type"`                 // 车辆类型，与车辆信息中的车型一致
+	BaseFare           float64 `yaml:"base_fare" mapstructure:"base_fare"`                       // 起步价
+	BaseDistance       float64 `yaml:"base_distance" mapstructure:"base_distance"`               // 起步价包含的里程（公里）
+	PerKm              float64 `yaml:"per_km" mapstructure:"per_km"`                             // 超出起步里程后每公里单价
+	PerMinute          float64 `yaml:"per_minute" mapstructure:"per_minute"`                     // 每分钟时长费
+	FreeWaitingMinutes float64 `yaml:"free_waiting_minutes" mapstructure:"free_waiting_minutes"` // 司机到达后免费等待时长（分钟）
+	WaitingPerMinute   float64 `yaml:"waiting_per_minute" mapstructure:"waiting_per_minute"`     // 超出免费等待后每分钟等候费
+	NightStartHour     int     `yaml:"night_start_hour" mapstructure:"night_start_hour"`         // 夜间时段开始小时（含）
+	NightEndHour       int     `yaml:"night_end_hour" mapstructure:"night_end_hour"`             // 夜间时段结束小时（不含）
+	NightSurchargeRate float64 `yaml:"night_surcharge_rate" mapstructure:"night_surcharge_rate"` // 夜间加价比例，例如 0.2 表示加价20%
+	LongDistanceKm     float64 `yaml:"long_distance_km" mapstructure:"long_distance_km"`         // 远途费起算里程（公里）
+	LongDistancePerKm  float64 `yaml:"long_distance_per_km" mapstructure:"long_distance_per_km"` // 超出远途里程后每公里返程费
+	MinimumFare        float64 `yaml:"minimum_fare" mapstructure:"minimum_fare"`                 // 最低消费
+}
@@ -21,7 +21,21 @@ var autoMigrateModels = []interface{}{
 	&model.DriverReview{},
 	&model.Vehicle{},
 	&model.VehicleReview{},
-	&model.Order{}, // 订单模型
+	&model.Order{},                     // 订单模型
+	&model.OrderEvent{},                // 订单事件模型
+	&model.RideReview{},                // 行程评价模型
+	&model.PassengerRating{},           // 乘客评价模型
+	&model.DispatchOffer{},             // 派单邀请模型
+	&model.ReservationClaim{},          // 预约订单认领模型
+	&model.LocationAudit{},             // 司机位置查看审计模型
+	&model.OrderTrail{},                // 订单实际行驶轨迹模型
+	&model.SafetyAlert{},               // 行程安全告警模型
+	&model.Incident{},                  // 紧急求助事件模型
+	&model.IncidentEvent{},             // 紧急求助事件处理记录模型
+	&model.PaymentTransaction{},        // 支付交易模型
+	&model.PaymentRefund{},             // 支付退款模型
+	&model.Reconciliation{},            // 支付对账结果模型
+	&model.ReconciliationDiscrepancy{}, // 支付对账差异模型
 }
 
 func Init() {
@@ -51,3 +51,52 @@ func ParseToken(token string) (claims *Claims, ok bool) {
 	}
 	return claims, true
 }
+
+// ShareClaims 行程分享链接的载荷
+type ShareClaims struct {
+	OrderID uint `json:"order_id"`
+	jwt.StandardClaims
+}
+
+// shareSubject 行程分享Token的主题，用于区分用户Token
+const shareSubject = "trip_share"
+
+// shareSecret 返回行程分享Token的签名密钥
+// 与用户Token使用不同的密钥，分享Token不能用于登录，用户Token也不能用于查看分享
+func shareSecret() []byte {
+	return []byte(config.Get().JWT.AccessSecret + "/" + shareSubject)
+}
+
+// CreateShareToken 签发行程分享Token
+func CreateShareToken(orderID uint, expiresAt time.Time) string {
+	claims := ShareClaims{
+		OrderID: orderID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   shareSubject,
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  time.Now().Unix(),
+		},
+	}
+	tokenClaims := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token, _ := tokenClaims.SignedString(shareSecret())
+	return token
+}
+
+// ParseShareToken 解析行程分享Token，Token过期或签名不正确时返回 false
+func ParseShareToken(token string) (claims *ShareClaims, ok bool) {
+	tokenClaims, err := jwt.ParseWithClaims(token, &ShareClaims{},
+		func(token *jwt.Token) (any, error) {
+			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+				return nil, jwt.ErrSignatureInvalid
+			}
+			return shareSecret(), nil
+		},
+	)
+	if err != nil || tokenClaims == nil {
+		return nil, false
+	}
+	if claims, ok = tokenClaims.Claims.(*ShareClaims); !ok || !tokenClaims.Valid || claims.Subject != shareSubject {
+		return nil, false
+	}
+	return claims, true
+}
@@ -9,9 +9,10 @@ var (
 
 // 400 Bad Request
 var (
-	ErrInvalidRequest  = newError(http.StatusBadRequest, "无效的请求")     // 400 Bad Request
-	ErrInvalidPassword = newError(http.StatusBadRequest, "账号或密码错误") // 400 Bad Request
-	ErrTokenInvalid    = newError(http.StatusBadRequest, "无效的token")    // 400 Bad Request
+	ErrInvalidRequest    = newError(http.StatusBadRequest, "无效的请求")         // 400 Bad Request
+	ErrInvalidPassword   = newError(http.StatusBadRequest, "账号或密码错误")     // 400 Bad Request
+	ErrTokenInvalid      = newError(http.StatusBadRequest, "无效的token")        // 400 Bad Request
+	ErrIllegalTransition = newError(http.StatusBadRequest, "非法的订单状态变更") // 400 Bad Request
 )
 
 // 401 Unauthorized
@@ -31,7 +32,8 @@ var (
 
 // 409 Conflict
 var (
-	ErrAlreadyExists = newError(http.StatusConflict, "目标已存在") // 409 Conflict
+	ErrAlreadyExists       = newError(http.StatusConflict, "目标已存在")     // 409 Conflict
+	ErrOrderStatusConflict = newError(http.StatusConflict, "订单状态已变更") // 409 Conflict
 )
 
 // 500 Internal Server Error
@@ -0,0 +1,149 @@
+package wechat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/httpclient"
+	"cab-hive/internal/global/redis"
+
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+)
+
+// accessTokenKey 缓存小程序接口调用凭据的键，多实例共享同一个凭据
+const accessTokenKey = "wechat:access_token"
+
+// accessTokenMargin 凭据提前过期的时间，避免使用即将过期的凭据
+const accessTokenMargin = 5 * time.Minute
+
+// thingMaxLength 订阅消息 thing 类型关键词的最大长度
+const thingMaxLength = 20
+
+// ErrTemplateNotConfigured 未配置订阅消息模板
+var ErrTemplateNotConfigured = errors.New("未配置订阅消息模板")
+
+// ErrNotSubscribed 用户未订阅该消息或已用完订阅次数
+var ErrNotSubscribed = errors.New("用户未订阅消息")
+
+// SubscribeMessage 小程序订阅消息
+type SubscribeMessage struct {
+	ToUser   string                // 接收者OpenID
+	Template config.WeChatTemplate // 消息模板
+	Data     map[string]string     // 模板关键词及其内容
+}
+
+// apiResponse 微信接口的通用返回字段
+type apiResponse struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+// accessTokenResponse 获取稳定版接口调用凭据的返回
+type accessTokenResponse struct {
+	apiResponse
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// SendSubscribeMessage 发送小程序订阅消息，返回nil表示微信已接收该消息
+// 用户未订阅时返回 ErrNotSubscribed，未配置模板时返回 ErrTemplateNotConfigured
+func SendSubscribeMessage(ctx context.Context, msg SubscribeMessage) error {
+	if msg.Template.ID == "" {
+		return ErrTemplateNotConfigured
+	}
+
+	token, err := getAccessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]map[string]string, len(msg.Data))
+	for key, value := range msg.Data {
+		// thing 类型的关键词超过长度时发送失败，截断后发送
+		if strings.HasPrefix(key, "thing") {
+			value = truncate(value, thingMaxLength)
+		}
+		data[key] = map[string]string{"value": value}
+	}
+
+	resp, err := httpclient.Client.R().SetContext(ctx).
+		SetQueryParam("access_token", token).
+		SetBody(map[string]interface{}{
+			"touser":            msg.ToUser,
+			"template_id":       msg.Template.ID,
+			"page":              msg.Template.Page,
+			"data":              data,
+			"miniprogram_state": config.Get().WeChat.MiniProgramState,
+			"lang":              "zh_CN",
+		}).
+		Post("https://api.weixin.qq.com/cgi-bin/message/subscribe/send")
+	if err != nil {
+		return errors.Wrap(err, "发送订阅消息失败")
+	}
+
+	var result apiResponse
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return errors.Wrap(err, "解析订阅消息返回失败")
+	}
+	switch result.ErrCode {
+	case 0:
+		return nil
+	case 43101:
+		return ErrNotSubscribed
+	case 40001, 42001:
+		// 凭据失效，清除缓存后下次重新获取
+		redis.RedisClient.Del(ctx, accessTokenKey)
+	}
+	return fmt.Errorf("微信接口错误: %d, %s", result.ErrCode, result.ErrMsg)
+}
+
+// getAccessToken 获取小程序接口调用凭据，优先使用缓存
+// 使用稳定版接口，凭据有效期内重复获取不会使已缓存的凭据失效
+func getAccessToken(ctx context.Context) (string, error) {
+	token, err := redis.RedisClient.Get(ctx, accessTokenKey).Result()
+	if err == nil {
+		return token, nil
+	}
+	if !errors.Is(err, go_redis.Nil) {
+		return "", errors.Wrap(err, "读取接口调用凭据失败")
+	}
+
+	resp, err := httpclient.Client.R().SetContext(ctx).
+		SetBody(map[string]string{
+			"grant_type": "client_credential",
+			"appid":      config.Get().WeChat.AppID,
+			"secret":     config.Get().WeChat.AppSecret,
+		}).
+		Post("https://api.weixin.qq.com/cgi-bin/stable_token")
+	if err != nil {
+		return "", errors.Wrap(err, "获取接口调用凭据失败")
+	}
+
+	var result accessTokenResponse
+	if err := json.Unmarshal(resp.Body(), &result); err != nil {
+		return "", errors.Wrap(err, "解析接口调用凭据失败")
+	}
+	if result.ErrCode != 0 || result.AccessToken == "" {
+		return "", fmt.Errorf("微信接口错误: %d, %s", result.ErrCode, result.ErrMsg)
+	}
+
+	expiration := time.Duration(result.ExpiresIn)*time.Second - accessTokenMargin
+	if expiration > 0 {
+		redis.RedisClient.Set(ctx, accessTokenKey, result.AccessToken, expiration)
+	}
+	return result.AccessToken, nil
+}
+
+// truncate 将字符串截断为不超过指定的字符数
+func truncate(value string, length int) string {
+	runes := []rune(value)
+	if len(runes) <= length {
+		return value
+	}
+	return string(runes[:length-1]) + "…"
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// DispatchOffer 定义系统派单时向司机发出的订单邀请
+// 每一轮派单向一名司机发出邀请，司机拒绝或超时后派给下一名司机
+type DispatchOffer struct {
+	Model
+	OrderID      uint       `gorm:"type:bigint;index;not null"`      // 订单ID
+	DriverOpenID string     `gorm:"type:varchar(50);index;not null"` // 司机OpenID
+	Round        int        `gorm:"type:int;not null"`               // 派单轮次，从1开始
+	Distance     float64    `gorm:"type:decimal(10,2)"`              // 派单时司机到订单起点的距离（公里）
+	Strategy     string     `gorm:"type:varchar(20);index"`          // 发出邀请时使用的派单策略，用于对比不同策略的效果
+	Status       string     `gorm:"type:varchar(20);index;not null"` // 邀请状态: pending, accepted, declined, expired, cancelled
+	ExpiresAt    time.Time  `gorm:"type:timestamptz;not null"`       // 邀请过期时间
+	RespondedAt  *time.Time `gorm:"type:timestamptz"`                // 司机响应或邀请失效时间
+}
+
+// DispatchOffer 邀请状态枚举
+const (
+	OfferStatusPending   = "pending"   // 等待司机响应
+	OfferStatusAccepted  = "accepted"  // 司机已接受
+	OfferStatusDeclined  = "declined"  // 司机已拒绝
+	OfferStatusExpired   = "expired"   // 司机超时未响应
+	OfferStatusCancelled = "cancelled" // 订单已被取消或已由其他司机承接
+)
@@ -9,4 +9,6 @@ type Driver struct {
 	Phone           string `gorm:"type:varchar(20);not null"`             // 电话号码
 	LicenseImageURL string `gorm:"type:text"`                             // 驾照图片URL
 	Status          string `gorm:"type:varchar(20);default:'pending'"`    // 状态: pending, approved, rejected, banned
+	Rating          float64 `gorm:"type:decimal(3,2);default:0"`          // 乘客评价的平均评分
+	RatingCount     int     `gorm:"type:int;default:0"`                   // 乘客评价次数
 }
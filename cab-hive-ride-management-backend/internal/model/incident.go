@@ -0,0 +1,86 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+)
+
+// Incident 定义乘客或司机在行程中发起的紧急求助事件
+// 发起时冻结订单、双方信息、车辆和最后位置的快照，需要管理员确认并处理
+type Incident struct {
+	Model
+	OrderID        uint             `gorm:"type:bigint;index;not null"`      // 订单ID
+	ReporterOpenID string           `gorm:"type:varchar(50);index;not null"` // 发起人OpenID
+	ReporterRole   string           `gorm:"type:varchar(20);not null"`       // 发起人角色: passenger, driver
+	UserOpenID     string           `gorm:"type:varchar(50);index;not null"` // 乘客OpenID
+	DriverOpenID   string           `gorm:"type:varchar(50);index;not null"` // 司机OpenID
+	Priority       string           `gorm:"type:varchar(10);not null"`       // 优先级: high
+	Status         string           `gorm:"type:varchar(20);index;not null"` // 事件状态: open, acknowledged, resolved
+	Message        string           `gorm:"type:text"`                       // 发起人填写的说明
+	Snapshot       IncidentSnapshot `gorm:"type:jsonb"`                      // 发起时的现场快照
+	AcknowledgedBy string           `gorm:"type:varchar(50)"`                // 确认事件的管理员OpenID
+	AcknowledgedAt *time.Time       `gorm:"type:timestamptz"`                // 确认时间
+	ResolvedBy     string           `gorm:"type:varchar(50)"`                // 处理事件的管理员OpenID
+	ResolvedAt     *time.Time       `gorm:"type:timestamptz"`                // 处理完成时间
+	Resolution     string           `gorm:"type:text"`                       // 处理结果说明
+}
+
+// IncidentSnapshot 定义紧急求助发起时的现场快照，发起后不再修改
+type IncidentSnapshot struct {
+	OrderStatus      string            `json:"order_status"`      // 订单状态
+	StartLocation    Location          `json:"start_location"`    // 起点
+	EndLocation      Location          `json:"end_location"`      // 终点
+	StartTime        *time.Time        `json:"start_time"`        // 出发时间
+	PassengerName    string            `json:"passenger_name"`    // 乘客昵称
+	DriverName       string            `json:"driver_name"`       // 司机姓名
+	DriverPhone      string            `json:"driver_phone"`      // 司机电话
+	PlateNumber      string            `json:"plate_number"`      // 车牌号码
+	VehicleDesc      string            `json:"vehicle_desc"`      // 车辆品牌、型号和颜色
+	ReporterLocation *IncidentLocation `json:"reporter_location"` // 发起人上报的位置，未上报时为空
+	DriverLocation   *IncidentLocation `json:"driver_location"`   // 司机最后上传的位置，获取不到时为空
+	CapturedAt       time.Time         `json:"captured_at"`       // 快照时间
+}
+
+// IncidentLocation 定义快照中的位置
+type IncidentLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Time      int64   `json:"time"` // 定位时间（Unix秒）
+}
+
+// IncidentEvent 定义紧急求助事件的处理记录
+// 记录只追加不修改，用于审计事件的完整处理经过
+type IncidentEvent struct {
+	Model
+	IncidentID  uint   `gorm:"type:bigint;index;not null"` // 紧急求助事件ID
+	ActorOpenID string `gorm:"type:varchar(50);index"`     // 操作人OpenID，系统操作时为空
+	ActorRole   string `gorm:"type:varchar(20);not null"`  // 操作人角色: passenger, driver, admin, system
+	FromStatus  string `gorm:"type:varchar(20)"`           // 变更前状态，发起时为空
+	ToStatus    string `gorm:"type:varchar(20);not null"`  // 变更后状态
+	Note        string `gorm:"type:text"`                  // 操作说明
+}
+
+// Incident 优先级枚举
+const (
+	IncidentPriorityHigh = "high" // 高优先级
+)
+
+// Incident 事件状态枚举
+const (
+	IncidentStatusOpen         = "open"         // 待确认
+	IncidentStatusAcknowledged = "acknowledged" // 已确认，处理中
+	IncidentStatusResolved     = "resolved"     // 已处理
+)
+
+// 实现 IncidentSnapshot 的 driver.Valuer 和 sql.Scanner 接口
+func (s IncidentSnapshot) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+func (s *IncidentSnapshot) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	return json.Unmarshal(value.([]byte), s)
+}
@@ -0,0 +1,20 @@
+package model
+
+// LocationAudit 定义管理员查看司机实时位置的审计记录
+// 管理员绕过订单权限查看司机位置时必须填写原因，记录只追加不修改
+type LocationAudit struct {
+	Model
+	AdminOpenID  string `gorm:"type:varchar(50);index;not null"` // 管理员OpenID
+	DriverOpenID string `gorm:"type:varchar(50);index;not null"` // 被查看位置的司机OpenID
+	OrderID      uint   `gorm:"type:bigint;index"`               // 关联订单ID，按司机查看时为0
+	Source       string `gorm:"type:varchar(20);not null"`       // 查看方式: order, driver, realtime
+	Reason       string `gorm:"type:text;not null"`              // 查看原因
+	ClientIP     string `gorm:"type:varchar(64)"`                // 请求来源IP
+}
+
+// LocationAudit 查看方式枚举
+const (
+	LocationAuditSourceOrder    = "order"    // 按订单查看司机位置
+	LocationAuditSourceDriver   = "driver"   // 按司机查看位置
+	LocationAuditSourceRealtime = "realtime" // 订阅订单实时事件
+)
@@ -36,24 +36,43 @@ type RouteStep struct {
 // Order 定义订单信息的结构体
 type Order struct {
 	Model
-	UserOpenID    string          `gorm:"type:varchar(50);index;not null"`               // 用户OpenID
-	DriverOpenID  string          `gorm:"type:varchar(50);index"`                        // 司机OpenID
-	VehicleID     uint            `gorm:"type:bigint;index"`                             // 车辆ID
-	StartLocation Location        `gorm:"type:jsonb"`                                    // 起点位置
-	EndLocation   Location        `gorm:"type:jsonb"`                                    // 终点位置
-	RoutePoints   LocationPoints `gorm:"type:jsonb"`                                    // 路线点
-	StartTime     *time.Time      `gorm:"type:timestamptz"`                              // 出发时间
-	EndTime       *time.Time      `gorm:"type:timestamptz"`                              // 实际结束时间
-	Distance      float64         `gorm:"type:decimal(10,2)"`                            // 距离（公里）
-	Duration      int             `gorm:"type:int"`                                      // 预计时长（分钟）
-	Fare          float64         `gorm:"type:decimal(10,2)"`                            // 费用
-	Tolls         float64         `gorm:"type:decimal(10,2)"`                            // 过路费
-	Status        string          `gorm:"type:varchar(20);default:'waiting_for_driver'"` // 订单状态
-	Comment       string          `gorm:"type:text"`                                     // 备注
-	PaymentTime   *time.Time      `gorm:"type:timestamptz"`                              // 支付时间
-	CancelReason  string          `gorm:"type:text"`                                     // 取消原因
-	Rating        int             `gorm:"type:int;default:0"`                            // 司机评分
-	ReserveTime   *time.Time      `gorm:"type:timestamptz"`                              //预约时间
+	UserOpenID     string         `gorm:"type:varchar(50);index;not null"`               // 用户OpenID
+	DriverOpenID   string         `gorm:"type:varchar(50);index"`                        // 司机OpenID
+	VehicleID      uint           `gorm:"type:bigint;index"`                             // 车辆ID
+	StartLocation  Location       `gorm:"type:jsonb"`                                    // 起点位置
+	EndLocation    Location       `gorm:"type:jsonb"`                                    // 终点位置
+	RoutePoints    LocationPoints `gorm:"type:jsonb"`                                    // 路线点
+	StartTime      *time.Time     `gorm:"type:timestamptz"`                              // 出发时间
+	EndTime        *time.Time     `gorm:"type:timestamptz"`                              // 实际结束时间
+	Distance       float64        `gorm:"type:decimal(10,2)"`                            // 距离（公里）
+	Duration       int            `gorm:"type:int"`                                      // 预计时长（分钟）
+	Fare           float64        `gorm:"type:decimal(10,2)"`                            // 费用
+	Tolls          float64        `gorm:"type:decimal(10,2)"`                            // 过路费
+	Status         string         `gorm:"type:varchar(20);default:'waiting_for_driver'"` // 订单状态
+	Comment        string         `gorm:"type:text"`                                     // 备注
+	PaymentTime    *time.Time     `gorm:"type:timestamptz"`                              // 支付时间
+	CancelReason   string         `gorm:"type:text"`                                     // 取消原因
+	Rating         int            `gorm:"type:int;default:0"`                            // 司机评分
+	ReserveTime    *time.Time     `gorm:"type:timestamptz"`                              //预约时间
+	FareDetail     FareBreakdown  `gorm:"type:jsonb"`                                    // 费用明细
+	RefundedAmount float64        `gorm:"type:decimal(10,2);default:0"`                  // 已退款金额
+	PayRemindCount int            `gorm:"type:int;default:0"`                            // 已发送的付款提醒次数
+}
+
+// FareBreakdown 定义订单费用明细的结构，金额单位为元
+type FareBreakdown struct {
+	QuoteID         string  `json:"quote_id,omitempty"` // 下单时使用的报价ID，未使用报价时为空
+	VehicleType     string  `json:"vehicle_type"`       // 计价车型
+	Distance        float64 `json:"distance"`           // 计价距离（公里）
+	Duration        float64 `json:"duration"`           // 计价时长（分钟）
+	BaseFare        float64 `json:"base_fare"`          // 起步价
+	DistanceFee     float64 `json:"distance_fee"`       // 里程费
+	TimeFee         float64 `json:"time_fee"`           // 时长费
+	WaitingFee      float64 `json:"waiting_fee"`        // 等候费
+	NightSurcharge  float64 `json:"night_surcharge"`    // 夜间加价
+	LongDistanceFee float64 `json:"long_distance_fee"`  // 远途返程费
+	Tolls           float64 `json:"tolls"`              // 过路费
+	Total           float64 `json:"total"`              // 合计
 }
 
 // 实现 driver.Valuer 和 sql.Scanner 接口以便在数据库中存储 JSON
@@ -103,6 +122,17 @@ func (lps *LocationPoints) Scan(value interface{}) error {
 	return json.Unmarshal(bytes, lps)
 }
 
+func (fb FareBreakdown) Value() (driver.Value, error) {
+	return json.Marshal(fb)
+}
+
+func (fb *FareBreakdown) Scan(value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	return json.Unmarshal(value.([]byte), fb)
+}
+
 func (rs RouteStep) Value() (driver.Value, error) {
 	return json.Marshal(rs)
 }
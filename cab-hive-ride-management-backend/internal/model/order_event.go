@@ -0,0 +1,23 @@
+package model
+
+// OrderEvent 定义订单状态变更事件的结构体
+// 事件只追加不修改，用于还原订单的完整经过
+type OrderEvent struct {
+	Model
+	OrderID     uint    `gorm:"type:bigint;index;not null"` // 订单ID
+	ActorOpenID string  `gorm:"type:varchar(50);index"`     // 操作人OpenID，系统操作时为空
+	ActorRole   string  `gorm:"type:varchar(20);not null"`  // 操作人角色: passenger, driver, admin, system
+	FromStatus  string  `gorm:"type:varchar(20)"`           // 变更前状态，创建订单时为空
+	ToStatus    string  `gorm:"type:varchar(20);not null"`  // 变更后状态
+	Latitude    float64 `gorm:"type:decimal(10,6)"`         // 操作时纬度
+	Longitude   float64 `gorm:"type:decimal(10,6)"`         // 操作时经度
+	Reason      string  `gorm:"type:text"`                  // 变更原因
+}
+
+// OrderEvent 操作人角色枚举
+const (
+	ActorRolePassenger = "passenger" // 乘客
+	ActorRoleDriver    = "driver"    // 司机
+	ActorRoleAdmin     = "admin"     // 管理员
+	ActorRoleSystem    = "system"    // 系统
+)
@@ -0,0 +1,47 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// TrailPoint 定义司机在订单进行中上传的一个轨迹点
+type TrailPoint struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Status    string  `json:"status"` // 上传时的订单状态，用于区分接驾段和送驾段
+	Time      int64   `json:"time"`   // 上传时间（Unix秒）
+}
+
+// TrailPoints 定义轨迹点切片类型
+type TrailPoints []TrailPoint
+
+// OrderTrail 定义订单的实际行驶轨迹
+// 行程进行中轨迹点暂存在Redis中，行程结束后一次性写入数据库，用于纠纷处理和费用核对
+type OrderTrail struct {
+	Model
+	OrderID      uint        `gorm:"type:bigint;uniqueIndex;not null"` // 订单ID
+	DriverOpenID string      `gorm:"type:varchar(50);index;not null"`  // 司机OpenID
+	Points       TrailPoints `gorm:"type:jsonb"`                       // 按上传顺序排列的轨迹点
+	PointCount   int         `gorm:"type:int"`                         // 轨迹点数量
+}
+
+// 实现 TrailPoints 的 driver.Valuer 和 sql.Scanner 接口
+func (tps TrailPoints) Value() (driver.Value, error) {
+	return json.Marshal(tps)
+}
+
+func (tps *TrailPoints) Scan(value interface{}) error {
+	if value == nil {
+		*tps = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		return fmt.Errorf("无法将值转换为字节切片")
+	}
+
+	return json.Unmarshal(bytes, tps)
+}
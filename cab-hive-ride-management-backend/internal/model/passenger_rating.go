@@ -0,0 +1,19 @@
+package model
+
+// 司机标记乘客的问题类型
+const (
+	PassengerFlagNoShow  = "no_show" // 乘客爽约
+	PassengerFlagAbusive = "abusive" // 乘客言行不文明
+)
+
+// PassengerRating 定义司机对乘客的评价
+// 订单完成或取消后，承接订单的司机可以评价乘客，每个订单只能评价一次
+type PassengerRating struct {
+	Model
+	OrderID      uint   `gorm:"type:bigint;uniqueIndex:idx_passenger_ratings_order_id;not null"` // 订单ID
+	DriverOpenID string `gorm:"type:varchar(50);index;not null"`                                 // 评价司机OpenID
+	UserOpenID   string `gorm:"type:varchar(50);index;not null"`                                 // 被评价乘客OpenID
+	Rating       int    `gorm:"type:int;not null"`                                               // 评分: 1-5星
+	Flag         string `gorm:"type:varchar(20)"`                                                // 问题标记: no_show, abusive，为空表示无问题
+	Comment      string `gorm:"type:text"`                                                       // 评价内容
+}
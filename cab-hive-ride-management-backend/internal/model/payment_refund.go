@@ -0,0 +1,51 @@
+package model
+
+import "time"
+
+// PaymentRefund 定义对一笔支付交易发起的退款
+// 管理员每次发起退款都会记录一条退款，处理中的退款定时向支付渠道查询结果
+type PaymentRefund struct {
+	Model
+	OrderID       uint       `gorm:"type:bigint;index;not null"`      // 订单ID
+	TransactionID uint       `gorm:"type:bigint;index;not null"`      // 支付交易ID
+	Provider      string     `gorm:"type:varchar(20);not null"`       // 支付渠道: alipay, wechat, mock
+	OutTradeNo    string     `gorm:"type:varchar(64);not null"`       // 原交易的商户订单号
+	OutRefundNo   string     `gorm:"type:varchar(64);uniqueIndex"`    // 商户退款单号
+	RefundNo      string     `gorm:"type:varchar(64)"`                // 支付渠道退款单号
+	Amount        float64    `gorm:"type:decimal(10,2);not null"`     // 退款金额（元）
+	ReasonCode    string     `gorm:"type:varchar(30);not null"`       // 退款原因代码
+	Reason        string     `gorm:"type:text"`                       // 退款原因说明
+	Status        string     `gorm:"type:varchar(20);index;not null"` // 退款状态: pending, success, failed
+	RawStatus     string     `gorm:"type:varchar(64)"`                // 支付渠道原始退款状态
+	ErrorMessage  string     `gorm:"type:text"`                       // 退款失败原因
+	OperatorID    string     `gorm:"type:varchar(50);not null"`       // 发起退款的管理员OpenID
+	QueryCount    int        `gorm:"type:int;not null;default:0"`     // 查询退款结果的次数
+	RefundedAt    *time.Time `gorm:"type:timestamptz"`                // 退款成功时间
+}
+
+// PaymentRefund 退款状态枚举
+const (
+	RefundStatusPending = "pending" // 退款处理中
+	RefundStatusSuccess = "success" // 退款成功
+	RefundStatusFailed  = "failed"  // 退款失败
+)
+
+// PaymentRefund 退款原因代码枚举
+const (
+	RefundReasonTripCancelled    = "trip_cancelled"    // 行程取消
+	RefundReasonDriverNoShow     = "driver_no_show"    // 司机未到达
+	RefundReasonOvercharge       = "overcharge"        // 多收费用
+	RefundReasonServiceComplaint = "service_complaint" // 服务投诉
+	RefundReasonDuplicatePayment = "duplicate_payment" // 重复支付
+	RefundReasonOther            = "other"             // 其他
+)
+
+// RefundReasons 退款原因代码对应的说明
+var RefundReasons = map[string]string{
+	RefundReasonTripCancelled:    "行程取消",
+	RefundReasonDriverNoShow:     "司机未到达",
+	RefundReasonOvercharge:       "多收费用",
+	RefundReasonServiceComplaint: "服务投诉",
+	RefundReasonDuplicatePayment: "重复支付",
+	RefundReasonOther:            "其他",
+}
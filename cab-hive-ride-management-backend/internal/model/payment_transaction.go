@@ -0,0 +1,29 @@
+package model
+
+import "time"
+
+// PaymentTransaction 定义订单在支付渠道中的一笔支付交易
+// 乘客每次在一个支付渠道发起支付时创建或复用交易，支付平台的通知按交易幂等处理
+type PaymentTransaction struct {
+	Model
+	OrderID      uint       `gorm:"type:bigint;index;not null"`                                                                                                // 订单ID
+	UserOpenID   string     `gorm:"type:varchar(50);index;not null"`                                                                                           // 付款乘客OpenID
+	Provider     string     `gorm:"type:varchar(20);not null;uniqueIndex:idx_payment_transactions_out_trade_no;uniqueIndex:idx_payment_transactions_trade_no"` // 支付渠道: alipay, wechat, mock
+	OutTradeNo   string     `gorm:"type:varchar(64);not null;uniqueIndex:idx_payment_transactions_out_trade_no"`                                               // 商户订单号
+	TradeNo      string     `gorm:"type:varchar(64);not null;default:'';uniqueIndex:idx_payment_transactions_trade_no,where:trade_no <> ''"`                   // 支付渠道交易号，支付成功后记录
+	Amount       float64    `gorm:"type:decimal(10,2);not null"`                                                                                               // 应付金额（元），取自订单费用
+	Status       string     `gorm:"type:varchar(20);index;not null"`                                                                                           // 交易状态: pending, success, closed, failed
+	SellerID     string     `gorm:"type:varchar(64)"`                                                                                                          // 支付通知中的收款方标识
+	PaidAt       *time.Time `gorm:"type:timestamptz"`                                                                                                          // 支付时间
+	RawPayload   string     `gorm:"type:text"`                                                                                                                 // 确认支付成功的通知原文
+	NotifyCount  int        `gorm:"type:int;not null;default:0"`                                                                                               // 收到的支付通知次数，包括重复通知
+	LastNotifyAt *time.Time `gorm:"type:timestamptz"`                                                                                                          // 最近一次收到支付通知的时间
+}
+
+// PaymentTransaction 交易状态枚举
+const (
+	PaymentStatusPending = "pending" // 等待付款
+	PaymentStatusSuccess = "success" // 支付成功
+	PaymentStatusClosed  = "closed"  // 未付款关闭
+	PaymentStatusFailed  = "failed"  // 支付失败
+)
@@ -0,0 +1,78 @@
+package model
+
+import "time"
+
+// Reconciliation 定义一个支付渠道一天账单的对账结果
+// 同一支付渠道同一账单日期只保留一条对账结果，重新对账时覆盖统计数据
+type Reconciliation struct {
+	Model
+	Provider          string  `gorm:"type:varchar(20);not null;uniqueIndex:idx_reconciliations_provider_date"` // 支付渠道: alipay
+	BillDate          string  `gorm:"type:varchar(10);not null;uniqueIndex:idx_reconciliations_provider_date"` // 账单日期，格式为 2006-01-02
+	Source            string  `gorm:"type:varchar(20);not null"`                                               // 账单来源: download, upload
+	Status            string  `gorm:"type:varchar(20);not null"`                                               // 对账状态: completed, failed
+	BillTradeCount    int     `gorm:"type:int;not null;default:0"`                                             // 账单中的交易笔数
+	BillTradeAmount   float64 `gorm:"type:decimal(12,2);not null;default:0"`                                   // 账单中的交易金额（元）
+	BillRefundCount   int     `gorm:"type:int;not null;default:0"`                                             // 账单中的退款笔数
+	BillRefundAmount  float64 `gorm:"type:decimal(12,2);not null;default:0"`                                   // 账单中的退款金额（元）
+	LocalTradeCount   int     `gorm:"type:int;not null;default:0"`                                             // 本地当天支付成功的交易笔数
+	LocalTradeAmount  float64 `gorm:"type:decimal(12,2);not null;default:0"`                                   // 本地当天支付成功的交易金额（元）
+	LocalRefundCount  int     `gorm:"type:int;not null;default:0"`                                             // 本地当天退款成功的笔数
+	LocalRefundAmount float64 `gorm:"type:decimal(12,2);not null;default:0"`                                   // 本地当天退款成功的金额（元）
+	MatchedCount      int     `gorm:"type:int;not null;default:0"`                                             // 双方一致的笔数
+	DiscrepancyCount  int     `gorm:"type:int;not null;default:0"`                                             // 发现的差异笔数
+	ErrorMessage      string  `gorm:"type:text"`                                                               // 对账失败原因
+	OperatorID        string  `gorm:"type:varchar(50)"`                                                        // 手动对账的管理员OpenID，自动对账时为空
+}
+
+// Reconciliation 对账状态枚举
+const (
+	ReconciliationStatusCompleted = "completed" // 对账完成
+	ReconciliationStatusFailed    = "failed"    // 账单获取或解析失败
+)
+
+// Reconciliation 账单来源枚举
+const (
+	BillSourceDownload = "download" // 从支付渠道下载
+	BillSourceUpload   = "upload"   // 管理员上传的账单文件
+)
+
+// ReconciliationDiscrepancy 定义对账发现的一笔差异，由管理员核实后处理
+type ReconciliationDiscrepancy struct {
+	Model
+	ReconciliationID uint       `gorm:"type:bigint;index;not null"` // 对账结果ID
+	Provider         string     `gorm:"type:varchar(20);not null"`  // 支付渠道
+	BillDate         string     `gorm:"type:varchar(10);index"`     // 账单日期
+	Type             string     `gorm:"type:varchar(20);index"`     // 差异类型: missing_local, missing_remote, amount_mismatch
+	Category         string     `gorm:"type:varchar(10);not null"`  // 业务类型: trade, refund
+	OrderID          uint       `gorm:"type:bigint;index"`          // 订单ID，无法对应订单时为0
+	OutTradeNo       string     `gorm:"type:varchar(64)"`           // 商户订单号
+	TradeNo          string     `gorm:"type:varchar(64)"`           // 支付渠道交易号
+	OutRefundNo      string     `gorm:"type:varchar(64)"`           // 商户退款单号，退款差异时记录
+	BillAmount       float64    `gorm:"type:decimal(10,2)"`         // 账单金额（元）
+	LocalAmount      float64    `gorm:"type:decimal(10,2)"`         // 本地交易或退款金额（元）
+	OrderFare        float64    `gorm:"type:decimal(10,2)"`         // 订单费用（元）
+	Detail           string     `gorm:"type:text"`                  // 差异说明
+	Status           string     `gorm:"type:varchar(20);index"`     // 处理状态: open, resolved
+	ResolvedBy       string     `gorm:"type:varchar(50)"`           // 处理的管理员OpenID
+	ResolvedAt       *time.Time `gorm:"type:timestamptz"`           // 处理时间
+	Resolution       string     `gorm:"type:text"`                  // 处理说明
+}
+
+// ReconciliationDiscrepancy 差异类型枚举
+const (
+	DiscrepancyMissingLocal   = "missing_local"   // 账单中有，本地没有或未确认成功
+	DiscrepancyMissingRemote  = "missing_remote"  // 本地成功，账单中没有
+	DiscrepancyAmountMismatch = "amount_mismatch" // 双方都有但金额不一致
+)
+
+// ReconciliationDiscrepancy 业务类型枚举
+const (
+	DiscrepancyCategoryTrade  = "trade"  // 支付交易
+	DiscrepancyCategoryRefund = "refund" // 退款
+)
+
+// ReconciliationDiscrepancy 处理状态枚举
+const (
+	DiscrepancyStatusOpen     = "open"     // 待处理
+	DiscrepancyStatusResolved = "resolved" // 已处理
+)
@@ -0,0 +1,27 @@
+package model
+
+import "time"
+
+// ReservationClaim 定义司机提前认领预约订单的记录
+// 同一订单同一时间只能有一条有效认领，到达预约调度时间时由认领的司机直接承接
+type ReservationClaim struct {
+	Model
+	OrderID      uint       `gorm:"type:bigint;not null;uniqueIndex:idx_reservation_claims_active_order,where:status = 'active'"` // 订单ID
+	DriverOpenID string     `gorm:"type:varchar(50);index;not null"`                                                              // 司机OpenID
+	VehicleID    uint       `gorm:"type:bigint;not null"`                                                                         // 承接订单使用的车辆ID
+	ReserveTime  time.Time  `gorm:"type:timestamptz;index;not null"`                                                              // 订单预约时间
+	Duration     int        `gorm:"type:int"`                                                                                     // 订单预计时长（分钟）
+	Status       string     `gorm:"type:varchar(20);index;not null"`                                                              // 认领状态: active, released, cancelled, fulfilled, missed
+	Penalized    bool       `gorm:"default:false"`                                                                                // 是否计为司机违约
+	RemindedAt   *time.Time `gorm:"type:timestamptz"`                                                                             // 提醒司机的时间
+	ClosedAt     *time.Time `gorm:"type:timestamptz"`                                                                             // 认领结束时间
+}
+
+// ReservationClaim 认领状态枚举
+const (
+	ClaimStatusActive    = "active"    // 认领有效
+	ClaimStatusReleased  = "released"  // 司机主动放弃
+	ClaimStatusCancelled = "cancelled" // 乘客取消订单
+	ClaimStatusFulfilled = "fulfilled" // 司机已承接订单
+	ClaimStatusMissed    = "missed"    // 司机未按时上线，订单转为普通派单
+)
@@ -0,0 +1,12 @@
+package model
+
+// RideReview 定义乘客对已完成行程的评价
+// 每个订单只能评价一次
+type RideReview struct {
+	Model
+	OrderID      uint   `gorm:"type:bigint;uniqueIndex:idx_ride_reviews_order_id;not null"` // 订单ID
+	UserOpenID   string `gorm:"type:varchar(50);index;not null"`                            // 评价乘客OpenID
+	DriverOpenID string `gorm:"type:varchar(50);index;not null"`                            // 被评价司机OpenID
+	Rating       int    `gorm:"type:int;not null"`                                          // 评分: 1-5星
+	Comment      string `gorm:"type:text"`                                                  // 评价内容
+}
@@ -0,0 +1,35 @@
+package model
+
+import "time"
+
+// SafetyAlert 定义行程中自动检测到的安全告警
+// 告警由系统产生，推送给管理员和乘客，需要管理员确认并处理
+type SafetyAlert struct {
+	Model
+	OrderID        uint       `gorm:"type:bigint;index;not null"`      // 订单ID
+	UserOpenID     string     `gorm:"type:varchar(50);index;not null"` // 乘客OpenID
+	DriverOpenID   string     `gorm:"type:varchar(50);index;not null"` // 司机OpenID
+	Type           string     `gorm:"type:varchar(30);index;not null"` // 告警类型: route_deviation
+	Latitude       float64    `gorm:"type:decimal(10,6)"`              // 触发告警时司机纬度
+	Longitude      float64    `gorm:"type:decimal(10,6)"`              // 触发告警时司机经度
+	Distance       float64    `gorm:"type:decimal(10,2)"`              // 触发告警时偏离路线的距离（米）
+	Message        string     `gorm:"type:text"`                       // 告警描述
+	Status         string     `gorm:"type:varchar(20);index;not null"` // 告警状态: open, acknowledged, resolved
+	AcknowledgedBy string     `gorm:"type:varchar(50)"`                // 确认告警的管理员OpenID
+	AcknowledgedAt *time.Time `gorm:"type:timestamptz"`                // 确认时间
+	ResolvedBy     string     `gorm:"type:varchar(50)"`                // 处理告警的管理员OpenID
+	ResolvedAt     *time.Time `gorm:"type:timestamptz"`                // 处理完成时间
+	Resolution     string     `gorm:"type:text"`                       // 处理结果说明
+}
+
+// SafetyAlert 告警类型枚举
+const (
+	SafetyAlertTypeRouteDeviation = "route_deviation" // 偏离规划路线
+)
+
+// SafetyAlert 告警状态枚举
+const (
+	SafetyAlertStatusOpen         = "open"         // 待确认
+	SafetyAlertStatusAcknowledged = "acknowledged" // 已确认，处理中
+	SafetyAlertStatusResolved     = "resolved"     // 已处理
+)
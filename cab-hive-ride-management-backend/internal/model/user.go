@@ -4,6 +4,7 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"errors"
+	"time"
 )
 
 type User struct {
@@ -13,6 +14,14 @@ type User struct {
 	AvatarURL string  `gorm:"type:varchar(255)"` // 用户头像URL
 	OpenID   string   `gorm:"type:varchar(50);uniqueIndex:idx_users_open_id;not null"`
 	UserInfo UserInfo `gorm:"type:jsonb"` // UserInfo作为User结构体的成员，并持久化到数据库
+
+	// 乘客信誉，由司机对乘客的评价汇总而来
+	Reputation      float64 `gorm:"type:decimal(3,2);default:0"` // 司机评价的平均评分
+	ReputationCount int     `gorm:"type:int;default:0"`          // 司机评价次数
+	FlagCount       int     `gorm:"type:int;default:0"`          // 被司机标记为爽约或不文明的次数
+
+	// 乘客欠费，有超过付款期限仍未支付的行程时设置，结清后清空
+	ArrearsSince *time.Time `gorm:"type:timestamptz"` // 欠费开始时间，欠费期间不能下单
 	
 	// Backend-only fields - these are for internal use and not returned to frontend
 	SessionKey string `gorm:"type:varchar(50)" json:"-"` // WeChat session key, not exposed to frontend
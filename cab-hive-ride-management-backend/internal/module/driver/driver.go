@@ -5,6 +5,7 @@ import (
 	"cab-hive/internal/global/jwt"
 	"cab-hive/internal/global/response"
 	"cab-hive/internal/model"
+	"cab-hive/internal/module/ride"
 	"cab-hive/internal/module/vehicle"
 	"fmt"
 	"strconv"
@@ -17,13 +18,15 @@ import (
 
 // DriverResponse 定义司机信息响应的结构体
 type DriverResponse struct {
-	ID              uint   `json:"id"`
-	OpenID          string `json:"open_id"`
-	LicenseNumber   string `json:"license_number"`
-	Name            string `json:"name"`
-	Phone           string `json:"phone"`
-	LicenseImageURL string `json:"license_image_url"`
-	Status          string `json:"status"`
+	ID              uint    `json:"id"`
+	OpenID          string  `json:"open_id"`
+	LicenseNumber   string  `json:"license_number"`
+	Name            string  `json:"name"`
+	Phone           string  `json:"phone"`
+	LicenseImageURL string  `json:"license_image_url"`
+	Status          string  `json:"status"`
+	Rating          float64 `json:"rating"`       // 乘客评价的平均评分
+	RatingCount     int     `json:"rating_count"` // 乘客评价次数
 }
 
 // PendingDriverResponse 定义待审核司机信息响应的结构体
@@ -292,6 +295,8 @@ func GetAllDrivers(c *gin.Context) {
 			Phone:           d.Phone,
 			LicenseImageURL: d.LicenseImageURL,
 			Status:          d.Status,
+			Rating:          d.Rating,
+			RatingCount:     d.RatingCount,
 		}
 	}
 
@@ -377,6 +382,8 @@ func GetDriver(c *gin.Context) {
 		Phone:           driver.Phone,
 		LicenseImageURL: driver.LicenseImageURL,
 		Status:          driver.Status,
+		Rating:          driver.Rating,
+		RatingCount:     driver.RatingCount,
 	}
 
 	// 返回成功响应
@@ -402,6 +409,13 @@ func BanDriver(c *gin.Context) {
 		return
 	}
 
+	// 被封禁的司机立即下线
+	if err := database.DB.Where("id = ?", DriverID).First(&driver).Error; err == nil {
+		if err := ride.SetDriverOffline(driver.OpenID); err != nil {
+			log.Error("封禁司机后下线失败", "error", err, "driver_id", DriverID)
+		}
+	}
+
 	// 返回成功响应
 	log.Info("封禁司机成功", "driver_id", DriverID)
 	response.Success(c, nil)
@@ -0,0 +1,254 @@
+// Package fare 提供服务端计价引擎
+// 根据车型计价规则计算起步价、里程费、时长费、等候费、夜间加价、远途返程费和过路费，
+// 订单费用和支付金额都以此处的计算结果为准，不信任客户端传入的金额
+package fare
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// defaultVehicleType 未配置默认车型时使用的车型
+const defaultVehicleType = "轿车"
+
+// quoteDistanceTolerance 实际距离超出报价距离的容忍倍数，超出后按实际行程重新计价
+const quoteDistanceTolerance = 1.2
+
+// defaultRules 未配置计价规则时使用的内置规则
+var defaultRules = []config.FareRule{
+	{
+		VehicleType:        "轿车",
+		BaseFare:           10,
+		BaseDistance:       3,
+		PerKm:              2.5,
+		PerMinute:          0.5,
+		FreeWaitingMinutes: 5,
+		WaitingPerMinute:   1,
+		NightStartHour:     23,
+		NightEndHour:       5,
+		NightSurchargeRate: 0.2,
+		LongDistanceKm:     15,
+		LongDistancePerKm:  1,
+		MinimumFare:        10,
+	},
+	{
+		VehicleType:        "SUV",
+		BaseFare:           14,
+		BaseDistance:       3,
+		PerKm:              3.2,
+		PerMinute:          0.6,
+		FreeWaitingMinutes: 5,
+		WaitingPerMinute:   1.2,
+		NightStartHour:     23,
+		NightEndHour:       5,
+		NightSurchargeRate: 0.2,
+		LongDistanceKm:     15,
+		LongDistancePerKm:  1.5,
+		MinimumFare:        14,
+	},
+}
+
+// RuleResponse 定义计价规则响应的结构体
+type RuleResponse struct {
+	VehicleType        string  `json:"vehicle_type"`
+	BaseFare           float64 `json:"base_fare"`
+	BaseDistance       float64 `json:"base_distance"`
+	PerKm              float64 `json:"per_km"`
+	PerMinute          float64 `json:"per_minute"`
+	FreeWaitingMinutes float64 `json:"free_waiting_minutes"`
+	WaitingPerMinute   float64 `json:"waiting_per_minute"`
+	NightStartHour     int     `json:"night_start_hour"`
+	NightEndHour       int     `json:"night_end_hour"`
+	NightSurchargeRate float64 `json:"night_surcharge_rate"`
+	LongDistanceKm     float64 `json:"long_distance_km"`
+	LongDistancePerKm  float64 `json:"long_distance_per_km"`
+	MinimumFare        float64 `json:"minimum_fare"`
+}
+
+// Trip 定义计价所需的行程信息
+type Trip struct {
+	VehicleType    string    // 车辆类型，为空时使用默认车型
+	Distance       float64   // 行驶距离（公里）
+	Duration       float64   // 行驶时长（分钟）
+	WaitingMinutes float64   // 司机到达后的等待时长（分钟）
+	StartTime      time.Time // 出发时间，用于判断夜间时段
+	Tolls          float64   // 过路费
+}
+
+// Rules 获取当前生效的计价规则
+func Rules() []config.FareRule {
+	if rules := config.Get().Fare.Rules; len(rules) > 0 {
+		return rules
+	}
+	return defaultRules
+}
+
+// DefaultVehicleType 获取默认计价车型
+func DefaultVehicleType() string {
+	if vehicleType := config.Get().Fare.DefaultVehicleType; vehicleType != "" {
+		return vehicleType
+	}
+	return defaultVehicleType
+}
+
+// RuleFor 获取指定车型的计价规则
+// 车型不存在时回退到默认车型，默认车型也不存在时使用第一条规则
+func RuleFor(vehicleType string) config.FareRule {
+	rules := Rules()
+	for _, name := range []string{vehicleType, DefaultVehicleType()} {
+		for _, rule := range rules {
+			if strings.EqualFold(rule.VehicleType, name) {
+				return rule
+			}
+		}
+	}
+	return rules[0]
+}
+
+// Calculate 按车型计价规则计算行程费用明细
+func Calculate(trip Trip) model.FareBreakdown {
+	rule := RuleFor(trip.VehicleType)
+	b := model.FareBreakdown{
+		VehicleType: rule.VehicleType,
+		Distance:    round(trip.Distance),
+		Duration:    round(trip.Duration),
+		BaseFare:    rule.BaseFare,
+		Tolls:       round(trip.Tolls),
+	}
+
+	// 里程费：超出起步里程的部分按公里计费
+	if extra := trip.Distance - rule.BaseDistance; extra > 0 {
+		b.DistanceFee = round(extra * rule.PerKm)
+	}
+
+	// 时长费
+	if trip.Duration > 0 {
+		b.TimeFee = round(trip.Duration * rule.PerMinute)
+	}
+
+	// 等候费：超出免费等待时长的部分按分钟计费
+	if extra := trip.WaitingMinutes - rule.FreeWaitingMinutes; extra > 0 {
+		b.WaitingFee = round(extra * rule.WaitingPerMinute)
+	}
+
+	// 远途返程费：超出远途里程的部分按公里加收
+	if rule.LongDistanceKm > 0 {
+		if extra := trip.Distance - rule.LongDistanceKm; extra > 0 {
+			b.LongDistanceFee = round(extra * rule.LongDistancePerKm)
+		}
+	}
+
+	// 夜间加价：按比例加收起步价、里程费和时长费
+	if isNightTime(trip.StartTime, rule) {
+		b.NightSurcharge = round((b.BaseFare + b.DistanceFee + b.TimeFee) * rule.NightSurchargeRate)
+	}
+
+	// 计算合计，不低于最低消费（过路费另计）
+	subtotal := b.BaseFare + b.DistanceFee + b.TimeFee + b.WaitingFee + b.NightSurcharge + b.LongDistanceFee
+	if subtotal < rule.MinimumFare {
+		b.BaseFare = round(b.BaseFare + rule.MinimumFare - subtotal)
+		subtotal = rule.MinimumFare
+	}
+	b.Total = round(subtotal + b.Tolls)
+
+	return b
+}
+
+// Final 计算行程结束时订单的最终费用
+// 车型取自订单承接车辆，等待时长取自订单事件中司机到达和接到乘客的时间差
+// 使用报价下单且实际距离未明显超出报价距离时沿用报价
+func Final(o *model.Order, endTime time.Time) (model.FareBreakdown, error) {
+	if o.FareDetail.QuoteID != "" && o.Distance <= o.FareDetail.Distance*quoteDistanceTolerance {
+		return o.FareDetail, nil
+	}
+
+	trip := Trip{
+		VehicleType: o.FareDetail.VehicleType,
+		Distance:    o.Distance,
+		Duration:    float64(o.Duration),
+		Tolls:       o.Tolls,
+		StartTime:   endTime,
+	}
+
+	// 车型以承接车辆为准
+	if o.VehicleID != 0 {
+		var vehicle model.Vehicle
+		err := database.DB.Where("id = ?", o.VehicleID).First(&vehicle).Error
+		if err == nil {
+			trip.VehicleType = vehicle.VehicleType
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.FareBreakdown{}, err
+		}
+	}
+
+	// 实际行驶时长
+	if o.StartTime != nil {
+		trip.StartTime = *o.StartTime
+		trip.Duration = endTime.Sub(*o.StartTime).Minutes()
+	}
+
+	// 等待时长：司机到达上车点到接到乘客之间的时间
+	var events []model.OrderEvent
+	if err := database.DB.Where("order_id = ? AND to_status IN (?, ?)",
+		o.ID, model.OrderStatusDriverArrived, model.OrderStatusInProgress).
+		Order("id ASC").Find(&events).Error; err != nil {
+		return model.FareBreakdown{}, err
+	}
+	var arrivedAt, pickedUpAt time.Time
+	for _, e := range events {
+		switch e.ToStatus {
+		case model.OrderStatusDriverArrived:
+			arrivedAt = e.CreatedAt
+		case model.OrderStatusInProgress:
+			pickedUpAt = e.CreatedAt
+		}
+	}
+	if !arrivedAt.IsZero() && pickedUpAt.After(arrivedAt) {
+		trip.WaitingMinutes = pickedUpAt.Sub(arrivedAt).Minutes()
+	}
+
+	return Calculate(trip), nil
+}
+
+// GetRules 处理查询计价规则请求
+func GetRules(c *gin.Context) {
+	// 转换为响应格式
+	rules := Rules()
+	ruleList := make([]RuleResponse, len(rules))
+	for i, rule := range rules {
+		ruleList[i] = RuleResponse(rule)
+	}
+
+	// 返回成功响应
+	response.Success(c, gin.H{
+		"default_vehicle_type": DefaultVehicleType(),
+		"rules":                ruleList,
+	})
+}
+
+// isNightTime 判断出发时间是否处于夜间计价时段
+// 支持跨零点的时段，例如 23 点到次日 5 点
+func isNightTime(t time.Time, rule config.FareRule) bool {
+	if t.IsZero() || rule.NightSurchargeRate <= 0 || rule.NightStartHour == rule.NightEndHour {
+		return false
+	}
+	hour := t.Hour()
+	if rule.NightStartHour < rule.NightEndHour {
+		return hour >= rule.NightStartHour && hour < rule.NightEndHour
+	}
+	return hour >= rule.NightStartHour || hour < rule.NightEndHour
+}
+
+// round 将金额保留两位小数
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
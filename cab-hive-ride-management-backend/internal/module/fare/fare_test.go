@@ -0,0 +1,214 @@
+package fare
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/model"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// at 返回测试日期中指定时刻的时间
+func at(hour, minute int) time.Time {
+	return time.Date(2025, 7, 16, hour, minute, 0, 0, time.Local)
+}
+
+func TestCalculate(t *testing.T) {
+	config.Set(config.Config{})
+
+	tests := []struct {
+		name     string
+		trip     Trip
+		expected model.FareBreakdown
+	}{
+		{
+			name:     "起步里程以内",
+			trip:     Trip{Distance: 3, WaitingMinutes: 5, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 3, BaseFare: 10, Total: 10},
+		},
+		{
+			name:     "里程费、时长费和等候费",
+			trip:     Trip{Distance: 10, Duration: 20, WaitingMinutes: 8, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, WaitingFee: 3, Total: 40.5},
+		},
+		{
+			name:     "夜间开始前一分钟不加价",
+			trip:     Trip{Distance: 10, Duration: 20, StartTime: at(22, 59)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, Total: 37.5},
+		},
+		{
+			name:     "夜间开始时加价",
+			trip:     Trip{Distance: 10, Duration: 20, StartTime: at(23, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, NightSurcharge: 7.5, Total: 45},
+		},
+		{
+			name:     "跨零点的夜间时段",
+			trip:     Trip{Distance: 10, Duration: 20, StartTime: at(4, 59)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, NightSurcharge: 7.5, Total: 45},
+		},
+		{
+			name:     "夜间结束时不加价",
+			trip:     Trip{Distance: 10, Duration: 20, StartTime: at(5, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, Total: 37.5},
+		},
+		{
+			name:     "没有出发时间不加价",
+			trip:     Trip{Distance: 10, Duration: 20},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, Total: 37.5},
+		},
+		{
+			name:     "远途里程以内不收返程费",
+			trip:     Trip{Distance: 15, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 15, BaseFare: 10, DistanceFee: 30, Total: 40},
+		},
+		{
+			name:     "超出远途里程收返程费",
+			trip:     Trip{Distance: 17, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 17, BaseFare: 10, DistanceFee: 35, LongDistanceFee: 2, Total: 47},
+		},
+		{
+			name:     "过路费另计",
+			trip:     Trip{Distance: 3, Tolls: 5.5, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 3, BaseFare: 10, Tolls: 5.5, Total: 15.5},
+		},
+		{
+			name:     "按车型计价",
+			trip:     Trip{VehicleType: "suv", Distance: 3, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "SUV", Distance: 3, BaseFare: 14, Total: 14},
+		},
+		{
+			name:     "未知车型使用默认车型",
+			trip:     Trip{VehicleType: "卡车", Distance: 3, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 3, BaseFare: 10, Total: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b := Calculate(tt.trip); b != tt.expected {
+				t.Errorf("计价结果 = %+v，期望 %+v", b, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCalculateMinimumFare(t *testing.T) {
+	config.Set(config.Config{Fare: config.Fare{Rules: []config.FareRule{{
+		VehicleType:        "轿车",
+		BaseFare:           5,
+		BaseDistance:       3,
+		PerKm:              2,
+		NightStartHour:     23,
+		NightEndHour:       5,
+		NightSurchargeRate: 0.2,
+		MinimumFare:        12,
+	}}}})
+	t.Cleanup(func() { config.Set(config.Config{}) })
+
+	tests := []struct {
+		name     string
+		trip     Trip
+		expected model.FareBreakdown
+	}{
+		{
+			// 不足最低消费的差额计入起步价，过路费不计入最低消费
+			name:     "不足最低消费",
+			trip:     Trip{Distance: 5, Tolls: 3, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 5, BaseFare: 8, DistanceFee: 4, Tolls: 3, Total: 15},
+		},
+		{
+			name:     "恰好达到最低消费",
+			trip:     Trip{Distance: 6.5, StartTime: at(12, 0)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 6.5, BaseFare: 5, DistanceFee: 7, Total: 12},
+		},
+		{
+			name:     "夜间加价后达到最低消费",
+			trip:     Trip{Distance: 6, StartTime: at(23, 30)},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 6, BaseFare: 5, DistanceFee: 6, NightSurcharge: 2.2, Total: 13.2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if b := Calculate(tt.trip); b != tt.expected {
+				t.Errorf("计价结果 = %+v，期望 %+v", b, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFinal(t *testing.T) {
+	config.Set(config.Config{})
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&model.OrderEvent{}); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	database.DB = db
+
+	// 订单1的司机到达后等待了8分钟才接到乘客
+	for _, event := range []model.OrderEvent{
+		{Model: model.Model{CreatedAt: at(11, 50)}, OrderID: 1, ActorRole: model.ActorRoleDriver, ToStatus: model.OrderStatusDriverArrived},
+		{Model: model.Model{CreatedAt: at(11, 58)}, OrderID: 1, ActorRole: model.ActorRoleDriver, ToStatus: model.OrderStatusInProgress},
+	} {
+		if err := db.Create(&event).Error; err != nil {
+			t.Fatalf("创建订单事件失败: %v", err)
+		}
+	}
+
+	quoted := model.FareBreakdown{QuoteID: "quote", VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, Total: 37.5}
+	startTime := at(12, 0)
+	endTime := at(12, 20)
+
+	tests := []struct {
+		name     string
+		order    model.Order
+		expected model.FareBreakdown
+	}{
+		{
+			name:     "实际距离等于报价距离时沿用报价",
+			order:    model.Order{Model: model.Model{ID: 2}, Distance: 10, FareDetail: quoted},
+			expected: quoted,
+		},
+		{
+			name:     "实际距离在容忍范围边界时沿用报价",
+			order:    model.Order{Model: model.Model{ID: 2}, Distance: 12, FareDetail: quoted},
+			expected: quoted,
+		},
+		{
+			name:     "实际距离超出容忍范围时按实际行程计价",
+			order:    model.Order{Model: model.Model{ID: 2}, Distance: 12.5, StartTime: &startTime, FareDetail: quoted},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 12.5, Duration: 20, BaseFare: 10, DistanceFee: 23.75, TimeFee: 10, Total: 43.75},
+		},
+		{
+			name:     "未使用报价时按实际行程和等待时长计价",
+			order:    model.Order{Model: model.Model{ID: 1}, Distance: 10, Tolls: 5, StartTime: &startTime},
+			expected: model.FareBreakdown{VehicleType: "轿车", Distance: 10, Duration: 20, BaseFare: 10, DistanceFee: 17.5, TimeFee: 10, WaitingFee: 3, Tolls: 5, Total: 45.5},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Final(&tt.order, endTime)
+			if err != nil {
+				t.Fatalf("计算最终费用失败: %v", err)
+			}
+			if b != tt.expected {
+				t.Errorf("计价结果 = %+v，期望 %+v", b, tt.expected)
+			}
+		})
+	}
+}
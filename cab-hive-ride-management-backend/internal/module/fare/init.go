@@ -0,0 +1,30 @@
+package fare
+
+import (
+	"cab-hive/internal/global/logger"
+	"log/slog"
+)
+
+var log *slog.Logger
+
+// ModuleFare 计价模块结构体
+type ModuleFare struct{}
+
+// GetName 获取模块名称
+func (m *ModuleFare) GetName() string {
+	return "fare"
+}
+
+// Init 初始化计价模块
+func (m *ModuleFare) Init() {
+	log = logger.New("fare")
+	for _, rule := range Rules() {
+		log.Info("加载计价规则", "vehicle_type", rule.VehicleType, "base_fare", rule.BaseFare, "per_km", rule.PerKm)
+	}
+}
+
+// selfInit 自初始化函数
+func selfInit() {
+	m := &ModuleFare{}
+	m.Init()
+}
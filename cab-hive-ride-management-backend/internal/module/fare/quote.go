@@ -0,0 +1,250 @@
+package fare
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// defaultQuoteTTL 未配置报价有效期时使用的有效期
+const defaultQuoteTTL = 5 * time.Minute
+
+// errInvalidQuote 报价ID格式错误或签名校验失败
+var errInvalidQuote = errors.New("invalid quote")
+
+// EstimateRequest 定义费用预估请求的结构体
+// 路线字段与创建订单请求保持一致，前端可以直接复用同一份路线数据
+type EstimateRequest struct {
+	Points        []model.LocationPoint `json:"points"`
+	Distance      int                   `json:"distance"` // 路线距离（米）
+	Duration      int                   `json:"duration"` // 预计时长（分钟）
+	Tolls         float64               `json:"tolls"`
+	StartLocation model.Location        `json:"startLocation"`
+	EndLocation   model.Location        `json:"endLocation"`
+	ReserveTime   string                `json:"reserveTime"` // 预约时间，为空表示立即出发
+}
+
+// QuoteResponse 定义单个车型报价响应的结构体
+type QuoteResponse struct {
+	QuoteID     string              `json:"quote_id"`
+	VehicleType string              `json:"vehicle_type"`
+	Fare        float64             `json:"fare"`
+	FareDetail  model.FareBreakdown `json:"fare_detail"`
+	ExpiresAt   string              `json:"expires_at"`
+}
+
+// quote 定义报价签名中携带的内容
+type quote struct {
+	ID          string              `json:"id"`
+	UserOpenID  string              `json:"user_open_id"`
+	Distance    float64             `json:"distance"`               // 路线距离（公里）
+	Duration    float64             `json:"duration"`               // 预计时长（分钟）
+	Tolls       float64             `json:"tolls"`                  // 过路费
+	ReserveTime int64               `json:"reserve_time,omitempty"` // 预约时间戳，立即出发为0
+	Fare        model.FareBreakdown `json:"fare"`
+	ExpiresAt   int64               `json:"expires_at"`
+}
+
+// QuoteTTL 获取报价有效期
+func QuoteTTL() time.Duration {
+	if ttl := config.Get().Fare.QuoteTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultQuoteTTL
+}
+
+// Resolve 计算新订单的费用
+// 未提供报价ID时按当前规则计算；提供报价ID时校验签名、归属和路线信息，
+// 报价仍在有效期内则沿用报价，已过期则按当前规则重新计算
+func Resolve(userOpenID, quoteID string, trip Trip, reserveTime *time.Time) (model.FareBreakdown, error) {
+	if quoteID == "" {
+		return Calculate(trip), nil
+	}
+
+	q, err := parseQuote(quoteID)
+	if err != nil {
+		return model.FareBreakdown{}, response.ErrInvalidRequest.WithTips("报价无效")
+	}
+
+	// 报价只能由申请人用于同一路线和出发时间
+	var reserveUnix int64
+	if reserveTime != nil {
+		reserveUnix = reserveTime.Unix()
+	}
+	if q.UserOpenID != userOpenID || q.Distance != round(trip.Distance) || q.Duration != round(trip.Duration) ||
+		q.Tolls != round(trip.Tolls) || q.ReserveTime != reserveUnix {
+		return model.FareBreakdown{}, response.ErrInvalidRequest.WithTips("报价与订单信息不一致")
+	}
+
+	// 报价已过期时按报价车型重新计算
+	if time.Now().Unix() > q.ExpiresAt {
+		log.Info("报价已过期，按当前规则重新计价", "quote_id", q.ID, "user_open_id", userOpenID)
+		trip.VehicleType = q.Fare.VehicleType
+		return Calculate(trip), nil
+	}
+
+	breakdown := q.Fare
+	breakdown.QuoteID = q.ID
+	return breakdown, nil
+}
+
+// EstimateFare 处理下单前的费用预估请求
+// 按路线信息为每个车型生成一份带签名的短期报价，下单时可携带报价ID锁定价格
+func EstimateFare(c *gin.Context) {
+	// 解析请求参数
+	var req EstimateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("绑定费用预估请求失败", "error", err)
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	if req.Distance <= 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("路线距离必须大于0"))
+		return
+	}
+
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取载荷信息")
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		log.Error("载荷类型错误")
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 解析预约时间，与创建预约订单的格式保持一致
+	now := time.Now()
+	trip := Trip{
+		Distance:  float64(req.Distance) / 1000,
+		Duration:  float64(req.Duration),
+		StartTime: now,
+		Tolls:     req.Tolls,
+	}
+	var reserveUnix int64
+	if req.ReserveTime != "" {
+		reserveTime, err := time.Parse("2006-01-02 15:04:05", req.ReserveTime)
+		if err != nil {
+			log.Error("解析预约时间失败", "error", err)
+			response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+			return
+		}
+		if reserveTime.Before(now) {
+			response.Fail(c, response.ErrInvalidRequest.WithTips("预约时间不能早于当前时间"))
+			return
+		}
+		trip.StartTime = reserveTime
+		reserveUnix = reserveTime.Unix()
+	}
+
+	// 为每个车型生成报价
+	expiresAt := now.Add(QuoteTTL())
+	rules := Rules()
+	quotes := make([]QuoteResponse, 0, len(rules))
+	for _, rule := range rules {
+		trip.VehicleType = rule.VehicleType
+		id, err := newQuoteID()
+		if err != nil {
+			log.Error("生成报价ID失败", "error", err)
+			response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+			return
+		}
+		q := quote{
+			ID:          id,
+			UserOpenID:  payload.OpenID,
+			Distance:    round(trip.Distance),
+			Duration:    round(trip.Duration),
+			Tolls:       round(trip.Tolls),
+			ReserveTime: reserveUnix,
+			Fare:        Calculate(trip),
+			ExpiresAt:   expiresAt.Unix(),
+		}
+
+		quoteID, err := signQuote(q)
+		if err != nil {
+			log.Error("生成报价失败", "error", err)
+			response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+			return
+		}
+
+		quotes = append(quotes, QuoteResponse{
+			QuoteID:     quoteID,
+			VehicleType: rule.VehicleType,
+			Fare:        q.Fare.Total,
+			FareDetail:  q.Fare,
+			ExpiresAt:   expiresAt.Format("2006/01/02 15:04:05"),
+		})
+	}
+
+	// 返回成功响应
+	log.Info("费用预估成功", "user_open_id", payload.OpenID, "distance", trip.Distance, "quotes", len(quotes))
+	response.Success(c, quotes)
+}
+
+// signQuote 将报价内容编码并签名，返回可交给前端的报价ID
+// 格式为 base64(报价内容).base64(HMAC-SHA256签名)
+func signQuote(q quote) (string, error) {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(data)
+	return body + "." + base64.RawURLEncoding.EncodeToString(quoteSignature(body)), nil
+}
+
+// parseQuote 校验报价ID的签名并解析报价内容
+func parseQuote(quoteID string) (*quote, error) {
+	body, sig, found := strings.Cut(quoteID, ".")
+	if !found {
+		return nil, errInvalidQuote
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(signature, quoteSignature(body)) {
+		return nil, errInvalidQuote
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, err
+	}
+	var q quote
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, err
+	}
+	return &q, nil
+}
+
+// newQuoteID 生成随机报价编号
+func newQuoteID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// quoteSignature 使用JWT密钥计算报价签名
+func quoteSignature(body string) []byte {
+	mac := hmac.New(sha256.New, []byte("fare-quote:"+config.Get().JWT.AccessSecret))
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,26 @@
+package fare
+
+import (
+	"cab-hive/internal/global/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitRouter 初始化计价模块的路由
+// 将计价相关的 HTTP 端点挂载到指定的路由组
+// 该方法会在模块初始化时被调用
+// 参数:
+//   - r: gin.RouterGroup，表示父路由组，用于挂载子路由
+func (m *ModuleFare) InitRouter(r *gin.RouterGroup) {
+	// 定义计价模块的路由组，所有计价相关端点以 /fares 为前缀
+	fareGroup := r.Group("/fares")
+
+	// 需要用户认证的端点（信息公开）
+	fareGroup.Use(middleware.Auth(1))
+	{
+		// 获取各车型计价规则
+		fareGroup.GET("/rules", GetRules)
+		// 下单前按路线预估各车型费用
+		fareGroup.POST("/estimate", EstimateFare)
+	}
+}
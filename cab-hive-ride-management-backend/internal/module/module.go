@@ -2,13 +2,16 @@
 
 import (
 	"cab-hive/internal/module/admin"
-	"cab-hive/internal/module/alipay"
 	"cab-hive/internal/module/auth"
 	"cab-hive/internal/module/driver"
+	"cab-hive/internal/module/fare"
 	"cab-hive/internal/module/image"
 	"cab-hive/internal/module/order"
+	"cab-hive/internal/module/payment"
 	"cab-hive/internal/module/ping"
+	"cab-hive/internal/module/realtime"
 	"cab-hive/internal/module/ride"
+	"cab-hive/internal/module/safety"
 	"cab-hive/internal/module/user"
 	"cab-hive/internal/module/vehicle"
 	"github.com/gin-gonic/gin"
@@ -36,8 +39,11 @@ func init() {
 		&ping.ModulePing{},
 		&user.ModuleUser{},
 		&vehicle.ModuleVehicle{},
+		&fare.ModuleFare{},
+		&realtime.ModuleRealtime{},
+		&safety.ModuleSafety{},
 		&order.ModuleOrder{},
-		&alipay.ModuleAlipay{},
+		&payment.ModulePayment{},
 		&ride.ModuleRide{},
 	})
 }
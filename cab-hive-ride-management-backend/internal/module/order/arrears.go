@@ -0,0 +1,28 @@
+package order
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// checkPassengerArrears 检查乘客是否欠费，欠费的乘客结清未支付的行程前不能创建订单
+// 欠费由支付模块在行程超过付款期限仍未支付时标记，支付成功后清除
+func checkPassengerArrears(openID string) error {
+	var user model.User
+	if err := database.DB.Select("id", "arrears_since").Where("open_id = ?", openID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	if user.ArrearsSince != nil {
+		log.Warn("乘客欠费，拒绝创建订单", "user_open_id", openID, "arrears_since", user.ArrearsSince)
+		return response.ErrForbidden.WithTips("您有超过付款期限未支付的行程，请先完成支付")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package order
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Actor 定义触发订单状态变更的操作人
+type Actor struct {
+	OpenID    string  // 操作人OpenID，系统操作时为空
+	Role      string  // 操作人角色: passenger, driver, admin, system
+	Latitude  float64 // 操作时纬度
+	Longitude float64 // 操作时经度
+	Reason    string  // 变更原因
+}
+
+// PassengerActor 创建乘客操作人
+func PassengerActor(openID, reason string) Actor {
+	return Actor{OpenID: openID, Role: model.ActorRolePassenger, Reason: reason}
+}
+
+// DriverActor 创建司机操作人
+func DriverActor(openID, reason string) Actor {
+	return Actor{OpenID: openID, Role: model.ActorRoleDriver, Reason: reason}
+}
+
+// AdminActor 创建管理员操作人
+func AdminActor(openID, reason string) Actor {
+	return Actor{OpenID: openID, Role: model.ActorRoleAdmin, Reason: reason}
+}
+
+// SystemActor 创建系统操作人，用于定时任务和支付回调等非用户触发的变更
+func SystemActor(reason string) Actor {
+	return Actor{Role: model.ActorRoleSystem, Reason: reason}
+}
+
+// At 返回附带操作位置的操作人
+func (a Actor) At(latitude, longitude float64) Actor {
+	a.Latitude = latitude
+	a.Longitude = longitude
+	return a
+}
+
+// OrderEventResponse 定义订单事件响应的结构体
+type OrderEventResponse struct {
+	ID          uint    `json:"id"`
+	OrderID     uint    `json:"order_id"`
+	ActorOpenID string  `json:"actor_open_id"`
+	ActorRole   string  `json:"actor_role"`
+	FromStatus  string  `json:"from_status"`
+	ToStatus    string  `json:"to_status"`
+	Latitude    float64 `json:"latitude"`
+	Longitude   float64 `json:"longitude"`
+	Reason      string  `json:"reason"`
+	CreateTime  string  `json:"create_time"`
+}
+
+// appendEvent 在指定的数据库会话中追加一条订单事件
+func appendEvent(tx *gorm.DB, orderID uint, actor Actor, from, to string) error {
+	event := model.OrderEvent{
+		OrderID:     orderID,
+		ActorOpenID: actor.OpenID,
+		ActorRole:   actor.Role,
+		FromStatus:  from,
+		ToStatus:    to,
+		Latitude:    actor.Latitude,
+		Longitude:   actor.Longitude,
+		Reason:      actor.Reason,
+	}
+	return tx.Create(&event).Error
+}
+
+// createOrder 在同一事务中保存新订单并记录创建事件
+func createOrder(o *model.Order, actor Actor) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(o).Error; err != nil {
+			return err
+		}
+		return appendEvent(tx, o.ID, actor, "", o.Status)
+	})
+}
+
+// GetOrderEvents 处理查询订单事件时间线请求
+// 乘客、承接订单的司机和管理员可以查看
+func GetOrderEvents(c *gin.Context) {
+	// 获取订单ID
+	orderID := c.Param("id")
+	if orderID == "" {
+		log.Error("订单ID参数不能为空")
+		response.Fail(c, response.ErrInvalidRequest)
+		return
+	}
+
+	// 从上下文中获取用户信息
+	payload, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取用户信息")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 断言 payload 为 jwt.Claims 类型
+	claims, ok := payload.(*jwt.Claims)
+	if !ok {
+		log.Error("用户信息类型错误")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查找当前用户有权查看的订单
+	order, err := findViewableOrder(claims, orderID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 按时间顺序查询订单事件
+	var events []model.OrderEvent
+	if err := database.DB.Where("order_id = ?", order.ID).Order("id ASC").Find(&events).Error; err != nil {
+		log.Error("查询订单事件失败", "error", err)
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 转换为响应格式
+	eventList := make([]OrderEventResponse, len(events))
+	for i, e := range events {
+		eventList[i] = OrderEventResponse{
+			ID:          e.ID,
+			OrderID:     e.OrderID,
+			ActorOpenID: e.ActorOpenID,
+			ActorRole:   e.ActorRole,
+			FromStatus:  e.FromStatus,
+			ToStatus:    e.ToStatus,
+			Latitude:    e.Latitude,
+			Longitude:   e.Longitude,
+			Reason:      e.Reason,
+			CreateTime:  e.CreatedAt.Format("2006/01/02 15:04:05"),
+		}
+	}
+
+	// 返回成功响应
+	log.Info("查询订单事件成功", "order_id", order.ID, "total", len(eventList))
+	response.Success(c, eventList)
+}
@@ -8,6 +8,7 @@ import (
 	"cab-hive/internal/global/redis"
 	"cab-hive/internal/global/response"
 	"cab-hive/internal/model"
+	"cab-hive/internal/module/fare"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -29,6 +30,7 @@ type CreateImmediateOrderRequest struct {
 	Steps         []model.RouteStep     `json:"steps"`
 	StartLocation model.Location        `json:"startLocation"`
 	EndLocation   model.Location        `json:"endLocation"`
+	QuoteID       string                `json:"quoteId"` // 费用预估返回的报价ID，可选
 }
 
 // CreateReserveOrderRequest 定义创建预约订单的请求结构
@@ -41,6 +43,7 @@ type CreateReserveOrderRequest struct {
 	Steps         []model.RouteStep     `json:"steps"`
 	StartLocation model.Location        `json:"startLocation"`
 	EndLocation   model.Location        `json:"endLocation"`
+	QuoteID       string                `json:"quoteId"` // 费用预估返回的报价ID，可选
 	ReserveTime   string                `json:"reserveTime"` // 预约时间
 }
 
@@ -75,25 +78,27 @@ type CreateImmediateOrderResponse struct {
 
 // OrderResponse 定义订单信息响应的结构体
 type OrderResponse struct {
-	ID            uint                 `json:"id"`
-	UserOpenID    string               `json:"user_open_id"`
-	DriverOpenID  string               `json:"driver_open_id"`
-	VehicleID     uint                 `json:"vehicle_id"`
-	StartLocation model.Location       `json:"start_location"`
-	EndLocation   model.Location       `json:"end_location"`
-	RoutePoints   model.LocationPoints `json:"route_points"`
-	StartTime     *string              `json:"start_time"`
-	EndTime       *string              `json:"end_time"`
-	Distance      float64              `json:"distance"`
-	Duration      int                  `json:"duration"`
-	Fare          float64              `json:"fare"`
-	Tolls         float64              `json:"tolls"`
-	Status        string               `json:"status"`
-	PaymentTime   *string              `json:"payment_time"`
-	Comment       string               `json:"comment"`
-	CancelReason  string               `json:"cancel_reason"`
-	Rating        int                  `json:"rating"`
-	ReserveTime   *string              `json:"reserve_time"` // 预约时间
+	ID             uint                 `json:"id"`
+	UserOpenID     string               `json:"user_open_id"`
+	DriverOpenID   string               `json:"driver_open_id"`
+	VehicleID      uint                 `json:"vehicle_id"`
+	StartLocation  model.Location       `json:"start_location"`
+	EndLocation    model.Location       `json:"end_location"`
+	RoutePoints    model.LocationPoints `json:"route_points"`
+	StartTime      *string              `json:"start_time"`
+	EndTime        *string              `json:"end_time"`
+	Distance       float64              `json:"distance"`
+	Duration       int                  `json:"duration"`
+	Fare           float64              `json:"fare"`
+	Tolls          float64              `json:"tolls"`
+	Status         string               `json:"status"`
+	PaymentTime    *string              `json:"payment_time"`
+	Comment        string               `json:"comment"`
+	CancelReason   string               `json:"cancel_reason"`
+	Rating         int                  `json:"rating"`
+	ReserveTime    *string              `json:"reserve_time"`    // 预约时间
+	FareDetail     model.FareBreakdown  `json:"fare_detail"`     // 费用明细
+	RefundedAmount float64              `json:"refunded_amount"` // 已退款金额
 }
 
 // OrderListResponse 定义订单列表响应的结构体
@@ -142,6 +147,18 @@ func CreateImmediateOrder(c *gin.Context) {
 		return
 	}
 
+	// 检查乘客信誉是否允许下单
+	if err := checkPassengerReputation(payload.OpenID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 检查乘客是否有超过付款期限未支付的行程
+	if err := checkPassengerArrears(payload.OpenID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
 	// 检查用户是否有未完成的订单
 	var unfinishedOrder model.Order
 	err := database.DB.Where("user_open_id = ? AND status NOT IN (?, ?)",
@@ -160,8 +177,21 @@ func CreateImmediateOrder(c *gin.Context) {
 		return
 	}
 
-	// 创建订单对象
+	// 由服务端计价引擎计算预估费用，携带有效报价时沿用报价
 	now := time.Now()
+	estimate, err := fare.Resolve(payload.OpenID, req.QuoteID, fare.Trip{
+		Distance:  float64(req.Distance) / 1000,
+		Duration:  float64(req.Duration),
+		StartTime: now,
+		Tolls:     req.Tolls,
+	}, nil)
+	if err != nil {
+		log.Error("计算订单费用失败", "error", err, "user_open_id", payload.OpenID)
+		response.Fail(c, err)
+		return
+	}
+
+	// 创建订单对象
 	order := model.Order{
 		UserOpenID:    payload.OpenID,
 		StartLocation: req.StartLocation,
@@ -170,12 +200,14 @@ func CreateImmediateOrder(c *gin.Context) {
 		StartTime:     &now,
 		Distance:      float64(req.Distance) / 1000, // 转换为公里
 		Duration:      req.Duration,
-		Fare:          req.Tolls,
+		Fare:          estimate.Total,
+		Tolls:         req.Tolls,
+		FareDetail:    estimate,
 		Status:        model.OrderStatusWaitingForDriver, // 初始状态为等待司机接单
 	}
 
-	// 保存订单到数据库
-	if err := database.DB.Create(&order).Error; err != nil {
+	// 保存订单到数据库并记录创建事件
+	if err := createOrder(&order, PassengerActor(payload.OpenID, "立即出发订单")); err != nil {
 		log.Error("创建订单失败", "error", err)
 		response.Fail(c, response.ErrDatabase.WithOrigin(err))
 		return
@@ -199,7 +231,7 @@ func CreateImmediateOrder(c *gin.Context) {
 	response.Success(c, resp)
 }
 
-// RemoveOrderFromRedis 从Redis中移除订单，包括状态集合、订单内容和地理位置索引
+// RemoveOrderFromRedis 从Redis中移除订单，包括状态集合、订单内容和该状态的地理位置索引
 // 当订单状态改变时调用此函数
 func RemoveOrderFromRedis(orderID uint, status string) error {
 	redisClient := redis.RedisClient
@@ -216,8 +248,8 @@ func RemoveOrderFromRedis(orderID uint, status string) error {
 	orderKey := fmt.Sprintf("ride_order:%d", orderID)
 	pipe.Del(ctx, orderKey)
 
-	// 3. 从地理位置索引中移除订单ID
-	geoKey := "ride_orders_by_start_location"
+	// 3. 从对应状态的地理位置索引中移除订单ID
+	geoKey := "ride_orders_by_start_location:" + status
 	pipe.ZRem(ctx, geoKey, fmt.Sprintf("%d", orderID))
 
 	// 执行事务
@@ -228,14 +260,16 @@ func RemoveOrderFromRedis(orderID uint, status string) error {
 	return nil
 }
 
-// AddOrderToRedisStatusSet 将订单添加到Redis中指定状态的集合，并存储订单内容和地理位置索引
+// AddOrderToRedisStatusSet 将订单添加到Redis中指定状态的集合，并存储订单内容和该状态的地理位置索引
 // 当订单状态改变时调用此函数
 func AddOrderToRedisStatusSet(order *model.Order) error {
 	redisClient := redis.RedisClient
 	ctx := context.Background()
 
-	// 结束待付款和已完结状态不需要在Redis中维护
-	if order.Status == model.OrderStatusWaitingForPayment || order.Status == model.OrderStatusCompleted {
+	// 结束待付款、已完结和已取消状态不需要在Redis中维护，待付款订单由支付模块扫描数据库提醒付款
+	if order.Status == model.OrderStatusWaitingForPayment ||
+		order.Status == model.OrderStatusCompleted ||
+		order.Status == model.OrderStatusCancelled {
 		return nil
 	}
 
@@ -254,8 +288,8 @@ func AddOrderToRedisStatusSet(order *model.Order) error {
 	}
 	pipe.Set(ctx, orderKey, string(orderBytes), 24*time.Hour) // 一天过期，过期后自动删除
 
-	// 3. 添加订单ID和起始位置到地理位置索引
-	geoKey := "ride_orders_by_start_location"
+	// 3. 添加订单ID和起始位置到对应状态的地理位置索引，派单时只搜索等待接单的订单
+	geoKey := "ride_orders_by_start_location:" + order.Status
 	pipe.GeoAdd(ctx, geoKey, &go_redis.GeoLocation{
 		Name:      fmt.Sprintf("%d", order.ID),
 		Longitude: order.StartLocation.Longitude,
@@ -296,26 +330,14 @@ func GetOrder(c *gin.Context) {
 		return
 	}
 
-	// 查找订单
-	var order model.Order
-	query := database.DB.Where("id = ?", orderID)
-
-	// 如果不是管理员，只查询当前用户的订单
-	if claims.RoleID != 3 {
-		query = query.Where("user_open_id = ?", claims.OpenID)
-	}
-
-	if err := query.First(&order).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			log.Error("订单记录不存在", "id", orderID)
-			response.Fail(c, response.ErrNotFound)
-		} else {
-			log.Error("数据库查询失败", "error", err)
-			response.Fail(c, response.ErrDatabase.WithOrigin(err))
-		}
+	// 查找当前用户的订单，司机查看承接的订单请使用订单事件等接口
+	order, err := findUserOrder(claims, orderID)
+	if err != nil {
+		response.Fail(c, err)
 		return
 	}
-	
+
+
 	// 转换为响应格式
 	orderResp := OrderResponse{
 		ID:            order.ID,
@@ -342,6 +364,7 @@ func GetOrder(c *gin.Context) {
 		Distance: order.Distance,
 		Duration: order.Duration,
 		Fare:     order.Fare,
+		Tolls:    order.Tolls,
 		Status:   order.Status,
 		Comment:  order.Comment,
 		PaymentTime: func() *string {
@@ -360,6 +383,8 @@ func GetOrder(c *gin.Context) {
 			}
 			return nil
 		}(),
+		FareDetail:     order.FareDetail,
+		RefundedAmount: order.RefundedAmount,
 	}
 	
 	// 返回成功响应
@@ -367,6 +392,47 @@ func GetOrder(c *gin.Context) {
 	response.Success(c, orderResp)
 }
 
+// findUserOrder 查找当前用户下单的订单
+// 管理员可以查看所有订单，乘客只能查看自己下单的订单
+func findUserOrder(claims *jwt.Claims, orderID string) (*model.Order, error) {
+	query := database.DB.Where("id = ?", orderID)
+
+	// 如果不是管理员，只查询当前用户的订单
+	if claims.RoleID != 3 {
+		query = query.Where("user_open_id = ?", claims.OpenID)
+	}
+
+	return firstOrder(query, orderID)
+}
+
+// findViewableOrder 查找当前用户有权查看的订单
+// 管理员可以查看所有订单，乘客和司机只能查看自己下单或承接的订单
+func findViewableOrder(claims *jwt.Claims, orderID string) (*model.Order, error) {
+	query := database.DB.Where("id = ?", orderID)
+
+	// 如果不是管理员，只查询当前用户下单或承接的订单
+	if claims.RoleID != 3 {
+		query = query.Where("user_open_id = ? OR driver_open_id = ?", claims.OpenID, claims.OpenID)
+	}
+
+	return firstOrder(query, orderID)
+}
+
+// firstOrder 执行订单查询，订单不存在时返回 ErrNotFound
+func firstOrder(query *gorm.DB, orderID string) (*model.Order, error) {
+	var order model.Order
+	if err := query.First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("订单记录不存在", "id", orderID)
+			return nil, response.ErrNotFound
+		}
+		log.Error("数据库查询失败", "error", err)
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	return &order, nil
+}
+
 // GetUnfinishedOrder 处理查询用户未完成订单请求
 func GetUnfinishedOrder(c *gin.Context) {
 	// 从上下文中获取用户信息
@@ -431,6 +497,7 @@ func GetUnfinishedOrder(c *gin.Context) {
 		Distance: order.Distance,
 		Duration: order.Duration,
 		Fare:     order.Fare,
+		Tolls:    order.Tolls,
 		Status:   order.Status,
 		Comment:  order.Comment,
 		PaymentTime: func() *string {
@@ -449,6 +516,8 @@ func GetUnfinishedOrder(c *gin.Context) {
 			}
 			return nil
 		}(),
+		FareDetail:     order.FareDetail,
+		RefundedAmount: order.RefundedAmount,
 	}
 
 	// 返回成功响应
@@ -523,6 +592,7 @@ func GetDriverUnfinishedOrder(c *gin.Context) {
 		Distance: order.Distance,
 		Duration: order.Duration,
 		Fare:     order.Fare,
+		Tolls:    order.Tolls,
 		Status:   order.Status,
 		Comment:  order.Comment,
 		PaymentTime: func() *string {
@@ -541,6 +611,8 @@ func GetDriverUnfinishedOrder(c *gin.Context) {
 			}
 			return nil
 		}(),
+		FareDetail:     order.FareDetail,
+		RefundedAmount: order.RefundedAmount,
 	}
 
 	// 返回成功响应
@@ -601,24 +673,17 @@ func CancelOrder(c *gin.Context) {
 		return
 	}
 	
-	// 更新订单状态为已取消
+	// 更新订单状态为已取消，同时从Redis中移除订单
 	now := time.Now()
-	order.Status = model.OrderStatusCancelled
-	order.CancelReason = "用户取消"
-	order.EndTime = &now
-	
-	if err := database.DB.Save(&order).Error; err != nil {
+	if err := Transition(&order, model.OrderStatusCancelled, PassengerActor(claims.OpenID, "用户取消"), map[string]interface{}{
+		"cancel_reason": "用户取消",
+		"end_time":      now,
+	}); err != nil {
 		log.Error("更新订单状态失败", "error", err)
-		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		response.Fail(c, err)
 		return
 	}
 	
-	// 从Redis中移除订单
-	if err := RemoveOrderFromRedis(order.ID, model.OrderStatusWaitingForDriver); err != nil {
-		log.Error("从Redis移除订单失败", "error", err, "order_id", order.ID)
-		// 注意：这里不返回错误，因为订单已经成功更新到数据库
-	}
-	
 	// 返回成功响应
 	log.Info("取消订单成功", "order_id", order.ID)
 	response.Success(c, nil)
@@ -713,6 +778,7 @@ func GetUserOrders(c *gin.Context) {
 			Distance: order.Distance,
 			Duration: order.Duration,
 			Fare:     order.Fare,
+			Tolls:    order.Tolls,
 			Status:   order.Status,
 			Comment:  order.Comment,
 			PaymentTime: func() *string {
@@ -731,6 +797,8 @@ func GetUserOrders(c *gin.Context) {
 				}
 				return nil
 			}(),
+			FareDetail:     order.FareDetail,
+			RefundedAmount: order.RefundedAmount,
 		}
 	}
 
@@ -800,6 +868,18 @@ func CreateReserveOrder(c *gin.Context) {
 		return
 	}
 
+	// 检查乘客信誉是否允许下单
+	if err := checkPassengerReputation(payload.OpenID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 检查乘客是否有超过付款期限未支付的行程
+	if err := checkPassengerArrears(payload.OpenID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
 	// 检查用户是否有未完成的订单
 	var unfinishedOrder model.Order
 	err = database.DB.Where("user_open_id = ? AND status NOT IN (?, ?)",
@@ -818,6 +898,19 @@ func CreateReserveOrder(c *gin.Context) {
 		return
 	}
 
+	// 由服务端计价引擎计算预估费用，携带有效报价时沿用报价
+	estimate, err := fare.Resolve(payload.OpenID, req.QuoteID, fare.Trip{
+		Distance:  float64(req.Distance) / 1000,
+		Duration:  float64(req.Duration),
+		StartTime: reserveTime,
+		Tolls:     req.Tolls,
+	}, &reserveTime)
+	if err != nil {
+		log.Error("计算预约订单费用失败", "error", err, "user_open_id", payload.OpenID)
+		response.Fail(c, err)
+		return
+	}
+
 	// 创建订单对象
 	order := model.Order{
 		UserOpenID:    payload.OpenID,
@@ -827,12 +920,14 @@ func CreateReserveOrder(c *gin.Context) {
 		ReserveTime:   &reserveTime,
 		Distance:      float64(req.Distance) / 1000, // 转换为公里
 		Duration:      req.Duration,
-		Fare:          req.Tolls,
+		Fare:          estimate.Total,
+		Tolls:         req.Tolls,
+		FareDetail:    estimate,
 		Status:        model.OrderStatusReserved, // 初始状态为预约中
 	}
 
-	// 保存订单到数据库
-	if err := database.DB.Create(&order).Error; err != nil {
+	// 保存订单到数据库并记录创建事件
+	if err := createOrder(&order, PassengerActor(payload.OpenID, "预约订单")); err != nil {
 		log.Error("创建预约订单失败", "error", err)
 		response.Fail(c, response.ErrDatabase.WithOrigin(err))
 		return
@@ -946,6 +1041,7 @@ func GetDriverOrders(c *gin.Context) {
 			Distance: order.Distance,
 			Duration: order.Duration,
 			Fare:     order.Fare,
+			Tolls:    order.Tolls,
 			Status:   order.Status,
 			Comment:  order.Comment,
 			PaymentTime: func() *string {
@@ -964,6 +1060,8 @@ func GetDriverOrders(c *gin.Context) {
 				}
 				return nil
 			}(),
+			FareDetail:     order.FareDetail,
+			RefundedAmount: order.RefundedAmount,
 		}
 	}
 
@@ -1072,6 +1170,7 @@ func GetAllOrders(c *gin.Context) {
 			Distance: order.Distance,
 			Duration: order.Duration,
 			Fare:     order.Fare,
+			Tolls:    order.Tolls,
 			Status:   order.Status,
 			Comment:  order.Comment,
 			PaymentTime: func() *string {
@@ -1090,6 +1189,8 @@ func GetAllOrders(c *gin.Context) {
 				}
 				return nil
 			}(),
+			FareDetail:     order.FareDetail,
+			RefundedAmount: order.RefundedAmount,
 		}
 	}
 
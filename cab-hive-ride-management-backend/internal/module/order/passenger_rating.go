@@ -0,0 +1,188 @@
+package order
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// RatePassengerRequest 定义司机评价乘客请求的结构体
+type RatePassengerRequest struct {
+	Rating  int    `json:"rating" binding:"required,min=1,max=5"`          // 评分: 1-5星
+	Flag    string `json:"flag" binding:"omitempty,oneof=no_show abusive"` // 问题标记: no_show, abusive
+	Comment string `json:"comment" binding:"max=500"`                      // 评价内容
+}
+
+// PassengerRatingResponse 定义司机评价乘客响应的结构体
+type PassengerRatingResponse struct {
+	ID           uint   `json:"id"`
+	OrderID      uint   `json:"order_id"`
+	DriverOpenID string `json:"driver_open_id"`
+	UserOpenID   string `json:"user_open_id"`
+	Rating       int    `json:"rating"`
+	Flag         string `json:"flag"`
+	Comment      string `json:"comment"`
+	CreateTime   string `json:"create_time"`
+}
+
+// RatePassenger 处理司机评价乘客的请求
+// 订单完成或取消后，承接订单的司机可以评价乘客并标记爽约或不文明行为，每个订单只能评价一次
+func RatePassenger(c *gin.Context) {
+	// 获取订单ID
+	orderID := c.Param("id")
+	if orderID == "" {
+		log.Error("订单ID参数不能为空")
+		response.Fail(c, response.ErrInvalidRequest)
+		return
+	}
+
+	// 解析请求参数
+	var req RatePassengerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("绑定评价乘客请求失败", "error", err)
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 从上下文中获取司机信息
+	payload, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取司机信息")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 断言 payload 为 jwt.Claims 类型
+	claims, ok := payload.(*jwt.Claims)
+	if !ok {
+		log.Error("司机信息类型错误")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查找当前司机承接的订单
+	var order model.Order
+	if err := database.DB.Where("id = ? AND driver_open_id = ?", orderID, claims.OpenID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("订单记录不存在或不属于当前司机", "id", orderID, "driver_open_id", claims.OpenID)
+			response.Fail(c, response.ErrNotFound)
+			return
+		}
+		log.Error("数据库查询失败", "error", err)
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 只有已完成或已取消的订单才能评价乘客
+	if order.Status != model.OrderStatusCompleted && order.Status != model.OrderStatusCancelled {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("只有已完成或已取消的订单才能评价乘客"))
+		return
+	}
+
+	rating := model.PassengerRating{
+		OrderID:      order.ID,
+		DriverOpenID: claims.OpenID,
+		UserOpenID:   order.UserOpenID,
+		Rating:       req.Rating,
+		Flag:         req.Flag,
+		Comment:      strings.TrimSpace(req.Comment),
+	}
+
+	// 在同一事务中保存评价并更新乘客信誉
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 订单ID唯一，先检查是否已评价以返回明确的提示
+		var count int64
+		if err := tx.Model(&model.PassengerRating{}).Where("order_id = ?", order.ID).Count(&count).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		if count > 0 {
+			return response.ErrInvalidRequest.WithTips("该订单已评价乘客")
+		}
+
+		if err := tx.Create(&rating).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+
+		// 按累计次数滚动更新乘客信誉分
+		updates := map[string]interface{}{
+			"reputation":       gorm.Expr("(reputation * reputation_count + ?) / (reputation_count + 1)", req.Rating),
+			"reputation_count": gorm.Expr("reputation_count + 1"),
+		}
+		if req.Flag != "" {
+			updates["flag_count"] = gorm.Expr("flag_count + 1")
+		}
+		if err := tx.Model(&model.User{}).Where("open_id = ?", order.UserOpenID).Updates(updates).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("保存乘客评价失败", "error", err, "order_id", order.ID)
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机评价乘客成功", "order_id", order.ID, "user_open_id", order.UserOpenID, "rating", req.Rating, "flag", req.Flag)
+	response.Success(c, PassengerRatingResponse{
+		ID:           rating.ID,
+		OrderID:      rating.OrderID,
+		DriverOpenID: rating.DriverOpenID,
+		UserOpenID:   rating.UserOpenID,
+		Rating:       rating.Rating,
+		Flag:         rating.Flag,
+		Comment:      rating.Comment,
+		CreateTime:   rating.CreatedAt.Format("2006/01/02 15:04:05"),
+	})
+}
+
+// LowReputationPassengers 从给定乘客中筛选出信誉分低于阈值的乘客
+// 未配置低信誉阈值时返回空集合，派单时可据此降低这些乘客订单的优先级
+func LowReputationPassengers(openIDs []string) (map[string]bool, error) {
+	cfg := config.Get().Reputation
+	result := make(map[string]bool)
+	if cfg.LowThreshold <= 0 || len(openIDs) == 0 {
+		return result, nil
+	}
+
+	var lowOpenIDs []string
+	if err := database.DB.Model(&model.User{}).
+		Where("open_id IN ? AND reputation_count >= ? AND reputation < ?", openIDs, cfg.MinCount, cfg.LowThreshold).
+		Pluck("open_id", &lowOpenIDs).Error; err != nil {
+		return nil, err
+	}
+	for _, openID := range lowOpenIDs {
+		result[openID] = true
+	}
+	return result, nil
+}
+
+// checkPassengerReputation 检查乘客信誉是否允许创建订单
+// 评价次数足够且信誉分低于禁止下单阈值时返回业务错误
+func checkPassengerReputation(openID string) error {
+	cfg := config.Get().Reputation
+	if cfg.BlockThreshold <= 0 {
+		return nil
+	}
+
+	var user model.User
+	if err := database.DB.Where("open_id = ?", openID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	if user.ReputationCount >= cfg.MinCount && user.Reputation < cfg.BlockThreshold {
+		log.Warn("乘客信誉过低，拒绝创建订单", "user_open_id", openID, "reputation", user.Reputation)
+		return response.ErrForbidden.WithTips("信誉分过低，暂时无法下单")
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+package order
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// SubmitReviewRequest 定义乘客评价行程请求的结构体
+type SubmitReviewRequest struct {
+	Rating  int    `json:"rating" binding:"required,min=1,max=5"` // 评分: 1-5星
+	Comment string `json:"comment" binding:"max=500"`             // 评价内容
+}
+
+// ReviewResponse 定义行程评价响应的结构体
+type ReviewResponse struct {
+	ID           uint   `json:"id"`
+	OrderID      uint   `json:"order_id"`
+	UserOpenID   string `json:"user_open_id"`
+	DriverOpenID string `json:"driver_open_id"`
+	Rating       int    `json:"rating"`
+	Comment      string `json:"comment"`
+	CreateTime   string `json:"create_time"`
+}
+
+// ReviewListResponse 定义行程评价列表响应的结构体
+type ReviewListResponse struct {
+	Reviews    []ReviewResponse `json:"reviews"`
+	Pagination Pagination       `json:"pagination"`
+}
+
+// SubmitReview 处理乘客评价已完成行程的请求
+// 每个订单只能评价一次，评价成功后同步更新订单评分和司机的平均评分
+func SubmitReview(c *gin.Context) {
+	// 获取订单ID
+	orderID := c.Param("id")
+	if orderID == "" {
+		log.Error("订单ID参数不能为空")
+		response.Fail(c, response.ErrInvalidRequest)
+		return
+	}
+
+	// 解析请求参数
+	var req SubmitReviewRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Error("绑定评价请求失败", "error", err)
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 从上下文中获取用户信息
+	payload, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取用户信息")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 断言 payload 为 jwt.Claims 类型
+	claims, ok := payload.(*jwt.Claims)
+	if !ok {
+		log.Error("用户信息类型错误")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查找当前用户下的订单
+	var order model.Order
+	if err := database.DB.Where("id = ? AND user_open_id = ?", orderID, claims.OpenID).First(&order).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("订单记录不存在或不属于当前用户", "id", orderID, "user_open_id", claims.OpenID)
+			response.Fail(c, response.ErrNotFound)
+			return
+		}
+		log.Error("数据库查询失败", "error", err)
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 只有已完成的订单才能评价
+	if order.Status != model.OrderStatusCompleted {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("只有已完成的订单才能评价"))
+		return
+	}
+	if order.DriverOpenID == "" {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单没有承接司机，无法评价"))
+		return
+	}
+
+	review := model.RideReview{
+		OrderID:      order.ID,
+		UserOpenID:   claims.OpenID,
+		DriverOpenID: order.DriverOpenID,
+		Rating:       req.Rating,
+		Comment:      strings.TrimSpace(req.Comment),
+	}
+
+	// 在同一事务中保存评价、更新订单评分和司机平均评分
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 订单评分为0表示尚未评价，以此为条件防止重复提交
+		result := tx.Model(&model.Order{}).Where("id = ? AND rating = 0", order.ID).Update("rating", req.Rating)
+		if result.Error != nil {
+			return response.ErrDatabase.WithOrigin(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return response.ErrInvalidRequest.WithTips("订单已评价")
+		}
+
+		if err := tx.Create(&review).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+
+		// 按累计次数滚动更新司机平均评分
+		if err := tx.Model(&model.Driver{}).Where("open_id = ?", order.DriverOpenID).Updates(map[string]interface{}{
+			"rating":       gorm.Expr("(rating * rating_count + ?) / (rating_count + 1)", req.Rating),
+			"rating_count": gorm.Expr("rating_count + 1"),
+		}).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error("保存行程评价失败", "error", err, "order_id", order.ID)
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("乘客评价行程成功", "order_id", order.ID, "driver_open_id", order.DriverOpenID, "rating", req.Rating)
+	response.Success(c, newReviewResponse(review))
+}
+
+// GetOrderReview 处理查询订单评价请求
+// 乘客、承接订单的司机和管理员可以查看
+func GetOrderReview(c *gin.Context) {
+	// 获取订单ID
+	orderID := c.Param("id")
+	if orderID == "" {
+		log.Error("订单ID参数不能为空")
+		response.Fail(c, response.ErrInvalidRequest)
+		return
+	}
+
+	// 从上下文中获取用户信息
+	payload, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取用户信息")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 断言 payload 为 jwt.Claims 类型
+	claims, ok := payload.(*jwt.Claims)
+	if !ok {
+		log.Error("用户信息类型错误")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查找当前用户有权查看的订单
+	order, err := findViewableOrder(claims, orderID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 查询订单评价，未评价时返回空
+	var review model.RideReview
+	if err := database.DB.Where("order_id = ?", order.ID).First(&review).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Success(c, nil)
+			return
+		}
+		log.Error("查询订单评价失败", "error", err)
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, newReviewResponse(review))
+}
+
+// GetDriverReviews 处理司机查询自己收到的评价请求
+func GetDriverReviews(c *gin.Context) {
+	// 从上下文中获取司机信息
+	payload, exists := c.Get("payload")
+	if !exists {
+		log.Error("无法获取司机信息")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 断言 payload 为 jwt.Claims 类型
+	claims, ok := payload.(*jwt.Claims)
+	if !ok {
+		log.Error("司机信息类型错误")
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查询司机的评分汇总
+	var driver model.Driver
+	if err := database.DB.Where("open_id = ?", claims.OpenID).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("司机信息不存在"))
+			return
+		}
+		log.Error("查询司机信息失败", "error", err)
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 构建查询条件
+	query := database.DB.Model(&model.RideReview{}).Where("driver_open_id = ?", claims.OpenID)
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("rating = ?", rating)
+	}
+
+	result, err := listReviews(c, query)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("查询司机评价列表成功", "driver_open_id", claims.OpenID, "total", result.Pagination.TotalCount)
+	response.Success(c, gin.H{
+		"rating":       driver.Rating,
+		"rating_count": driver.RatingCount,
+		"reviews":      result.Reviews,
+		"pagination":   result.Pagination,
+	})
+}
+
+// GetAllReviews 处理管理员查询所有行程评价请求
+func GetAllReviews(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.RideReview{})
+	if driverOpenID := c.Query("driver_open_id"); driverOpenID != "" {
+		query = query.Where("driver_open_id = ?", driverOpenID)
+	}
+	if userOpenID := c.Query("user_open_id"); userOpenID != "" {
+		query = query.Where("user_open_id = ?", userOpenID)
+	}
+	if rating := c.Query("rating"); rating != "" {
+		query = query.Where("rating = ?", rating)
+	}
+
+	result, err := listReviews(c, query)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("查询行程评价列表成功", "total", result.Pagination.TotalCount)
+	response.Success(c, result)
+}
+
+// listReviews 按请求中的分页参数查询评价列表
+func listReviews(c *gin.Context, query *gorm.DB) (*ReviewListResponse, error) {
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 查询评价列表
+	var reviews []model.RideReview
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("id DESC").Find(&reviews).Error; err != nil {
+		log.Error("查询评价列表失败", "error", err)
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 转换为响应格式
+	reviewList := make([]ReviewResponse, len(reviews))
+	for i, review := range reviews {
+		reviewList[i] = newReviewResponse(review)
+	}
+
+	return &ReviewListResponse{
+		Reviews: reviewList,
+		Pagination: Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	}, nil
+}
+
+// newReviewResponse 将行程评价转换为响应格式
+func newReviewResponse(review model.RideReview) ReviewResponse {
+	return ReviewResponse{
+		ID:           review.ID,
+		OrderID:      review.OrderID,
+		UserOpenID:   review.UserOpenID,
+		DriverOpenID: review.DriverOpenID,
+		Rating:       review.Rating,
+		Comment:      review.Comment,
+		CreateTime:   review.CreatedAt.Format("2006/01/02 15:04:05"),
+	}
+}
@@ -20,6 +20,30 @@ func (m *ModuleOrder) InitRouter(router *gin.RouterGroup) {
 	// 需要用户认证
 	router.GET("/orders/:id", middleware.Auth(1), GetOrder)
 
+	// 获取订单事件时间线
+	// 需要用户认证
+	router.GET("/orders/:id/events", middleware.Auth(1), GetOrderEvents)
+
+	// 乘客评价已完成的行程
+	// 需要用户认证
+	router.POST("/orders/:id/review", middleware.Auth(1), SubmitReview)
+
+	// 获取订单评价
+	// 需要用户认证
+	router.GET("/orders/:id/review", middleware.Auth(1), GetOrderReview)
+
+	// 获取司机收到的评价
+	// 需要司机认证
+	router.GET("/orders/driver/reviews", middleware.Auth(2), GetDriverReviews)
+
+	// 司机评价乘客
+	// 需要司机认证
+	router.POST("/orders/:id/passenger-rating", middleware.Auth(2), RatePassenger)
+
+	// 获取所有行程评价（管理员接口）
+	// 需要管理员认证
+	router.GET("/orders/admin/reviews", middleware.Auth(3), GetAllReviews)
+
 	// 获取用户未完成订单
 	// 需要用户认证
 	router.GET("/orders/unfinished", middleware.Auth(1), GetUnfinishedOrder)
@@ -0,0 +1,115 @@
+package order
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/realtime"
+
+	"gorm.io/gorm"
+)
+
+// transitions 定义订单状态机中合法的状态变更
+// key 为当前状态，value 为允许变更到的目标状态
+var transitions = map[string][]string{
+	model.OrderStatusReserved:          {model.OrderStatusWaitingForDriver, model.OrderStatusWaitingForPickup, model.OrderStatusCancelled},
+	model.OrderStatusWaitingForDriver:  {model.OrderStatusWaitingForPickup, model.OrderStatusCancelled},
+	model.OrderStatusWaitingForPickup:  {model.OrderStatusDriverArrived, model.OrderStatusCancelled},
+	model.OrderStatusDriverArrived:     {model.OrderStatusInProgress, model.OrderStatusCancelled},
+	model.OrderStatusInProgress:        {model.OrderStatusWaitingForPayment},
+	model.OrderStatusWaitingForPayment: {model.OrderStatusCompleted},
+}
+
+// TransitionHandler 订单状态变更成功后执行的处理函数，o 为变更后的订单
+type TransitionHandler func(o *model.Order, from, to string)
+
+// transitionHandlers 已注册的订单状态变更处理函数
+var transitionHandlers []TransitionHandler
+
+// OnTransition 注册订单状态变更成功后执行的处理函数，应在模块初始化时调用
+// 用于订单模块不能依赖的其他模块在订单状态变更后处理各自的数据，例如保存行程轨迹
+func OnTransition(handler TransitionHandler) {
+	transitionHandlers = append(transitionHandlers, handler)
+}
+
+// CanTransition 判断订单能否从 from 状态变更为 to 状态
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition 将订单从当前状态变更为目标状态，所有订单状态变更都必须经过此函数
+// 数据库更新以订单当前状态为条件（比较并设置），状态已被其他请求修改时返回 ErrOrderStatusConflict
+// actor 为触发变更的操作人，状态更新和订单事件在同一事务中写入
+// fields 为需要随状态一起更新的其他字段，更新成功后 o 会被重新加载为数据库中的最新内容，
+// 并同步维护Redis中的订单状态集合
+func Transition(o *model.Order, to string, actor Actor, fields map[string]interface{}) error {
+	from := o.Status
+	if !CanTransition(from, to) {
+		return response.ErrIllegalTransition.WithTips(from + " -> " + to)
+	}
+
+	// 构建更新字段映射
+	updates := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		updates[key] = value
+	}
+	updates["status"] = to
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 以当前状态作为更新条件，防止并发请求重复变更同一订单
+		result := tx.Model(&model.Order{}).Where("id = ? AND status = ?", o.ID, from).Updates(updates)
+		if result.Error != nil {
+			return response.ErrDatabase.WithOrigin(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return response.ErrOrderStatusConflict
+		}
+
+		// 追加订单事件
+		if err := appendEvent(tx, o.ID, actor, from, to); err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// 重新加载订单，保证返回给调用方和写入Redis的内容与数据库一致
+	if err := database.DB.First(o, o.ID).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 更新Redis中的订单状态
+	// 注意：Redis操作失败不影响状态变更结果，因为订单已经成功更新到数据库
+	if err := RemoveOrderFromRedis(o.ID, from); err != nil {
+		log.Error("从Redis移除订单失败", "error", err, "order_id", o.ID, "status", from)
+	}
+	if err := AddOrderToRedisStatusSet(o); err != nil {
+		log.Error("添加订单到Redis失败", "error", err, "order_id", o.ID, "status", to)
+	}
+
+	// 推送订单状态变更给订阅该订单的客户端
+	if err := realtime.PublishStatus(o.ID, realtime.StatusData{
+		From:         from,
+		To:           to,
+		ActorRole:    actor.Role,
+		Reason:       actor.Reason,
+		DriverOpenID: o.DriverOpenID,
+	}); err != nil {
+		log.Error("推送订单状态变更失败", "error", err, "order_id", o.ID)
+	}
+
+	// 执行其他模块注册的处理函数
+	for _, handler := range transitionHandlers {
+		handler(o, from, to)
+	}
+
+	log.Info("订单状态变更", "order_id", o.ID, "from", from, "to", to, "actor_role", actor.Role)
+	return nil
+}
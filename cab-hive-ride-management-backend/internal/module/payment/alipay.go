@@ -0,0 +1,277 @@
+package payment
+
+import (
+	"cab-hive/config"
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/smartwalle/alipay/v3"
+)
+
+// alipayTradeNotExist 支付宝交易不存在的错误码
+const alipayTradeNotExist = "ACQ.TRADE_NOT_EXIST"
+
+// alipayRefundSuccess 支付宝退款查询接口返回的退款成功状态
+const alipayRefundSuccess = "REFUND_SUCCESS"
+
+// alipayProvider 支付宝手机网站支付
+type alipayProvider struct {
+	client *alipay.Client
+	cfg    config.AliPay
+}
+
+// newAlipayProvider 初始化支付宝客户端并加载证书，配置不完整时返回 nil
+func newAlipayProvider() *alipayProvider {
+	cfg := config.Get().AliPay
+
+	// 检查必要配置是否存在
+	if cfg.AppID == "" {
+		log.Warn("支付宝配置不完整，跳过初始化")
+		return nil
+	}
+
+	// 准备选项函数
+	var opts []alipay.OptionFunc
+
+	// 设置服务器地址
+	if cfg.ServerURL != "" {
+		if cfg.IsProduction {
+			opts = append(opts, alipay.WithProductionGateway(cfg.ServerURL))
+		} else {
+			opts = append(opts, alipay.WithSandboxGateway(cfg.ServerURL))
+		}
+	}
+
+	client, err := alipay.New(cfg.AppID, cfg.PrivateKey, cfg.IsProduction, opts...)
+	if err != nil {
+		log.Error("初始化支付宝客户端失败", "error", err)
+		return nil
+	}
+
+	// 加载应用公钥证书、支付宝根证书和支付宝公钥证书
+	if err := client.LoadAppCertPublicKeyFromFile("./cert/appPublicCert.crt"); err != nil {
+		log.Error("加载应用公钥证书失败", "error", err)
+		return nil
+	}
+	if err := client.LoadAliPayRootCertFromFile("./cert/alipayRootCert.crt"); err != nil {
+		log.Error("加载支付宝根证书失败", "error", err)
+		return nil
+	}
+	if err := client.LoadAlipayCertPublicKeyFromFile("./cert/alipayPublicCert.crt"); err != nil {
+		log.Error("加载支付宝公钥证书失败", "error", err)
+		return nil
+	}
+
+	log.Info("支付宝客户端初始化成功")
+	return &alipayProvider{client: client, cfg: cfg}
+}
+
+// Name 返回支付渠道名称
+func (p *alipayProvider) Name() string {
+	return ProviderAlipay
+}
+
+// SellerID 返回收款支付宝用户号，未配置时不校验
+func (p *alipayProvider) SellerID() string {
+	return p.cfg.SellerID
+}
+
+// CreatePayment 创建手机网站支付，返回支付链接
+func (p *alipayProvider) CreatePayment(ctx context.Context, req *CreateRequest) (*CreateResult, error) {
+	var param = alipay.TradeWapPay{}
+	param.NotifyURL = p.cfg.NotifyURL
+	param.ReturnURL = p.cfg.ReturnURL
+	param.Subject = req.Subject
+	param.OutTradeNo = req.OutTradeNo
+	param.TotalAmount = formatYuan(req.Amount)
+	param.ProductCode = "QUICK_WAP_WAY"
+
+	payURL, err := p.client.TradeWapPay(param)
+	if err != nil {
+		return nil, err
+	}
+	return &CreateResult{PayURL: payURL.String()}, nil
+}
+
+// QueryPayment 查询交易状态
+func (p *alipayProvider) QueryPayment(ctx context.Context, outTradeNo string) (*TradeResult, error) {
+	var param = alipay.TradeQuery{}
+	param.OutTradeNo = outTradeNo
+
+	result, err := p.client.TradeQuery(ctx, param)
+	if err != nil {
+		var alipayErr *alipay.Error
+		if errors.As(err, &alipayErr) && alipayErr.SubCode == alipayTradeNotExist {
+			return nil, ErrTradeNotFound
+		}
+		return nil, err
+	}
+	if result.IsFailure() {
+		if result.SubCode == alipayTradeNotExist {
+			return nil, ErrTradeNotFound
+		}
+		return nil, result.Error
+	}
+
+	amount, err := parseYuan(result.TotalAmount)
+	if err != nil {
+		return nil, err
+	}
+	return &TradeResult{
+		OutTradeNo: result.OutTradeNo,
+		TradeNo:    result.TradeNo,
+		Status:     alipayTradeStatus(result.TradeStatus),
+		RawStatus:  string(result.TradeStatus),
+		Amount:     amount,
+		PaidAt:     parseAlipayTime(result.SendPayDate),
+	}, nil
+}
+
+// Refund 发起退款，支付宝退款接口同步返回结果
+// 支付宝业务处理失败时退款不会发生，其他错误无法确定退款结果，需要之后查询
+func (p *alipayProvider) Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error) {
+	var param = alipay.TradeRefund{}
+	param.OutTradeNo = req.OutTradeNo
+	param.OutRequestNo = req.OutRefundNo
+	param.RefundAmount = formatYuan(req.Amount)
+	param.RefundReason = req.Reason
+
+	result, err := p.client.TradeRefund(ctx, param)
+	if err != nil {
+		var alipayErr *alipay.Error
+		if errors.As(err, &alipayErr) && alipayErr.Code == alipay.CodeBusinessFailed {
+			return alipayRefundFailed(req, alipayErr), nil
+		}
+		return nil, err
+	}
+	if result.IsFailure() {
+		if result.Code == alipay.CodeBusinessFailed {
+			return alipayRefundFailed(req, &result.Error), nil
+		}
+		return nil, result.Error
+	}
+	return &RefundResult{
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    result.TradeNo,
+		Status:      RefundStatusSuccess,
+		RawStatus:   string(result.Code),
+		Amount:      req.Amount,
+	}, nil
+}
+
+// QueryRefund 查询退款，支付宝未返回退款状态表示退款未受理或退款失败
+func (p *alipayProvider) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*RefundResult, error) {
+	var param = alipay.TradeFastPayRefundQuery{}
+	param.OutTradeNo = outTradeNo
+	param.OutRequestNo = outRefundNo
+
+	result, err := p.client.TradeFastPayRefundQuery(ctx, param)
+	if err != nil {
+		var alipayErr *alipay.Error
+		if errors.As(err, &alipayErr) && alipayErr.SubCode == alipayTradeNotExist {
+			return nil, ErrRefundNotFound
+		}
+		return nil, err
+	}
+	if result.IsFailure() {
+		if result.SubCode == alipayTradeNotExist {
+			return nil, ErrRefundNotFound
+		}
+		return nil, result.Error
+	}
+
+	refund := &RefundResult{
+		OutRefundNo: outRefundNo,
+		RefundNo:    result.TradeNo,
+		Status:      RefundStatusFailed,
+		RawStatus:   result.RefundStatus,
+		Message:     "支付宝未受理退款",
+	}
+	if result.RefundStatus == alipayRefundSuccess {
+		refund.Status = RefundStatusSuccess
+		refund.Message = ""
+	}
+	if result.RefundAmount != "" {
+		if refund.Amount, err = parseYuan(result.RefundAmount); err != nil {
+			return nil, err
+		}
+	}
+	return refund, nil
+}
+
+// VerifyNotification 校验支付宝异步通知的签名并解析通知内容
+func (p *alipayProvider) VerifyNotification(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	notification, err := p.client.DecodeNotification(r.Form)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := parseYuan(notification.TotalAmount)
+	if err != nil {
+		return nil, err
+	}
+	return &Notification{
+		Provider:   ProviderAlipay,
+		OutTradeNo: notification.OutTradeNo,
+		TradeNo:    notification.TradeNo,
+		Status:     alipayTradeStatus(notification.TradeStatus),
+		RawStatus:  string(notification.TradeStatus),
+		Amount:     amount,
+		SellerID:   notification.SellerId,
+		PaidAt:     parseAlipayTime(notification.GmtPayment),
+		Raw:        r.Form.Encode(),
+	}, nil
+}
+
+// AckNotification 应答支付宝异步通知，处理失败时支付宝会重新发送通知
+func (p *alipayProvider) AckNotification(c *gin.Context, err error) {
+	if err != nil {
+		c.String(http.StatusInternalServerError, "fail")
+		return
+	}
+	c.String(http.StatusOK, "success")
+}
+
+// VerifyReturn 校验支付宝同步返回参数的签名
+func (p *alipayProvider) VerifyReturn(values url.Values) error {
+	return p.client.VerifySign(values)
+}
+
+// alipayTradeStatus 将支付宝交易状态转换为统一的交易状态
+func alipayTradeStatus(status alipay.TradeStatus) TradeStatus {
+	switch status {
+	case alipay.TradeStatusSuccess, alipay.TradeStatusFinished:
+		return TradeStatusSuccess
+	case alipay.TradeStatusClosed:
+		return TradeStatusClosed
+	default:
+		return TradeStatusPending
+	}
+}
+
+// alipayRefundFailed 返回支付宝拒绝退款的结果
+func alipayRefundFailed(req *RefundRequest, alipayErr *alipay.Error) *RefundResult {
+	return &RefundResult{
+		OutRefundNo: req.OutRefundNo,
+		Status:      RefundStatusFailed,
+		RawStatus:   alipayErr.SubCode,
+		Amount:      req.Amount,
+		Message:     alipayErr.SubMsg,
+	}
+}
+
+// parseAlipayTime 解析支付宝返回的时间，解析失败时返回零值
+func parseAlipayTime(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
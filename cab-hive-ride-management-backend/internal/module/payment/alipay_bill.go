@@ -0,0 +1,178 @@
+package payment
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cab-hive/internal/global/httpclient"
+
+	"github.com/pkg/errors"
+	"github.com/smartwalle/alipay/v3"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 支付宝业务明细账单的列名
+const (
+	alipayBillTradeNo     = "支付宝交易号"
+	alipayBillOutTradeNo  = "商户订单号"
+	alipayBillType        = "业务类型"
+	alipayBillFinishedAt  = "完成时间"
+	alipayBillAmount      = "订单金额（元）"
+	alipayBillOutRefundNo = "退款批次号/请求号"
+)
+
+// errAlipayBillHeader 账单中没有业务明细的表头
+var errAlipayBillHeader = errors.New("不是支付宝业务明细账单")
+
+// DownloadBill 查询支付宝交易账单的下载地址并下载账单压缩包
+// 支付宝一般在次日上午生成前一天的账单，账单未生成时返回错误
+func (p *alipayProvider) DownloadBill(ctx context.Context, billDate time.Time) ([]byte, error) {
+	var param = alipay.BillDownloadURLQuery{}
+	param.BillType = "trade"
+	param.BillDate = billDate.Format("2006-01-02")
+
+	result, err := p.client.BillDownloadURLQuery(ctx, param)
+	if err != nil {
+		return nil, err
+	}
+	if result.IsFailure() {
+		return nil, result.Error
+	}
+
+	resp, err := httpclient.Client.R().SetContext(ctx).Get(result.BillDownloadURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "下载支付宝账单失败")
+	}
+	if resp.StatusCode() != http.StatusOK {
+		return nil, errors.Errorf("下载支付宝账单失败: %d", resp.StatusCode())
+	}
+	return resp.Body(), nil
+}
+
+// ParseBill 解析支付宝交易账单，支持下载的压缩包和解压后的业务明细CSV文件
+// 压缩包中同时包含业务明细和汇总两个文件，只解析业务明细
+func (p *alipayProvider) ParseBill(data []byte) ([]BillRecord, error) {
+	if !bytes.HasPrefix(data, []byte("PK")) {
+		return parseAlipayBillCSV(data)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "解析支付宝账单压缩包失败")
+	}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		content, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		records, err := parseAlipayBillCSV(content)
+		if errors.Is(err, errAlipayBillHeader) {
+			continue
+		}
+		return records, err
+	}
+	return nil, errAlipayBillHeader
+}
+
+// parseAlipayBillCSV 解析支付宝业务明细CSV，账单为GBK编码，已是UTF-8编码时直接解析
+// 以 # 开头的行为账单说明和合计，业务类型为“交易”和“退款”以外的记录不参与对账
+func parseAlipayBillCSV(data []byte) ([]BillRecord, error) {
+	if !utf8.Valid(data) {
+		decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(data)
+		if err != nil {
+			return nil, errors.Wrap(err, "转换支付宝账单编码失败")
+		}
+		data = decoded
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var header map[string]int
+	var records []BillRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "解析支付宝账单失败")
+		}
+		for i := range row {
+			row[i] = strings.TrimSpace(row[i])
+		}
+
+		if header == nil {
+			header = alipayBillHeader(row)
+			continue
+		}
+
+		column := func(name string) string {
+			if i, ok := header[name]; ok && i < len(row) {
+				return row[i]
+			}
+			return ""
+		}
+
+		record := BillRecord{
+			TradeNo:    column(alipayBillTradeNo),
+			OutTradeNo: column(alipayBillOutTradeNo),
+			FinishedAt: parseAlipayTime(column(alipayBillFinishedAt)),
+		}
+		switch column(alipayBillType) {
+		case "交易":
+			record.Category = BillCategoryTrade
+		case "退款":
+			// 退款记录的订单金额为负数，退款请求号即商户退款单号
+			record.Category = BillCategoryRefund
+			record.OutRefundNo = column(alipayBillOutRefundNo)
+		default:
+			continue
+		}
+
+		amount, err := parseYuan(column(alipayBillAmount))
+		if err != nil {
+			return nil, err
+		}
+		if amount < 0 {
+			amount = -amount
+		}
+		record.Amount = amount
+		records = append(records, record)
+	}
+
+	if header == nil {
+		return nil, errAlipayBillHeader
+	}
+	return records, nil
+}
+
+// alipayBillHeader 识别业务明细的表头行，返回列名到列序号的映射，不是表头时返回 nil
+func alipayBillHeader(row []string) map[string]int {
+	header := make(map[string]int, len(row))
+	for i, name := range row {
+		header[name] = i
+	}
+	for _, name := range []string{alipayBillTradeNo, alipayBillOutTradeNo, alipayBillType, alipayBillAmount} {
+		if _, ok := header[name]; !ok {
+			return nil
+		}
+	}
+	return header
+}
@@ -0,0 +1,33 @@
+package payment
+
+import (
+	"context"
+	"time"
+)
+
+// BillCategory 账单记录的业务类型
+type BillCategory string
+
+const (
+	BillCategoryTrade  BillCategory = "trade"  // 支付交易
+	BillCategoryRefund BillCategory = "refund" // 退款
+)
+
+// BillRecord 账单中的一笔交易或退款
+type BillRecord struct {
+	Category    BillCategory // 业务类型
+	TradeNo     string       // 支付渠道交易号
+	OutTradeNo  string       // 商户订单号
+	OutRefundNo string       // 商户退款单号，退款记录才有
+	Amount      int64        // 交易或退款金额（分），均为正数
+	FinishedAt  time.Time    // 完成时间，账单中没有时为零值
+}
+
+// BillProvider 支持下载对账单的支付渠道
+// 账单内容按支付渠道的格式解析，管理员上传的账单文件也使用相同的格式
+type BillProvider interface {
+	// DownloadBill 下载指定日期的交易账单原文
+	DownloadBill(ctx context.Context, billDate time.Time) ([]byte, error)
+	// ParseBill 解析账单原文中的交易和退款记录
+	ParseBill(data []byte) ([]BillRecord, error)
+}
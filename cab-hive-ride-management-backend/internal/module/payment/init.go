@@ -0,0 +1,61 @@
+package payment
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/logger"
+	"log/slog"
+)
+
+var log *slog.Logger
+
+type ModulePayment struct{}
+
+func (p *ModulePayment) GetName() string {
+	return "Payment"
+}
+
+func (p *ModulePayment) Init() {
+	log = logger.New("Payment")
+
+	// 初始化已配置的支付渠道
+	initProviders()
+
+	// 启动处理中退款的结果查询
+	go queryPendingRefunds()
+
+	// 启动每日自动对账
+	go reconcileDaily()
+
+	// 启动未付款订单的付款提醒和欠费标记
+	go remindUnpaidOrders()
+}
+
+// initProviders 初始化已配置的支付渠道，配置不完整的渠道不注册
+func initProviders() {
+	if provider := newAlipayProvider(); provider != nil {
+		registerProvider(provider)
+	}
+	if provider := newWeChatProvider(); provider != nil {
+		registerProvider(provider)
+	}
+	if provider := newMockProvider(); provider != nil {
+		registerProvider(provider)
+	}
+
+	if _, ok := providers[defaultProvider()]; !ok {
+		log.Warn("默认支付渠道未启用", "provider", defaultProvider())
+	}
+}
+
+// defaultProvider 返回默认支付渠道名称
+func defaultProvider() string {
+	if name := config.Get().Payment.DefaultProvider; name != "" {
+		return name
+	}
+	return ProviderAlipay
+}
+
+func selfInit() {
+	p := &ModulePayment{}
+	p.Init()
+}
@@ -0,0 +1,262 @@
+package payment
+
+import (
+	"cab-hive/config"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// mockSellerID 模拟支付的收款方标识
+const mockSellerID = "mock_seller"
+
+// mockProvider 本地模拟支付，交易保存在内存中，不访问网络
+// 交易号和退款单号由商户单号推导，相同的输入总是得到相同的结果，便于测试和本地开发
+type mockProvider struct {
+	secret  string
+	mu      sync.Mutex
+	trades  map[string]*mockTrade
+	refunds map[string]*RefundResult
+}
+
+// mockTrade 模拟支付的交易
+type mockTrade struct {
+	Amount   int64
+	Status   TradeStatus
+	PaidAt   time.Time
+	Refunded int64
+}
+
+// mockNotification 模拟支付通知的内容
+type mockNotification struct {
+	OutTradeNo string `json:"out_trade_no"`
+	TradeNo    string `json:"trade_no"`
+	Amount     int64  `json:"amount"`
+	Status     string `json:"status"`
+	PaidAt     int64  `json:"paid_at"`
+	Sign       string `json:"sign"`
+}
+
+// newMockProvider 创建模拟支付，未启用时返回 nil
+func newMockProvider() *mockProvider {
+	cfg := config.Get().Payment.Mock
+	if !cfg.Enabled {
+		return nil
+	}
+	log.Warn("已启用模拟支付，生产环境请关闭")
+	return &mockProvider{secret: cfg.Secret, trades: map[string]*mockTrade{}, refunds: map[string]*RefundResult{}}
+}
+
+// Name 返回支付渠道名称
+func (p *mockProvider) Name() string {
+	return ProviderMock
+}
+
+// SellerID 返回模拟支付的收款方标识
+func (p *mockProvider) SellerID() string {
+	return mockSellerID
+}
+
+// CreatePayment 创建模拟交易，返回模拟的支付链接
+// 重复创建同一商户订单号的交易时更新金额，已支付的交易保持不变
+func (p *mockProvider) CreatePayment(ctx context.Context, req *CreateRequest) (*CreateResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trade, ok := p.trades[req.OutTradeNo]
+	if !ok {
+		trade = &mockTrade{Status: TradeStatusPending}
+		p.trades[req.OutTradeNo] = trade
+	}
+	if trade.Status == TradeStatusPending {
+		trade.Amount = req.Amount
+	}
+	return &CreateResult{PayURL: fmt.Sprintf("mock://pay?out_trade_no=%s&amount=%d", url.QueryEscape(req.OutTradeNo), req.Amount)}, nil
+}
+
+// QueryPayment 查询模拟交易
+func (p *mockProvider) QueryPayment(ctx context.Context, outTradeNo string) (*TradeResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trade, ok := p.trades[outTradeNo]
+	if !ok {
+		return nil, ErrTradeNotFound
+	}
+	return &TradeResult{
+		OutTradeNo: outTradeNo,
+		TradeNo:    mockTradeNo(outTradeNo),
+		Status:     trade.Status,
+		RawStatus:  string(trade.Status),
+		Amount:     trade.Amount,
+		PaidAt:     trade.PaidAt,
+	}, nil
+}
+
+// Refund 对模拟交易退款，退款立即成功，不满足退款条件时退款失败
+// 重复提交同一商户退款单号时返回原退款结果
+func (p *mockProvider) Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if refund, ok := p.refunds[req.OutRefundNo]; ok {
+		return refund, nil
+	}
+
+	refund := &RefundResult{
+		OutRefundNo: req.OutRefundNo,
+		RefundNo:    "MOCKR" + req.OutRefundNo,
+		Status:      RefundStatusFailed,
+		RawStatus:   string(RefundStatusFailed),
+		Amount:      req.Amount,
+	}
+	trade, ok := p.trades[req.OutTradeNo]
+	switch {
+	case !ok:
+		refund.Message = ErrTradeNotFound.Error()
+	case trade.Status != TradeStatusSuccess && trade.Status != TradeStatusRefunded:
+		refund.Message = "交易未支付，不能退款"
+	case req.Amount <= 0 || trade.Refunded+req.Amount > trade.Amount:
+		refund.Message = "退款金额超过可退金额"
+	default:
+		trade.Refunded += req.Amount
+		trade.Status = TradeStatusRefunded
+		refund.Status = RefundStatusSuccess
+		refund.RawStatus = string(RefundStatusSuccess)
+	}
+	p.refunds[req.OutRefundNo] = refund
+	return refund, nil
+}
+
+// QueryRefund 查询模拟退款
+func (p *mockProvider) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	refund, ok := p.refunds[outRefundNo]
+	if !ok {
+		return nil, ErrRefundNotFound
+	}
+	return refund, nil
+}
+
+// VerifyNotification 校验模拟支付通知的签名，通知内容为带签名的JSON
+func (p *mockProvider) VerifyNotification(r *http.Request) (*Notification, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var notification mockNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, errors.Wrap(err, "解析模拟支付通知失败")
+	}
+	if !hmac.Equal([]byte(notification.Sign), []byte(p.sign(&notification))) {
+		return nil, errors.New("模拟支付通知签名错误")
+	}
+
+	// 通知为支付成功时同步更新内存中的交易
+	status := TradeStatus(notification.Status)
+	paidAt := time.Unix(notification.PaidAt, 0)
+	if status == TradeStatusSuccess {
+		p.markPaid(notification.OutTradeNo, notification.Amount, paidAt)
+	}
+	return &Notification{
+		Provider:   ProviderMock,
+		OutTradeNo: notification.OutTradeNo,
+		TradeNo:    notification.TradeNo,
+		Status:     status,
+		RawStatus:  notification.Status,
+		Amount:     notification.Amount,
+		SellerID:   mockSellerID,
+		PaidAt:     paidAt,
+		Raw:        string(body),
+	}, nil
+}
+
+// AckNotification 应答模拟支付通知
+func (p *mockProvider) AckNotification(c *gin.Context, err error) {
+	if err != nil {
+		c.String(http.StatusInternalServerError, "fail")
+		return
+	}
+	c.String(http.StatusOK, "success")
+}
+
+// Pay 模拟用户完成支付，返回与支付平台通知相同格式的支付结果
+func (p *mockProvider) Pay(outTradeNo string) (*Notification, error) {
+	p.mu.Lock()
+	trade, ok := p.trades[outTradeNo]
+	p.mu.Unlock()
+	if !ok {
+		return nil, ErrTradeNotFound
+	}
+
+	paidAt := time.Now().Truncate(time.Second)
+	p.markPaid(outTradeNo, trade.Amount, paidAt)
+
+	notification := &mockNotification{
+		OutTradeNo: outTradeNo,
+		TradeNo:    mockTradeNo(outTradeNo),
+		Amount:     trade.Amount,
+		Status:     string(TradeStatusSuccess),
+		PaidAt:     paidAt.Unix(),
+	}
+	notification.Sign = p.sign(notification)
+	raw, err := json.Marshal(notification)
+	if err != nil {
+		return nil, err
+	}
+	return &Notification{
+		Provider:   ProviderMock,
+		OutTradeNo: outTradeNo,
+		TradeNo:    notification.TradeNo,
+		Status:     TradeStatusSuccess,
+		RawStatus:  notification.Status,
+		Amount:     trade.Amount,
+		SellerID:   mockSellerID,
+		PaidAt:     paidAt,
+		Raw:        string(raw),
+	}, nil
+}
+
+// markPaid 将模拟交易标记为已支付，交易不存在时创建
+func (p *mockProvider) markPaid(outTradeNo string, amount int64, paidAt time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	trade, ok := p.trades[outTradeNo]
+	if !ok {
+		trade = &mockTrade{Amount: amount}
+		p.trades[outTradeNo] = trade
+	}
+	if trade.Status == TradeStatusPending || trade.Status == "" {
+		trade.Status = TradeStatusSuccess
+		trade.PaidAt = paidAt
+	}
+}
+
+// sign 计算模拟支付通知的 HMAC-SHA256 签名
+func (p *mockProvider) sign(notification *mockNotification) string {
+	message := fmt.Sprintf("amount=%d&out_trade_no=%s&paid_at=%d&status=%s&trade_no=%s",
+		notification.Amount, notification.OutTradeNo, notification.PaidAt, notification.Status, notification.TradeNo)
+	mac := hmac.New(sha256.New, []byte(p.secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// mockTradeNo 由商户订单号推导模拟交易号
+func mockTradeNo(outTradeNo string) string {
+	return "MOCK" + outTradeNo
+}
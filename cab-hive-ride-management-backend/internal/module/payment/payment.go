@@ -0,0 +1,316 @@
+package payment
+
+import (
+	"fmt"
+	"net/http"
+
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// providerTitle 支付渠道的中文名称，用于订单事件记录
+var providerTitle = map[string]string{
+	ProviderAlipay: "支付宝",
+	ProviderWeChat: "微信支付",
+	ProviderMock:   "模拟支付",
+}
+
+// CreatePaymentRequest 创建支付请求结构体
+// 支付金额以服务端计算的订单费用为准，不接受客户端传入
+type CreatePaymentRequest struct {
+	OrderID  string `json:"order_id" binding:"required"`
+	Subject  string `json:"subject"`
+	Provider string `json:"provider"` // 支付渠道: alipay, wechat, mock，为空时使用默认渠道
+}
+
+// CreatePaymentResponse 创建支付响应结构体
+type CreatePaymentResponse struct {
+	Provider string `json:"provider"`
+	CreateResult
+}
+
+// QueryPaymentRequest 查询支付状态请求结构体
+type QueryPaymentRequest struct {
+	OrderID  string `json:"order_id" binding:"required"`
+	Provider string `json:"provider"`
+}
+
+// QueryPaymentResponse 查询支付状态响应结构体
+type QueryPaymentResponse struct {
+	Provider    string      `json:"provider"`
+	Status      TradeStatus `json:"status"`       // 统一的交易状态: pending, success, closed, refunded, failed
+	TradeStatus string      `json:"trade_status"` // 支付渠道原始交易状态
+	TradeNo     string      `json:"trade_no"`
+	Amount      float64     `json:"amount"`
+}
+
+// MockPayRequest 模拟完成支付请求结构体
+type MockPayRequest struct {
+	OrderID string `json:"order_id" binding:"required"`
+}
+
+// findOrder 根据商户订单号查找订单
+func findOrder(orderID string) (*model.Order, error) {
+	// 从ID中提取数字部分
+	var orderIDNum uint
+	fmt.Sscanf(orderID, "%d", &orderIDNum)
+
+	var orderModel model.Order
+	if err := database.DB.Where("id = ?", orderIDNum).First(&orderModel).Error; err != nil {
+		return nil, err
+	}
+
+	return &orderModel, nil
+}
+
+// outTradeNo 返回订单在支付渠道中的商户订单号
+func outTradeNo(orderModel *model.Order) string {
+	return fmt.Sprintf("%d", orderModel.ID)
+}
+
+// CreatePayment 创建支付订单
+func CreatePayment(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	var req CreatePaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	provider, err := GetProvider(req.Provider)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips(err.Error()))
+		return
+	}
+
+	// 查找订单，只有乘客自己结束待付款的订单才能发起支付
+	orderModel, err := findOrder(req.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if orderModel.UserOpenID != payload.OpenID {
+		response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		return
+	}
+	if orderModel.Status != model.OrderStatusWaitingForPayment {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单不是待付款状态，无法支付"))
+		return
+	}
+	if orderModel.Fare <= 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单费用异常，无法支付"))
+		return
+	}
+
+	subject := req.Subject
+	if subject == "" {
+		subject = fmt.Sprintf("订单-%d", orderModel.ID)
+	}
+
+	// 记录支付交易，支付通知按交易校验金额
+	transaction, err := prepareTransaction(orderModel, provider.Name())
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 金额取自订单费用
+	result, err := provider.CreatePayment(c.Request.Context(), &CreateRequest{
+		OutTradeNo: transaction.OutTradeNo,
+		Subject:    subject,
+		Amount:     YuanToFen(transaction.Amount),
+		PayerID:    payload.OpenID,
+		ClientIP:   c.ClientIP(),
+	})
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	log.Info("创建支付订单", "order_id", orderModel.ID, "transaction_id", transaction.ID, "provider", provider.Name(), "fare", transaction.Amount)
+	response.Success(c, CreatePaymentResponse{
+		Provider:     provider.Name(),
+		CreateResult: *result,
+	})
+}
+
+// QueryPayment 查询订单支付状态
+func QueryPayment(c *gin.Context) {
+	var req QueryPaymentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 未指定支付渠道时查询订单最近一次发起支付的渠道
+	name := req.Provider
+	if name == "" {
+		var transaction model.PaymentTransaction
+		err := database.DB.Where("out_trade_no = ?", req.OrderID).Order("id DESC").First(&transaction).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+			return
+		}
+		name = transaction.Provider
+	}
+
+	provider, err := GetProvider(name)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips(err.Error()))
+		return
+	}
+
+	result, err := provider.QueryPayment(c.Request.Context(), req.OrderID)
+	if err != nil {
+		if errors.Is(err, ErrTradeNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("支付交易不存在"))
+		} else {
+			response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		}
+		return
+	}
+
+	response.Success(c, QueryPaymentResponse{
+		Provider:    provider.Name(),
+		Status:      result.Status,
+		TradeStatus: result.RawStatus,
+		TradeNo:     result.TradeNo,
+		Amount:      FenToYuan(result.Amount),
+	})
+}
+
+// NotifyHandler 支付平台异步通知处理
+// 路径中未指定支付渠道时按支付宝处理，兼容已配置的支付宝通知地址
+func NotifyHandler(c *gin.Context) {
+	name := c.Param("provider")
+	if name == "" {
+		name = ProviderAlipay
+	}
+	provider, err := GetProvider(name)
+	if err != nil {
+		log.Error("收到未启用支付渠道的通知", "provider", name)
+		c.String(http.StatusNotFound, "fail")
+		return
+	}
+
+	notification, err := provider.VerifyNotification(c.Request)
+	if err != nil {
+		log.Error("支付通知校验失败", "error", err, "provider", name)
+		provider.AckNotification(c, err)
+		return
+	}
+
+	provider.AckNotification(c, applyNotification(provider, notification))
+}
+
+// ReturnHandler 支付宝同步返回处理
+func ReturnHandler(c *gin.Context) {
+	provider, err := GetProvider(ProviderAlipay)
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithTips("支付宝客户端未初始化"))
+		return
+	}
+
+	// 验证签名
+	if err := provider.(*alipayProvider).VerifyReturn(c.Request.URL.Query()); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("支付验证失败"))
+		return
+	}
+
+	// 获取订单ID
+	orderID := c.Request.URL.Query().Get("out_trade_no")
+
+	// 返回成功页面
+	c.HTML(http.StatusOK, "payment_success.html", gin.H{
+		"order_id": orderID,
+		"trade_no": c.Request.URL.Query().Get("trade_no"),
+	})
+}
+
+// MockPay 模拟乘客完成支付，仅在启用模拟支付时注册
+// 与支付平台通知走相同的处理流程，便于本地开发时跑通支付
+func MockPay(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	var req MockPayRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	provider, err := GetProvider(ProviderMock)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips(err.Error()))
+		return
+	}
+
+	// 只有下单的乘客可以支付自己的订单
+	orderModel, err := findOrder(req.OrderID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if orderModel.UserOpenID != payload.OpenID {
+		response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		return
+	}
+
+	notification, err := provider.(*mockProvider).Pay(outTradeNo(orderModel))
+	if err != nil {
+		if errors.Is(err, ErrTradeNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("支付交易不存在，请先创建支付"))
+		} else {
+			response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		}
+		return
+	}
+	if err := applyNotification(provider, notification); err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	response.Success(c, QueryPaymentResponse{
+		Provider:    ProviderMock,
+		Status:      notification.Status,
+		TradeStatus: notification.RawStatus,
+		TradeNo:     notification.TradeNo,
+		Amount:      FenToYuan(notification.Amount),
+	})
+}
@@ -0,0 +1,191 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// 支付渠道名称
+const (
+	ProviderAlipay = "alipay" // 支付宝手机网站支付
+	ProviderWeChat = "wechat" // 微信支付小程序JSAPI支付
+	ProviderMock   = "mock"   // 本地模拟支付，不访问网络，用于测试和本地开发
+)
+
+// TradeStatus 与支付渠道无关的交易状态
+type TradeStatus string
+
+const (
+	TradeStatusPending  TradeStatus = "pending"  // 等待付款
+	TradeStatusSuccess  TradeStatus = "success"  // 支付成功
+	TradeStatusClosed   TradeStatus = "closed"   // 未付款关闭或已撤销
+	TradeStatusRefunded TradeStatus = "refunded" // 支付后已发生退款
+	TradeStatusFailed   TradeStatus = "failed"   // 支付失败
+)
+
+// RefundStatus 与支付渠道无关的退款状态
+type RefundStatus string
+
+const (
+	RefundStatusPending RefundStatus = "pending" // 退款处理中
+	RefundStatusSuccess RefundStatus = "success" // 退款成功
+	RefundStatusFailed  RefundStatus = "failed"  // 退款失败或已关闭
+)
+
+// ErrTradeNotFound 支付渠道中不存在该交易
+var ErrTradeNotFound = errors.New("交易不存在")
+
+// ErrRefundNotFound 支付渠道中不存在该退款
+var ErrRefundNotFound = errors.New("退款不存在")
+
+// PaymentProvider 支付渠道接口
+// 每个支付渠道负责与第三方支付平台交互，金额统一以分为单位，交易状态统一转换为 TradeStatus
+type PaymentProvider interface {
+	// Name 返回支付渠道名称
+	Name() string
+	// SellerID 返回本商户在支付渠道的收款方标识，用于校验支付通知，为空时不校验
+	SellerID() string
+	// CreatePayment 创建支付交易，返回客户端拉起支付所需的内容
+	CreatePayment(ctx context.Context, req *CreateRequest) (*CreateResult, error)
+	// QueryPayment 按商户订单号查询交易，交易不存在时返回 ErrTradeNotFound
+	QueryPayment(ctx context.Context, outTradeNo string) (*TradeResult, error)
+	// Refund 对已支付的交易发起全额或部分退款
+	// 支付渠道拒绝退款时返回状态为 failed 的结果，无法确定退款结果时返回错误，之后按商户退款单号查询
+	Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error)
+	// QueryRefund 按商户退款单号查询退款，退款不存在时返回 ErrRefundNotFound
+	QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*RefundResult, error)
+	// VerifyNotification 校验支付平台异步通知的签名并解析通知内容
+	VerifyNotification(r *http.Request) (*Notification, error)
+	// AckNotification 按支付平台要求的格式应答异步通知，err 为空表示处理成功
+	AckNotification(c *gin.Context, err error)
+}
+
+// CreateRequest 创建支付交易的参数
+type CreateRequest struct {
+	OutTradeNo string // 商户订单号
+	Subject    string // 商品描述
+	Amount     int64  // 支付金额（分）
+	PayerID    string // 付款用户在支付渠道的标识，微信JSAPI支付为小程序OpenID
+	ClientIP   string // 付款用户的IP地址
+}
+
+// CreateResult 创建支付交易的结果
+type CreateResult struct {
+	PayURL    string            `json:"pay_url,omitempty"`    // 支付链接，支付宝手机网站支付和模拟支付返回
+	PayParams map[string]string `json:"pay_params,omitempty"` // 小程序调起支付的参数，微信JSAPI支付返回
+}
+
+// TradeResult 查询交易的结果
+type TradeResult struct {
+	OutTradeNo string      // 商户订单号
+	TradeNo    string      // 支付渠道交易号
+	Status     TradeStatus // 交易状态
+	RawStatus  string      // 支付渠道原始交易状态
+	Amount     int64       // 订单金额（分）
+	PaidAt     time.Time   // 支付时间，未支付时为零值
+}
+
+// RefundRequest 发起退款的参数
+type RefundRequest struct {
+	OutTradeNo  string // 原交易的商户订单号
+	OutRefundNo string // 商户退款单号，同一笔交易多次退款时需要唯一
+	Amount      int64  // 退款金额（分）
+	TotalAmount int64  // 原交易金额（分）
+	Reason      string // 退款原因
+}
+
+// RefundResult 发起退款的结果
+type RefundResult struct {
+	OutRefundNo string       // 商户退款单号
+	RefundNo    string       // 支付渠道退款单号
+	Status      RefundStatus // 退款状态
+	RawStatus   string       // 支付渠道原始退款状态
+	Amount      int64        // 退款金额（分）
+	Message     string       // 退款失败原因
+}
+
+// Notification 校验通过的支付结果通知
+type Notification struct {
+	Provider   string      // 支付渠道名称
+	OutTradeNo string      // 商户订单号
+	TradeNo    string      // 支付渠道交易号
+	Status     TradeStatus // 交易状态
+	RawStatus  string      // 支付渠道原始交易状态
+	Amount     int64       // 订单金额（分）
+	SellerID   string      // 收款方标识，支付宝为卖家用户号，微信支付为商户号
+	PaidAt     time.Time   // 支付时间，通知中没有时为零值
+	Raw        string      // 通知原文，微信支付为解密后的内容
+}
+
+// providers 已初始化的支付渠道
+var providers = map[string]PaymentProvider{}
+
+// registerProvider 注册支付渠道
+func registerProvider(provider PaymentProvider) {
+	providers[provider.Name()] = provider
+	log.Info("注册支付渠道", "provider", provider.Name())
+}
+
+// GetProvider 按名称获取支付渠道，名称为空时返回默认支付渠道
+func GetProvider(name string) (PaymentProvider, error) {
+	if name == "" {
+		name = defaultProvider()
+	}
+	provider, ok := providers[name]
+	if !ok {
+		return nil, errors.Errorf("支付渠道 %s 未启用", name)
+	}
+	return provider, nil
+}
+
+// YuanToFen 将以元为单位的金额转换为分
+func YuanToFen(yuan float64) int64 {
+	return int64(math.Round(yuan * 100))
+}
+
+// FenToYuan 将以分为单位的金额转换为元
+func FenToYuan(fen int64) float64 {
+	return float64(fen) / 100
+}
+
+// formatYuan 将以分为单位的金额格式化为保留两位小数的元，例如 1234 格式化为 12.34
+func formatYuan(fen int64) string {
+	sign := ""
+	if fen < 0 {
+		sign = "-"
+		fen = -fen
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, fen/100, fen%100)
+}
+
+// parseYuan 将以元为单位的金额字符串解析为分，最多支持两位小数，支持负数
+func parseYuan(yuan string) (int64, error) {
+	yuan = strings.TrimSpace(yuan)
+	if strings.HasPrefix(yuan, "-") {
+		fen, err := parseYuan(yuan[1:])
+		return -fen, err
+	}
+	integer, fraction, _ := strings.Cut(yuan, ".")
+	if len(fraction) > 2 {
+		return 0, errors.Errorf("金额格式错误: %s", yuan)
+	}
+	fraction += strings.Repeat("0", 2-len(fraction))
+
+	yuanPart, err := strconv.ParseInt(integer, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "金额格式错误: %s", yuan)
+	}
+	fenPart, err := strconv.ParseInt(fraction, 10, 64)
+	if err != nil {
+		return 0, errors.Wrapf(err, "金额格式错误: %s", yuan)
+	}
+	return yuanPart*100 + fenPart, nil
+}
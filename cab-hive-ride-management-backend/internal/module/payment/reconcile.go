@@ -0,0 +1,817 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reconcileLockKeyPrefix 自动对账锁前缀，按支付渠道和账单日期加锁，保证多实例部署时同一账单只自动对账一次
+const reconcileLockKeyPrefix = "payment:reconcile:"
+
+// 对账默认配置
+const (
+	defaultReconcileTime = "10:00"      // 每天自动对账的时间
+	billDateLayout       = "2006-01-02" // 账单日期格式
+)
+
+// RunReconciliationRequest 手动对账请求结构体，可以上传账单文件代替从支付渠道下载
+type RunReconciliationRequest struct {
+	Provider string `form:"provider" json:"provider"`                      // 支付渠道，为空时使用默认渠道
+	BillDate string `form:"bill_date" json:"bill_date" binding:"required"` // 账单日期，格式为 2006-01-02
+}
+
+// ReconciliationResponse 对账结果响应结构体
+type ReconciliationResponse struct {
+	ID                uint    `json:"id"`
+	Provider          string  `json:"provider"`
+	BillDate          string  `json:"bill_date"`
+	Source            string  `json:"source"` // 账单来源: download, upload
+	Status            string  `json:"status"` // 对账状态: completed, failed
+	BillTradeCount    int     `json:"bill_trade_count"`
+	BillTradeAmount   float64 `json:"bill_trade_amount"`
+	BillRefundCount   int     `json:"bill_refund_count"`
+	BillRefundAmount  float64 `json:"bill_refund_amount"`
+	LocalTradeCount   int     `json:"local_trade_count"`
+	LocalTradeAmount  float64 `json:"local_trade_amount"`
+	LocalRefundCount  int     `json:"local_refund_count"`
+	LocalRefundAmount float64 `json:"local_refund_amount"`
+	MatchedCount      int     `json:"matched_count"`
+	DiscrepancyCount  int     `json:"discrepancy_count"`
+	OpenCount         int64   `json:"open_count"` // 待处理的差异数
+	ErrorMessage      string  `json:"error_message"`
+	OperatorID        string  `json:"operator_id"`
+	UpdateTime        string  `json:"update_time"`
+}
+
+// ReconciliationListResponse 对账结果列表响应结构体
+type ReconciliationListResponse struct {
+	Reconciliations []ReconciliationResponse `json:"reconciliations"`
+	Pagination      order.Pagination         `json:"pagination"`
+}
+
+// DiscrepancyResponse 对账差异响应结构体
+type DiscrepancyResponse struct {
+	ID               uint    `json:"id"`
+	ReconciliationID uint    `json:"reconciliation_id"`
+	Provider         string  `json:"provider"`
+	BillDate         string  `json:"bill_date"`
+	Type             string  `json:"type"`     // 差异类型: missing_local, missing_remote, amount_mismatch
+	Category         string  `json:"category"` // 业务类型: trade, refund
+	OrderID          uint    `json:"order_id"`
+	OutTradeNo       string  `json:"out_trade_no"`
+	TradeNo          string  `json:"trade_no"`
+	OutRefundNo      string  `json:"out_refund_no"`
+	BillAmount       float64 `json:"bill_amount"`
+	LocalAmount      float64 `json:"local_amount"`
+	OrderFare        float64 `json:"order_fare"`
+	Detail           string  `json:"detail"`
+	Status           string  `json:"status"` // 处理状态: open, resolved
+	ResolvedBy       string  `json:"resolved_by"`
+	ResolvedAt       *string `json:"resolved_at"`
+	Resolution       string  `json:"resolution"`
+	CreateTime       string  `json:"create_time"`
+}
+
+// DiscrepancyListResponse 对账差异列表响应结构体
+type DiscrepancyListResponse struct {
+	Discrepancies []DiscrepancyResponse `json:"discrepancies"`
+	Pagination    order.Pagination      `json:"pagination"`
+}
+
+// ResolveDiscrepancyRequest 处理对账差异请求结构体
+type ResolveDiscrepancyRequest struct {
+	Resolution string `json:"resolution" binding:"required"` // 处理说明
+}
+
+// RunReconciliation 管理员手动对账指定日期的账单
+// 请求中带有账单文件时解析上传的文件，否则从支付渠道下载账单
+func RunReconciliation(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	var req RunReconciliationRequest
+	if err := c.ShouldBind(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+	billDate, err := time.ParseInLocation(billDateLayout, req.BillDate, time.Local)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("账单日期格式错误"))
+		return
+	}
+	if !billDate.Before(startOfDay(time.Now())) {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("只能对账今天之前的账单"))
+		return
+	}
+
+	provider, err := GetProvider(req.Provider)
+	if err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips(err.Error()))
+		return
+	}
+	billProvider, ok := provider.(BillProvider)
+	if !ok {
+		response.Fail(c, response.ErrInvalidRequest.WithTips(fmt.Sprintf("支付渠道 %s 不支持对账", provider.Name())))
+		return
+	}
+
+	// 读取上传的账单文件
+	var data []byte
+	source := model.BillSourceDownload
+	if fileHeader, err := c.FormFile("file"); err == nil {
+		file, err := fileHeader.Open()
+		if err != nil {
+			response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+			return
+		}
+		data, err = io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+			return
+		}
+		source = model.BillSourceUpload
+	}
+
+	reconciliation, err := reconcile(c.Request.Context(), provider.Name(), billProvider, billDate, data, source, payload.OpenID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	log.Info("管理员手动对账", "provider", provider.Name(), "bill_date", req.BillDate, "source", source, "discrepancy_count", reconciliation.DiscrepancyCount, "admin_open_id", payload.OpenID)
+	resp, err := newReconciliationResponses([]model.Reconciliation{*reconciliation})
+	if err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+	response.Success(c, resp[0])
+}
+
+// GetReconciliations 管理员查询对账结果列表
+func GetReconciliations(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.Reconciliation{})
+	if provider := c.Query("provider"); provider != "" {
+		query = query.Where("provider = ?", provider)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	var reconciliations []model.Reconciliation
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("bill_date DESC, provider ASC").Find(&reconciliations).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	list, err := newReconciliationResponses(reconciliations)
+	if err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, ReconciliationListResponse{
+		Reconciliations: list,
+		Pagination: order.Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	})
+}
+
+// GetDiscrepancies 管理员查询对账差异列表
+func GetDiscrepancies(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.ReconciliationDiscrepancy{})
+	if reconciliationID := c.Query("reconciliation_id"); reconciliationID != "" {
+		query = query.Where("reconciliation_id = ?", reconciliationID)
+	}
+	if billDate := c.Query("bill_date"); billDate != "" {
+		query = query.Where("bill_date = ?", billDate)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if discrepancyType := c.Query("type"); discrepancyType != "" {
+		query = query.Where("type = ?", discrepancyType)
+	}
+
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	var discrepancies []model.ReconciliationDiscrepancy
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("id DESC").Find(&discrepancies).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	list := make([]DiscrepancyResponse, len(discrepancies))
+	for i := range discrepancies {
+		list[i] = newDiscrepancyResponse(&discrepancies[i])
+	}
+
+	// 返回成功响应
+	response.Success(c, DiscrepancyListResponse{
+		Discrepancies: list,
+		Pagination: order.Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	})
+}
+
+// ResolveDiscrepancy 管理员核实后处理对账差异
+func ResolveDiscrepancy(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	var req ResolveDiscrepancyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	var discrepancy model.ReconciliationDiscrepancy
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&discrepancy).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("对账差异不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 以待处理状态作为更新条件，避免多个管理员重复处理
+	now := time.Now()
+	result := database.DB.Model(&model.ReconciliationDiscrepancy{}).
+		Where("id = ? AND status = ?", discrepancy.ID, model.DiscrepancyStatusOpen).
+		Updates(map[string]interface{}{
+			"status":      model.DiscrepancyStatusResolved,
+			"resolved_by": payload.OpenID,
+			"resolved_at": now,
+			"resolution":  req.Resolution,
+		})
+	if result.Error != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("对账差异已处理"))
+		return
+	}
+
+	if err := database.DB.First(&discrepancy, discrepancy.ID).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	log.Info("管理员处理对账差异", "discrepancy_id", discrepancy.ID, "type", discrepancy.Type, "admin_open_id", payload.OpenID)
+	response.Success(c, newDiscrepancyResponse(&discrepancy))
+}
+
+// reconcile 获取并解析账单，与本地支付交易、退款和订单费用逐笔核对，保存对账结果和差异
+// data 为空时从支付渠道下载账单；账单获取或解析失败时记录失败的对账结果并返回错误
+func reconcile(ctx context.Context, providerName string, billProvider BillProvider, billDate time.Time, data []byte, source, operatorID string) (*model.Reconciliation, error) {
+	reconciliation := model.Reconciliation{
+		Provider:   providerName,
+		BillDate:   billDate.Format(billDateLayout),
+		Source:     source,
+		OperatorID: operatorID,
+	}
+
+	var err error
+	if data == nil {
+		data, err = billProvider.DownloadBill(ctx, billDate)
+	}
+	var records []BillRecord
+	if err == nil {
+		records, err = billProvider.ParseBill(data)
+	}
+	if err != nil {
+		log.Error("获取对账单失败", "error", err, "provider", providerName, "bill_date", reconciliation.BillDate, "source", source)
+		reconciliation.Status = model.ReconciliationStatusFailed
+		reconciliation.ErrorMessage = err.Error()
+		if err := recordReconcileFailure(&reconciliation); err != nil {
+			log.Error("记录对账失败结果失败", "error", err, "provider", providerName, "bill_date", reconciliation.BillDate)
+		}
+		if source == model.BillSourceUpload {
+			return nil, response.ErrInvalidRequest.WithTips("解析账单文件失败: " + err.Error())
+		}
+		return nil, response.ErrServerInternal.WithTips("获取对账单失败: " + err.Error())
+	}
+
+	discrepancies, err := matchBill(&reconciliation, records, billDate)
+	if err != nil {
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+	reconciliation.Status = model.ReconciliationStatusCompleted
+	if err := saveReconciliation(&reconciliation, discrepancies); err != nil {
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	log.Info("对账完成", "provider", providerName, "bill_date", reconciliation.BillDate, "matched", reconciliation.MatchedCount, "discrepancies", reconciliation.DiscrepancyCount)
+	return &reconciliation, nil
+}
+
+// matchBill 将账单记录与本地数据逐笔核对，填充对账统计并返回发现的差异
+// 账单中的记录按商户订单号或商户退款单号查找本地记录，不限支付或退款日期；
+// 本地当天成功但账单中没有的记录为账单缺失
+func matchBill(reconciliation *model.Reconciliation, records []BillRecord, billDate time.Time) ([]model.ReconciliationDiscrepancy, error) {
+	start := startOfDay(billDate)
+	end := start.AddDate(0, 0, 1)
+	provider := reconciliation.Provider
+
+	billTrades := make(map[string]BillRecord)
+	billRefunds := make(map[string]BillRecord)
+	var billTradeAmount, billRefundAmount int64
+	for _, record := range records {
+		switch record.Category {
+		case BillCategoryTrade:
+			billTrades[record.OutTradeNo] = record
+			billTradeAmount += record.Amount
+		case BillCategoryRefund:
+			billRefunds[record.OutRefundNo] = record
+			billRefundAmount += record.Amount
+		}
+	}
+	reconciliation.BillTradeCount = len(billTrades)
+	reconciliation.BillTradeAmount = FenToYuan(billTradeAmount)
+	reconciliation.BillRefundCount = len(billRefunds)
+	reconciliation.BillRefundAmount = FenToYuan(billRefundAmount)
+
+	// 查询当天支付成功的交易和账单中出现的交易
+	var transactions []model.PaymentTransaction
+	if err := database.DB.Where("provider = ? AND ((status = ? AND paid_at >= ? AND paid_at < ?) OR out_trade_no IN ?)",
+		provider, model.PaymentStatusSuccess, start, end, sortedKeys(billTrades)).Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+
+	// 查询当天退款成功的退款和账单中出现的退款
+	var refunds []model.PaymentRefund
+	if err := database.DB.Where("provider = ? AND ((status = ? AND refunded_at >= ? AND refunded_at < ?) OR out_refund_no IN ?)",
+		provider, model.RefundStatusSuccess, start, end, sortedKeys(billRefunds)).Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+
+	// 查询相关订单的费用
+	orderIDs := make([]uint, 0, len(transactions)+len(refunds))
+	for i := range transactions {
+		orderIDs = append(orderIDs, transactions[i].OrderID)
+	}
+	for i := range refunds {
+		orderIDs = append(orderIDs, refunds[i].OrderID)
+	}
+	for outTradeNo := range billTrades {
+		if orderID, err := strconv.ParseUint(outTradeNo, 10, 64); err == nil {
+			orderIDs = append(orderIDs, uint(orderID))
+		}
+	}
+	var orders []model.Order
+	if err := database.DB.Select("id", "fare").Where("id IN ?", orderIDs).Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	fares := make(map[uint]float64, len(orders))
+	for i := range orders {
+		fares[orders[i].ID] = orders[i].Fare
+	}
+
+	var discrepancies []model.ReconciliationDiscrepancy
+	addDiscrepancy := func(discrepancy model.ReconciliationDiscrepancy) {
+		discrepancy.Provider = provider
+		discrepancy.BillDate = reconciliation.BillDate
+		discrepancy.OrderFare = fares[discrepancy.OrderID]
+		discrepancy.Status = model.DiscrepancyStatusOpen
+		discrepancies = append(discrepancies, discrepancy)
+	}
+
+	// 核对交易
+	localTrades := make(map[string]*model.PaymentTransaction, len(transactions))
+	for i := range transactions {
+		transaction := &transactions[i]
+		localTrades[transaction.OutTradeNo] = transaction
+		if transaction.Status == model.PaymentStatusSuccess && transaction.PaidAt != nil &&
+			!transaction.PaidAt.Before(start) && transaction.PaidAt.Before(end) {
+			reconciliation.LocalTradeCount++
+			reconciliation.LocalTradeAmount += transaction.Amount
+		}
+	}
+	for _, outTradeNo := range sortedKeys(billTrades) {
+		record := billTrades[outTradeNo]
+		transaction, ok := localTrades[outTradeNo]
+		if !ok || transaction.Status != model.PaymentStatusSuccess {
+			discrepancy := model.ReconciliationDiscrepancy{
+				Type:       model.DiscrepancyMissingLocal,
+				Category:   model.DiscrepancyCategoryTrade,
+				OutTradeNo: outTradeNo,
+				TradeNo:    record.TradeNo,
+				BillAmount: FenToYuan(record.Amount),
+				Detail:     "账单中有该交易，本地没有支付交易记录",
+			}
+			if orderID, err := strconv.ParseUint(outTradeNo, 10, 64); err == nil {
+				discrepancy.OrderID = uint(orderID)
+			}
+			if ok {
+				discrepancy.OrderID = transaction.OrderID
+				discrepancy.LocalAmount = transaction.Amount
+				discrepancy.Detail = fmt.Sprintf("账单中有该交易，本地支付交易状态为 %s", transaction.Status)
+			}
+			addDiscrepancy(discrepancy)
+			continue
+		}
+
+		fare, hasOrder := fares[transaction.OrderID]
+		switch {
+		case record.Amount != YuanToFen(transaction.Amount):
+			addDiscrepancy(model.ReconciliationDiscrepancy{
+				Type:        model.DiscrepancyAmountMismatch,
+				Category:    model.DiscrepancyCategoryTrade,
+				OrderID:     transaction.OrderID,
+				OutTradeNo:  outTradeNo,
+				TradeNo:     record.TradeNo,
+				BillAmount:  FenToYuan(record.Amount),
+				LocalAmount: transaction.Amount,
+				Detail:      "账单金额与本地支付交易金额不一致",
+			})
+		case !hasOrder || record.Amount != YuanToFen(fare):
+			addDiscrepancy(model.ReconciliationDiscrepancy{
+				Type:        model.DiscrepancyAmountMismatch,
+				Category:    model.DiscrepancyCategoryTrade,
+				OrderID:     transaction.OrderID,
+				OutTradeNo:  outTradeNo,
+				TradeNo:     record.TradeNo,
+				BillAmount:  FenToYuan(record.Amount),
+				LocalAmount: transaction.Amount,
+				Detail:      "账单金额与订单费用不一致",
+			})
+		default:
+			reconciliation.MatchedCount++
+		}
+	}
+	for i := range transactions {
+		transaction := &transactions[i]
+		if _, ok := billTrades[transaction.OutTradeNo]; ok || transaction.Status != model.PaymentStatusSuccess {
+			continue
+		}
+		addDiscrepancy(model.ReconciliationDiscrepancy{
+			Type:        model.DiscrepancyMissingRemote,
+			Category:    model.DiscrepancyCategoryTrade,
+			OrderID:     transaction.OrderID,
+			OutTradeNo:  transaction.OutTradeNo,
+			TradeNo:     transaction.TradeNo,
+			LocalAmount: transaction.Amount,
+			Detail:      "本地支付成功，账单中没有该交易",
+		})
+	}
+
+	// 核对退款
+	localRefunds := make(map[string]*model.PaymentRefund, len(refunds))
+	for i := range refunds {
+		refund := &refunds[i]
+		localRefunds[refund.OutRefundNo] = refund
+		if refund.Status == model.RefundStatusSuccess && refund.RefundedAt != nil &&
+			!refund.RefundedAt.Before(start) && refund.RefundedAt.Before(end) {
+			reconciliation.LocalRefundCount++
+			reconciliation.LocalRefundAmount += refund.Amount
+		}
+	}
+	for _, outRefundNo := range sortedKeys(billRefunds) {
+		record := billRefunds[outRefundNo]
+		refund, ok := localRefunds[outRefundNo]
+		switch {
+		case !ok || refund.Status != model.RefundStatusSuccess:
+			discrepancy := model.ReconciliationDiscrepancy{
+				Type:        model.DiscrepancyMissingLocal,
+				Category:    model.DiscrepancyCategoryRefund,
+				OutTradeNo:  record.OutTradeNo,
+				TradeNo:     record.TradeNo,
+				OutRefundNo: outRefundNo,
+				BillAmount:  FenToYuan(record.Amount),
+				Detail:      "账单中有该退款，本地没有退款记录",
+			}
+			if ok {
+				discrepancy.OrderID = refund.OrderID
+				discrepancy.LocalAmount = refund.Amount
+				discrepancy.Detail = fmt.Sprintf("账单中有该退款，本地退款状态为 %s", refund.Status)
+			}
+			addDiscrepancy(discrepancy)
+		case record.Amount != YuanToFen(refund.Amount):
+			addDiscrepancy(model.ReconciliationDiscrepancy{
+				Type:        model.DiscrepancyAmountMismatch,
+				Category:    model.DiscrepancyCategoryRefund,
+				OrderID:     refund.OrderID,
+				OutTradeNo:  refund.OutTradeNo,
+				TradeNo:     record.TradeNo,
+				OutRefundNo: outRefundNo,
+				BillAmount:  FenToYuan(record.Amount),
+				LocalAmount: refund.Amount,
+				Detail:      "账单退款金额与本地退款金额不一致",
+			})
+		default:
+			reconciliation.MatchedCount++
+		}
+	}
+	for i := range refunds {
+		refund := &refunds[i]
+		if _, ok := billRefunds[refund.OutRefundNo]; ok || refund.Status != model.RefundStatusSuccess {
+			continue
+		}
+		addDiscrepancy(model.ReconciliationDiscrepancy{
+			Type:        model.DiscrepancyMissingRemote,
+			Category:    model.DiscrepancyCategoryRefund,
+			OrderID:     refund.OrderID,
+			OutTradeNo:  refund.OutTradeNo,
+			OutRefundNo: refund.OutRefundNo,
+			LocalAmount: refund.Amount,
+			Detail:      "本地退款成功，账单中没有该退款",
+		})
+	}
+
+	reconciliation.LocalTradeAmount = FenToYuan(YuanToFen(reconciliation.LocalTradeAmount))
+	reconciliation.LocalRefundAmount = FenToYuan(YuanToFen(reconciliation.LocalRefundAmount))
+	reconciliation.DiscrepancyCount = len(discrepancies)
+	return discrepancies, nil
+}
+
+// saveReconciliation 保存对账结果和差异，同一支付渠道同一账单日期重新对账时覆盖原结果
+// 重新对账时删除未处理的差异后重新记录，已处理的差异保留且不再重复记录
+func saveReconciliation(reconciliation *model.Reconciliation, discrepancies []model.ReconciliationDiscrepancy) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var existing model.Reconciliation
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider = ? AND bill_date = ?", reconciliation.Provider, reconciliation.BillDate).
+			First(&existing).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			if err := tx.Create(reconciliation).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			reconciliation.ID = existing.ID
+			reconciliation.CreatedAt = existing.CreatedAt
+			if err := tx.Save(reconciliation).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("reconciliation_id = ? AND status = ?", reconciliation.ID, model.DiscrepancyStatusOpen).
+			Delete(&model.ReconciliationDiscrepancy{}).Error; err != nil {
+			return err
+		}
+		var resolved []model.ReconciliationDiscrepancy
+		if err := tx.Where("reconciliation_id = ? AND status = ?", reconciliation.ID, model.DiscrepancyStatusResolved).
+			Find(&resolved).Error; err != nil {
+			return err
+		}
+		resolvedKeys := make(map[string]bool, len(resolved))
+		for i := range resolved {
+			resolvedKeys[discrepancyKey(&resolved[i])] = true
+		}
+
+		for i := range discrepancies {
+			if resolvedKeys[discrepancyKey(&discrepancies[i])] {
+				continue
+			}
+			discrepancies[i].ReconciliationID = reconciliation.ID
+			if err := tx.Create(&discrepancies[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordReconcileFailure 记录账单获取或解析失败，已有对账完成的结果时保留原结果
+func recordReconcileFailure(reconciliation *model.Reconciliation) error {
+	var existing model.Reconciliation
+	err := database.DB.Where("provider = ? AND bill_date = ?", reconciliation.Provider, reconciliation.BillDate).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return database.DB.Create(reconciliation).Error
+	}
+	if err != nil {
+		return err
+	}
+	if existing.Status == model.ReconciliationStatusCompleted {
+		return nil
+	}
+	return database.DB.Model(&existing).Updates(map[string]interface{}{
+		"source":        reconciliation.Source,
+		"error_message": reconciliation.ErrorMessage,
+		"operator_id":   reconciliation.OperatorID,
+	}).Error
+}
+
+// reconcileDaily 每天在配置的时间自动下载前一天的账单对账
+// 多实例部署时通过Redis锁保证同一账单只对账一次，对账失败时由管理员手动重新对账
+func reconcileDaily() {
+	for {
+		next := nextReconcileTime(time.Now())
+		time.Sleep(time.Until(next))
+
+		billDate := startOfDay(next).AddDate(0, 0, -1)
+		for name, provider := range providers {
+			billProvider, ok := provider.(BillProvider)
+			if !ok {
+				continue
+			}
+
+			// 获取对账锁，锁在一天后自动释放
+			lockKey := reconcileLockKeyPrefix + name + ":" + billDate.Format(billDateLayout)
+			locked, err := redis.RedisClient.SetNX(context.Background(), lockKey, time.Now().Unix(), 24*time.Hour).Result()
+			if err != nil {
+				log.Error("获取对账锁失败", "error", err, "provider", name)
+				continue
+			}
+			if !locked {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			reconciliation, err := reconcile(ctx, name, billProvider, billDate, nil, model.BillSourceDownload, "")
+			cancel()
+			if err != nil {
+				log.Error("自动对账失败", "error", err, "provider", name, "bill_date", billDate.Format(billDateLayout))
+				continue
+			}
+			if reconciliation.DiscrepancyCount > 0 {
+				log.Warn("对账发现差异，需要管理员处理", "provider", name, "bill_date", reconciliation.BillDate, "count", reconciliation.DiscrepancyCount)
+			}
+		}
+	}
+}
+
+// nextReconcileTime 返回下一次自动对账的时间，配置格式错误时使用默认时间
+func nextReconcileTime(now time.Time) time.Time {
+	value := config.Get().Payment.ReconcileTime
+	if value == "" {
+		value = defaultReconcileTime
+	}
+	at, err := time.Parse("15:04", value)
+	if err != nil {
+		log.Warn("自动对账时间格式错误，使用默认时间", "reconcile_time", value)
+		at, _ = time.Parse("15:04", defaultReconcileTime)
+	}
+
+	next := startOfDay(now).Add(time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute)
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
+// startOfDay 返回当天零点
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+}
+
+// sortedKeys 返回按字典序排列的账单记录单号
+func sortedKeys(records map[string]BillRecord) []string {
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// discrepancyKey 返回标识同一笔差异的键
+func discrepancyKey(discrepancy *model.ReconciliationDiscrepancy) string {
+	return discrepancy.Type + "|" + discrepancy.Category + "|" + discrepancy.OutTradeNo + "|" + discrepancy.OutRefundNo
+}
+
+// newReconciliationResponses 构建对账结果响应，并统计每个对账结果待处理的差异数
+func newReconciliationResponses(reconciliations []model.Reconciliation) ([]ReconciliationResponse, error) {
+	ids := make([]uint, len(reconciliations))
+	for i := range reconciliations {
+		ids[i] = reconciliations[i].ID
+	}
+
+	var counts []struct {
+		ReconciliationID uint
+		Count            int64
+	}
+	if err := database.DB.Model(&model.ReconciliationDiscrepancy{}).
+		Select("reconciliation_id, COUNT(*) AS count").
+		Where("reconciliation_id IN ? AND status = ?", ids, model.DiscrepancyStatusOpen).
+		Group("reconciliation_id").Scan(&counts).Error; err != nil {
+		return nil, err
+	}
+	openCounts := make(map[uint]int64, len(counts))
+	for _, count := range counts {
+		openCounts[count.ReconciliationID] = count.Count
+	}
+
+	list := make([]ReconciliationResponse, len(reconciliations))
+	for i := range reconciliations {
+		reconciliation := &reconciliations[i]
+		list[i] = ReconciliationResponse{
+			ID:                reconciliation.ID,
+			Provider:          reconciliation.Provider,
+			BillDate:          reconciliation.BillDate,
+			Source:            reconciliation.Source,
+			Status:            reconciliation.Status,
+			BillTradeCount:    reconciliation.BillTradeCount,
+			BillTradeAmount:   reconciliation.BillTradeAmount,
+			BillRefundCount:   reconciliation.BillRefundCount,
+			BillRefundAmount:  reconciliation.BillRefundAmount,
+			LocalTradeCount:   reconciliation.LocalTradeCount,
+			LocalTradeAmount:  reconciliation.LocalTradeAmount,
+			LocalRefundCount:  reconciliation.LocalRefundCount,
+			LocalRefundAmount: reconciliation.LocalRefundAmount,
+			MatchedCount:      reconciliation.MatchedCount,
+			DiscrepancyCount:  reconciliation.DiscrepancyCount,
+			OpenCount:         openCounts[reconciliation.ID],
+			ErrorMessage:      reconciliation.ErrorMessage,
+			OperatorID:        reconciliation.OperatorID,
+			UpdateTime:        reconciliation.UpdatedAt.Format("2006/01/02 15:04:05"),
+		}
+	}
+	return list, nil
+}
+
+// newDiscrepancyResponse 构建对账差异响应
+func newDiscrepancyResponse(discrepancy *model.ReconciliationDiscrepancy) DiscrepancyResponse {
+	return DiscrepancyResponse{
+		ID:               discrepancy.ID,
+		ReconciliationID: discrepancy.ReconciliationID,
+		Provider:         discrepancy.Provider,
+		BillDate:         discrepancy.BillDate,
+		Type:             discrepancy.Type,
+		Category:         discrepancy.Category,
+		OrderID:          discrepancy.OrderID,
+		OutTradeNo:       discrepancy.OutTradeNo,
+		TradeNo:          discrepancy.TradeNo,
+		OutRefundNo:      discrepancy.OutRefundNo,
+		BillAmount:       discrepancy.BillAmount,
+		LocalAmount:      discrepancy.LocalAmount,
+		OrderFare:        discrepancy.OrderFare,
+		Detail:           discrepancy.Detail,
+		Status:           discrepancy.Status,
+		ResolvedBy:       discrepancy.ResolvedBy,
+		ResolvedAt:       formatTime(discrepancy.ResolvedAt),
+		Resolution:       discrepancy.Resolution,
+		CreateTime:       discrepancy.CreatedAt.Format("2006/01/02 15:04:05"),
+	}
+}
@@ -0,0 +1,156 @@
+package payment
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/model"
+)
+
+// alipayBillFixture 2025-07-16 的支付宝业务明细账单，GBK编码
+const alipayBillFixture = "testdata/alipay_bill_20250716.csv"
+
+// readAlipayBill 读取并解析账单样例
+func readAlipayBill(t *testing.T) []BillRecord {
+	t.Helper()
+	data, err := os.ReadFile(alipayBillFixture)
+	if err != nil {
+		t.Fatalf("读取账单失败: %v", err)
+	}
+	if utf8.Valid(data) {
+		t.Fatal("账单样例应为GBK编码")
+	}
+
+	records, err := parseAlipayBillCSV(data)
+	if err != nil {
+		t.Fatalf("解析账单失败: %v", err)
+	}
+	return records
+}
+
+func TestParseAlipayBillCSV(t *testing.T) {
+	records := readAlipayBill(t)
+
+	// 业务类型为“交易”和“退款”以外的记录不参与对账
+	expected := []BillRecord{
+		{Category: BillCategoryTrade, TradeNo: "2025071622001400000000000101", OutTradeNo: "101", Amount: 3250},
+		{Category: BillCategoryTrade, TradeNo: "2025071622001400000000000102", OutTradeNo: "102", Amount: 4000},
+		{Category: BillCategoryTrade, TradeNo: "2025071622001400000000000103", OutTradeNo: "103", Amount: 2800},
+		{Category: BillCategoryRefund, TradeNo: "2025071622001400000000000101", OutTradeNo: "101", OutRefundNo: "101-R1", Amount: 1000},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("账单记录数量 = %d，期望 %d", len(records), len(expected))
+	}
+	for i, want := range expected {
+		got := records[i]
+		got.FinishedAt = time.Time{}
+		if got != want {
+			t.Errorf("第%d条记录 = %+v，期望 %+v", i+1, got, want)
+		}
+	}
+
+	finishedAt := time.Date(2025, 7, 16, 10, 0, 5, 0, time.Local)
+	if !records[0].FinishedAt.Equal(finishedAt) {
+		t.Errorf("完成时间 = %s，期望 %s", records[0].FinishedAt, finishedAt)
+	}
+}
+
+func TestMatchBill(t *testing.T) {
+	database.DB = openTestDB(t, &model.Order{}, &model.PaymentTransaction{}, &model.PaymentRefund{})
+	log = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	paidAt := func(hour int) *time.Time {
+		paid := time.Date(2025, 7, 16, hour, 0, 0, 0, time.Local)
+		return &paid
+	}
+	for _, orderModel := range []model.Order{
+		{Model: model.Model{ID: 101}, Status: model.OrderStatusCompleted, Fare: 32.5},
+		{Model: model.Model{ID: 102}, Status: model.OrderStatusCompleted, Fare: 45},
+		{Model: model.Model{ID: 103}, Status: model.OrderStatusWaitingForPayment, Fare: 28},
+		{Model: model.Model{ID: 104}, Status: model.OrderStatusCompleted, Fare: 19.8},
+	} {
+		if err := database.DB.Create(&orderModel).Error; err != nil {
+			t.Fatalf("创建订单失败: %v", err)
+		}
+	}
+
+	// 103 本地还没有收到支付通知，104 本地支付成功但账单中没有
+	for _, transaction := range []model.PaymentTransaction{
+		{OrderID: 101, Provider: ProviderAlipay, OutTradeNo: "101", TradeNo: "2025071622001400000000000101", Amount: 32.5, Status: model.PaymentStatusSuccess, PaidAt: paidAt(10)},
+		{OrderID: 102, Provider: ProviderAlipay, OutTradeNo: "102", TradeNo: "2025071622001400000000000102", Amount: 45, Status: model.PaymentStatusSuccess, PaidAt: paidAt(12)},
+		{OrderID: 103, Provider: ProviderAlipay, OutTradeNo: "103", Amount: 28, Status: model.PaymentStatusPending},
+		{OrderID: 104, Provider: ProviderAlipay, OutTradeNo: "104", TradeNo: "2025071622001400000000000104", Amount: 19.8, Status: model.PaymentStatusSuccess, PaidAt: paidAt(15)},
+	} {
+		if err := database.DB.Create(&transaction).Error; err != nil {
+			t.Fatalf("创建支付交易失败: %v", err)
+		}
+	}
+	if err := database.DB.Create(&model.PaymentRefund{
+		OrderID: 101, TransactionID: 1, Provider: ProviderAlipay, OutTradeNo: "101", OutRefundNo: "101-R1",
+		Amount: 10, ReasonCode: model.RefundReasonOvercharge, Status: model.RefundStatusSuccess, OperatorID: "admin", RefundedAt: paidAt(20),
+	}).Error; err != nil {
+		t.Fatalf("创建退款失败: %v", err)
+	}
+
+	reconciliation := model.Reconciliation{Provider: ProviderAlipay, BillDate: "2025-07-16"}
+	discrepancies, err := matchBill(&reconciliation, readAlipayBill(t), time.Date(2025, 7, 16, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatalf("核对账单失败: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		outTradeNo  string
+		typ         string
+		billAmount  float64
+		localAmount float64
+	}{
+		{name: "本地未确认支付", outTradeNo: "103", typ: model.DiscrepancyMissingLocal, billAmount: 28, localAmount: 28},
+		{name: "账单中没有", outTradeNo: "104", typ: model.DiscrepancyMissingRemote, billAmount: 0, localAmount: 19.8},
+		{name: "金额不一致", outTradeNo: "102", typ: model.DiscrepancyAmountMismatch, billAmount: 40, localAmount: 45},
+	}
+	if len(discrepancies) != len(tests) {
+		t.Fatalf("差异数量 = %d，期望 %d: %+v", len(discrepancies), len(tests), discrepancies)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var found *model.ReconciliationDiscrepancy
+			for i := range discrepancies {
+				if discrepancies[i].OutTradeNo == tt.outTradeNo {
+					found = &discrepancies[i]
+				}
+			}
+			if found == nil {
+				t.Fatalf("没有发现商户订单号 %s 的差异", tt.outTradeNo)
+			}
+			if found.Type != tt.typ {
+				t.Errorf("差异类型 = %s，期望 %s", found.Type, tt.typ)
+			}
+			if found.Category != model.DiscrepancyCategoryTrade {
+				t.Errorf("业务类型 = %s，期望 %s", found.Category, model.DiscrepancyCategoryTrade)
+			}
+			if found.BillAmount != tt.billAmount || found.LocalAmount != tt.localAmount {
+				t.Errorf("账单金额 = %.2f，本地金额 = %.2f，期望 %.2f 和 %.2f", found.BillAmount, found.LocalAmount, tt.billAmount, tt.localAmount)
+			}
+			if found.Status != model.DiscrepancyStatusOpen {
+				t.Errorf("处理状态 = %s，期望 %s", found.Status, model.DiscrepancyStatusOpen)
+			}
+		})
+	}
+
+	// 交易101和退款101-R1双方一致
+	if reconciliation.MatchedCount != 2 {
+		t.Errorf("一致笔数 = %d，期望 2", reconciliation.MatchedCount)
+	}
+	if reconciliation.BillTradeCount != 3 || reconciliation.BillTradeAmount != 100.5 {
+		t.Errorf("账单交易 = %d笔 %.2f元，期望 3笔 100.50元", reconciliation.BillTradeCount, reconciliation.BillTradeAmount)
+	}
+	if reconciliation.LocalTradeCount != 3 || reconciliation.LocalTradeAmount != 97.3 {
+		t.Errorf("本地交易 = %d笔 %.2f元，期望 3笔 97.30元", reconciliation.LocalTradeCount, reconciliation.LocalTradeAmount)
+	}
+}
@@ -0,0 +1,391 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// refundQueryLockKey 查询处理中退款的调度锁，保证多实例部署时同一时刻只有一个实例查询
+const refundQueryLockKey = "payment:refund:lock"
+
+// defaultRefundQueryInterval 查询处理中退款结果的默认间隔
+const defaultRefundQueryInterval = time.Minute
+
+// CreateRefundRequest 发起退款请求结构体
+type CreateRefundRequest struct {
+	TransactionID uint    `json:"transaction_id"`                 // 退款的支付交易ID，为空时使用订单最早支付成功的交易
+	Amount        float64 `json:"amount"`                         // 退款金额（元），为空时退还全部剩余可退金额
+	ReasonCode    string  `json:"reason_code" binding:"required"` // 退款原因代码
+	Reason        string  `json:"reason"`                         // 退款原因说明，原因代码为 other 时必填
+}
+
+// RefundResponse 退款响应结构体
+type RefundResponse struct {
+	ID            uint    `json:"id"`
+	OrderID       uint    `json:"order_id"`
+	TransactionID uint    `json:"transaction_id"`
+	Provider      string  `json:"provider"`
+	OutRefundNo   string  `json:"out_refund_no"`
+	RefundNo      string  `json:"refund_no"`
+	Amount        float64 `json:"amount"`
+	ReasonCode    string  `json:"reason_code"`
+	Reason        string  `json:"reason"`
+	Status        string  `json:"status"`     // 退款状态: pending, success, failed
+	RawStatus     string  `json:"raw_status"` // 支付渠道原始退款状态
+	ErrorMessage  string  `json:"error_message"`
+	OperatorID    string  `json:"operator_id"`
+	RefundedAt    *string `json:"refunded_at"`
+	CreateTime    string  `json:"create_time"`
+}
+
+// OrderRefundsResponse 订单退款记录响应结构体
+type OrderRefundsResponse struct {
+	OrderID        uint             `json:"order_id"`
+	Fare           float64          `json:"fare"`
+	RefundedAmount float64          `json:"refunded_amount"` // 已退款成功的金额
+	Refunds        []RefundResponse `json:"refunds"`
+}
+
+// CreateRefund 管理员对已支付的订单发起全额或部分退款
+func CreateRefund(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	var req CreateRefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+	if _, ok := model.RefundReasons[req.ReasonCode]; !ok {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("退款原因代码无效"))
+		return
+	}
+	if req.ReasonCode == model.RefundReasonOther && req.Reason == "" {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("请填写退款原因说明"))
+		return
+	}
+	if req.Amount < 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("退款金额必须大于0"))
+		return
+	}
+
+	orderModel, err := findOrder(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	refund, transaction, err := prepareRefund(orderModel, &req, payload.OpenID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	provider, err := GetProvider(refund.Provider)
+	if err != nil {
+		// 支付渠道已停用时退款无法发起，记录为失败
+		if err := settleRefund(refund, &RefundResult{Status: RefundStatusFailed, Message: err.Error()}); err != nil {
+			log.Error("更新退款结果失败", "error", err, "refund_id", refund.ID)
+		}
+		response.Fail(c, response.ErrInvalidRequest.WithTips(err.Error()))
+		return
+	}
+
+	reason := model.RefundReasons[refund.ReasonCode]
+	if refund.Reason != "" {
+		reason += "：" + refund.Reason
+	}
+	result, err := provider.Refund(c.Request.Context(), &RefundRequest{
+		OutTradeNo:  refund.OutTradeNo,
+		OutRefundNo: refund.OutRefundNo,
+		Amount:      YuanToFen(refund.Amount),
+		TotalAmount: YuanToFen(transaction.Amount),
+		Reason:      reason,
+	})
+	if err != nil {
+		// 无法确定退款结果，保持处理中，之后定时查询
+		log.Error("发起退款失败，等待查询退款结果", "error", err, "refund_id", refund.ID, "order_id", orderModel.ID)
+		if err := database.DB.Model(refund).Update("error_message", err.Error()).Error; err != nil {
+			log.Error("记录退款错误失败", "error", err, "refund_id", refund.ID)
+		}
+	} else if err := settleRefund(refund, result); err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	if err := database.DB.First(refund, refund.ID).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	log.Info("管理员发起退款", "refund_id", refund.ID, "order_id", orderModel.ID, "amount", refund.Amount, "reason_code", refund.ReasonCode, "status", refund.Status, "admin_open_id", payload.OpenID)
+	response.Success(c, newRefundResponse(refund))
+}
+
+// GetOrderRefunds 管理员查询订单的退款记录
+func GetOrderRefunds(c *gin.Context) {
+	orderModel, err := findOrder(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	var refunds []model.PaymentRefund
+	if err := database.DB.Where("order_id = ?", orderModel.ID).Order("id ASC").Find(&refunds).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	resp := OrderRefundsResponse{
+		OrderID:        orderModel.ID,
+		Fare:           orderModel.Fare,
+		RefundedAmount: orderModel.RefundedAmount,
+		Refunds:        make([]RefundResponse, len(refunds)),
+	}
+	for i := range refunds {
+		resp.Refunds[i] = newRefundResponse(&refunds[i])
+	}
+	response.Success(c, resp)
+}
+
+// prepareRefund 锁定支付交易并记录处理中的退款
+// 处理中和已成功的退款都计入已退金额，同一交易的退款串行记录，退款总额不会超过支付金额
+func prepareRefund(orderModel *model.Order, req *CreateRefundRequest, operatorID string) (*model.PaymentRefund, *model.PaymentTransaction, error) {
+	var refund model.PaymentRefund
+	var transaction model.PaymentTransaction
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("order_id = ? AND status = ?", orderModel.ID, model.PaymentStatusSuccess)
+		if req.TransactionID != 0 {
+			query = query.Where("id = ?", req.TransactionID)
+		}
+		if err := query.Order("paid_at ASC, id ASC").First(&transaction).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return response.ErrInvalidRequest.WithTips("订单没有支付成功的交易，无法退款")
+			}
+			return response.ErrDatabase.WithOrigin(err)
+		}
+
+		var refunded float64
+		if err := tx.Model(&model.PaymentRefund{}).
+			Where("transaction_id = ? AND status IN ?", transaction.ID, []string{model.RefundStatusPending, model.RefundStatusSuccess}).
+			Select("COALESCE(SUM(amount), 0)").Scan(&refunded).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		remaining := YuanToFen(transaction.Amount) - YuanToFen(refunded)
+		if remaining <= 0 {
+			return response.ErrInvalidRequest.WithTips("交易已全额退款")
+		}
+
+		amount := remaining
+		if req.Amount > 0 {
+			amount = YuanToFen(req.Amount)
+		}
+		if amount <= 0 {
+			return response.ErrInvalidRequest.WithTips("退款金额必须大于0")
+		}
+		if amount > remaining {
+			return response.ErrInvalidRequest.WithTips(fmt.Sprintf("退款金额超过可退金额%s元", formatYuan(remaining)))
+		}
+
+		// 商户退款单号由商户订单号和退款序号组成，失败的退款也占用序号
+		var count int64
+		if err := tx.Model(&model.PaymentRefund{}).Where("transaction_id = ?", transaction.ID).Count(&count).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+
+		refund = model.PaymentRefund{
+			OrderID:       orderModel.ID,
+			TransactionID: transaction.ID,
+			Provider:      transaction.Provider,
+			OutTradeNo:    transaction.OutTradeNo,
+			OutRefundNo:   fmt.Sprintf("%sR%d", transaction.OutTradeNo, count+1),
+			Amount:        FenToYuan(amount),
+			ReasonCode:    req.ReasonCode,
+			Reason:        req.Reason,
+			Status:        model.RefundStatusPending,
+			OperatorID:    operatorID,
+		}
+		if err := tx.Create(&refund).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return &refund, &transaction, nil
+}
+
+// settleRefund 按支付渠道返回的结果更新处理中的退款
+// 退款成功时在同一事务中累加订单的已退款金额，退款已不是处理中时不重复处理
+func settleRefund(refund *model.PaymentRefund, result *RefundResult) error {
+	switch result.Status {
+	case RefundStatusSuccess:
+		return database.DB.Transaction(func(tx *gorm.DB) error {
+			updated := tx.Model(&model.PaymentRefund{}).
+				Where("id = ? AND status = ?", refund.ID, model.RefundStatusPending).
+				Updates(map[string]interface{}{
+					"status":        model.RefundStatusSuccess,
+					"refund_no":     result.RefundNo,
+					"raw_status":    result.RawStatus,
+					"error_message": "",
+					"refunded_at":   time.Now(),
+				})
+			if updated.Error != nil {
+				return updated.Error
+			}
+			if updated.RowsAffected == 0 {
+				return nil
+			}
+			log.Info("退款成功", "refund_id", refund.ID, "order_id", refund.OrderID, "amount", refund.Amount)
+			return tx.Model(&model.Order{}).Where("id = ?", refund.OrderID).
+				Update("refunded_amount", gorm.Expr("refunded_amount + ?", refund.Amount)).Error
+		})
+	case RefundStatusFailed:
+		log.Warn("退款失败", "refund_id", refund.ID, "order_id", refund.OrderID, "raw_status", result.RawStatus, "message", result.Message)
+		return database.DB.Model(&model.PaymentRefund{}).
+			Where("id = ? AND status = ?", refund.ID, model.RefundStatusPending).
+			Updates(map[string]interface{}{
+				"status":        model.RefundStatusFailed,
+				"refund_no":     result.RefundNo,
+				"raw_status":    result.RawStatus,
+				"error_message": result.Message,
+			}).Error
+	default:
+		return database.DB.Model(&model.PaymentRefund{}).
+			Where("id = ? AND status = ?", refund.ID, model.RefundStatusPending).
+			Updates(map[string]interface{}{
+				"refund_no":  result.RefundNo,
+				"raw_status": result.RawStatus,
+			}).Error
+	}
+}
+
+// queryPendingRefunds 定时向支付渠道查询处理中的退款，直到退款成功或失败
+// 多实例部署时通过Redis锁保证同一时间只有一个实例查询
+func queryPendingRefunds() {
+	interval := refundQueryInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 获取调度锁，锁在一个查询间隔后自动释放
+		locked, err := redis.RedisClient.SetNX(context.Background(), refundQueryLockKey, time.Now().Unix(), interval).Result()
+		if err != nil {
+			log.Error("获取退款查询锁失败", "error", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		// 刚发起的退款留给发起请求处理，超过一个查询间隔仍在处理中的才查询
+		var refunds []model.PaymentRefund
+		if err := database.DB.Where("status = ? AND created_at <= ?", model.RefundStatusPending, time.Now().Add(-interval)).
+			Order("id ASC").Find(&refunds).Error; err != nil {
+			log.Error("查询处理中的退款失败", "error", err)
+			continue
+		}
+		for i := range refunds {
+			queryRefund(&refunds[i])
+		}
+	}
+}
+
+// queryRefund 向支付渠道查询一笔处理中的退款并更新结果
+func queryRefund(refund *model.PaymentRefund) {
+	provider, err := GetProvider(refund.Provider)
+	if err != nil {
+		log.Error("查询退款的支付渠道未启用", "refund_id", refund.ID, "provider", refund.Provider)
+		return
+	}
+
+	if err := database.DB.Model(refund).Update("query_count", gorm.Expr("query_count + 1")).Error; err != nil {
+		log.Error("记录退款查询次数失败", "error", err, "refund_id", refund.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	result, err := provider.QueryRefund(ctx, refund.OutTradeNo, refund.OutRefundNo)
+	if errors.Is(err, ErrRefundNotFound) {
+		// 退款请求未到达支付渠道，退款没有发生
+		result, err = &RefundResult{Status: RefundStatusFailed, Message: "支付渠道中不存在该退款"}, nil
+	}
+	if err != nil {
+		log.Error("查询退款结果失败", "error", err, "refund_id", refund.ID)
+		return
+	}
+	if err := settleRefund(refund, result); err != nil {
+		log.Error("更新退款结果失败", "error", err, "refund_id", refund.ID)
+	}
+}
+
+// refundQueryInterval 返回查询处理中退款结果的间隔
+func refundQueryInterval() time.Duration {
+	if interval := config.Get().Payment.RefundQuery; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return defaultRefundQueryInterval
+}
+
+// newRefundResponse 构建退款响应
+func newRefundResponse(refund *model.PaymentRefund) RefundResponse {
+	return RefundResponse{
+		ID:            refund.ID,
+		OrderID:       refund.OrderID,
+		TransactionID: refund.TransactionID,
+		Provider:      refund.Provider,
+		OutRefundNo:   refund.OutRefundNo,
+		RefundNo:      refund.RefundNo,
+		Amount:        refund.Amount,
+		ReasonCode:    refund.ReasonCode,
+		Reason:        refund.Reason,
+		Status:        refund.Status,
+		RawStatus:     refund.RawStatus,
+		ErrorMessage:  refund.ErrorMessage,
+		OperatorID:    refund.OperatorID,
+		RefundedAt:    formatTime(refund.RefundedAt),
+		CreateTime:    refund.CreatedAt.Format("2006/01/02 15:04:05"),
+	}
+}
+
+// formatTime 格式化可为空的时间
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format("2006/01/02 15:04:05")
+	return &formatted
+}
@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"cab-hive/internal/global/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitRouter 初始化支付模块的路由
+func (p *ModulePayment) InitRouter(router *gin.RouterGroup) {
+	// 创建支付订单
+	// 需要用户认证
+	router.POST("/payment/create", middleware.Auth(1), CreatePayment)
+
+	// 查询订单支付状态
+	// 需要用户认证
+	router.POST("/payment/query", middleware.Auth(1), QueryPayment)
+
+	// 支付宝异步通知回调，兼容已配置的支付宝通知地址
+	router.POST("/payment/notify", NotifyHandler)
+
+	// 各支付渠道异步通知回调
+	router.POST("/payment/notify/:provider", NotifyHandler)
+
+	// 支付宝同步返回
+	router.GET("/payment/return", ReturnHandler)
+
+	// 对已支付的订单发起全额或部分退款
+	// 需要管理员权限
+	router.POST("/payment/orders/:id/refunds", middleware.Auth(3), CreateRefund)
+
+	// 查询订单的退款记录
+	// 需要管理员权限
+	router.GET("/payment/orders/:id/refunds", middleware.Auth(3), GetOrderRefunds)
+
+	// 手动对账指定日期的账单，可上传账单文件
+	// 需要管理员权限
+	router.POST("/payment/reconciliations", middleware.Auth(3), RunReconciliation)
+
+	// 查询对账结果列表
+	// 需要管理员权限
+	router.GET("/payment/reconciliations", middleware.Auth(3), GetReconciliations)
+
+	// 查询对账差异列表
+	// 需要管理员权限
+	router.GET("/payment/discrepancies", middleware.Auth(3), GetDiscrepancies)
+
+	// 处理对账差异
+	// 需要管理员权限
+	router.POST("/payment/discrepancies/:id/resolve", middleware.Auth(3), ResolveDiscrepancy)
+
+	// 模拟完成支付，仅在启用模拟支付时注册
+	// 需要用户认证
+	if _, ok := providers[ProviderMock]; ok {
+		router.POST("/payment/mock/pay", middleware.Auth(1), MockPay)
+	}
+}
@@ -0,0 +1,174 @@
+package payment
+
+import (
+	"time"
+
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// prepareTransaction 为订单在支付渠道中创建支付交易，已存在时复用
+// 同一订单在同一支付渠道使用相同的商户订单号，订单已有支付成功的交易时不能再次支付
+func prepareTransaction(orderModel *model.Order, provider string) (*model.PaymentTransaction, error) {
+	var paid int64
+	if err := database.DB.Model(&model.PaymentTransaction{}).
+		Where("order_id = ? AND status = ?", orderModel.ID, model.PaymentStatusSuccess).
+		Count(&paid).Error; err != nil {
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+	if paid > 0 {
+		return nil, response.ErrInvalidRequest.WithTips("订单已支付，请勿重复支付")
+	}
+
+	transaction := model.PaymentTransaction{
+		OrderID:    orderModel.ID,
+		UserOpenID: orderModel.UserOpenID,
+		Provider:   provider,
+		OutTradeNo: outTradeNo(orderModel),
+		Amount:     orderModel.Fare,
+		Status:     model.PaymentStatusPending,
+	}
+	if err := database.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&transaction).Error; err != nil {
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 读取实际保存的交易，交易已存在时上面的插入不生效
+	if err := database.DB.Where("provider = ? AND out_trade_no = ?", provider, transaction.OutTradeNo).First(&transaction).Error; err != nil {
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 等待付款期间订单费用调整时同步交易金额
+	if transaction.Status == model.PaymentStatusPending && transaction.Amount != orderModel.Fare {
+		if err := database.DB.Model(&transaction).Update("amount", orderModel.Fare).Error; err != nil {
+			return nil, response.ErrDatabase.WithOrigin(err)
+		}
+		transaction.Amount = orderModel.Fare
+	}
+	return &transaction, nil
+}
+
+// applyNotification 幂等处理校验通过的支付结果通知
+// 校验收款方和金额后将交易记录为支付成功并完结订单，重复通知只累计通知次数，返回错误时支付平台会重新发送通知
+func applyNotification(provider PaymentProvider, notification *Notification) error {
+	var transaction model.PaymentTransaction
+	if err := database.DB.Where("provider = ? AND out_trade_no = ?", notification.Provider, notification.OutTradeNo).First(&transaction).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("支付通知对应的交易不存在", "provider", notification.Provider, "out_trade_no", notification.OutTradeNo)
+			return errors.Errorf("支付交易不存在: %s", notification.OutTradeNo)
+		}
+		return err
+	}
+
+	// 记录收到的通知次数，包括重复通知
+	if err := database.DB.Model(&model.PaymentTransaction{}).Where("id = ?", transaction.ID).Updates(map[string]interface{}{
+		"notify_count":   gorm.Expr("notify_count + 1"),
+		"last_notify_at": time.Now(),
+	}).Error; err != nil {
+		return err
+	}
+
+	switch notification.Status {
+	case TradeStatusSuccess:
+	case TradeStatusClosed, TradeStatusFailed:
+		// 未付款关闭或支付失败，只更新等待付款的交易
+		return database.DB.Model(&model.PaymentTransaction{}).
+			Where("id = ? AND status = ?", transaction.ID, model.PaymentStatusPending).
+			Update("status", string(notification.Status)).Error
+	default:
+		return nil
+	}
+
+	// 校验收款方和金额，不一致的通知不处理
+	if sellerID := provider.SellerID(); sellerID != "" && notification.SellerID != sellerID {
+		log.Error("支付通知收款方不匹配", "transaction_id", transaction.ID, "expected", sellerID, "actual", notification.SellerID)
+		return errors.Errorf("收款方不匹配: %s", notification.SellerID)
+	}
+	if expected := YuanToFen(transaction.Amount); notification.Amount != expected {
+		log.Error("支付通知金额不匹配", "transaction_id", transaction.ID, "expected", expected, "actual", notification.Amount)
+		return errors.Errorf("支付金额不匹配: %d", notification.Amount)
+	}
+
+	if transaction.Status != model.PaymentStatusSuccess {
+		paidAt := notification.PaidAt
+		if paidAt.IsZero() {
+			paidAt = time.Now()
+		}
+
+		// 以交易未支付成功作为更新条件，并发的重复通知只有一个生效
+		result := database.DB.Model(&model.PaymentTransaction{}).
+			Where("id = ? AND status <> ?", transaction.ID, model.PaymentStatusSuccess).
+			Updates(map[string]interface{}{
+				"status":      model.PaymentStatusSuccess,
+				"trade_no":    notification.TradeNo,
+				"seller_id":   notification.SellerID,
+				"paid_at":     paidAt,
+				"raw_payload": notification.Raw,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Info("支付交易支付成功", "transaction_id", transaction.ID, "order_id", transaction.OrderID, "provider", transaction.Provider, "trade_no", notification.TradeNo)
+		}
+		if err := database.DB.First(&transaction, transaction.ID).Error; err != nil {
+			return err
+		}
+	}
+
+	// 同一商户订单号只能对应一笔支付渠道交易
+	if transaction.TradeNo != notification.TradeNo {
+		log.Error("支付通知交易号与已记录的不一致", "transaction_id", transaction.ID, "recorded", transaction.TradeNo, "notified", notification.TradeNo)
+		return errors.Errorf("交易号不一致: %s", notification.TradeNo)
+	}
+
+	return completeOrder(&transaction)
+}
+
+// completeOrder 支付成功后完结订单，订单已完结时直接返回
+// 重复通知或上次完结订单失败时再次调用，保证订单最终完结
+func completeOrder(transaction *model.PaymentTransaction) error {
+	var orderModel model.Order
+	if err := database.DB.First(&orderModel, transaction.OrderID).Error; err != nil {
+		return err
+	}
+
+	switch orderModel.Status {
+	case model.OrderStatusWaitingForPayment:
+		err := order.Transition(&orderModel, model.OrderStatusCompleted, order.SystemActor(providerTitle[transaction.Provider]+"支付成功"), map[string]interface{}{
+			"payment_time": transaction.PaidAt,
+		})
+		if err == nil {
+			log.Info("订单支付成功", "order_id", orderModel.ID, "provider", transaction.Provider, "trade_no", transaction.TradeNo)
+			// 乘客结清全部超期订单后清除欠费标记
+			clearArrears(time.Now(), unpaidDeadline(), orderModel.UserOpenID)
+			return nil
+		}
+		// 并发通知已完结订单
+		if errors.Is(err, response.ErrOrderStatusConflict) {
+			return nil
+		}
+		log.Error("更新支付订单状态失败", "error", err, "order_id", orderModel.ID)
+		return err
+	case model.OrderStatusCompleted:
+		// 订单已由其他支付渠道的交易完结时，本交易为重复支付
+		var others int64
+		if err := database.DB.Model(&model.PaymentTransaction{}).
+			Where("order_id = ? AND status = ? AND id <> ?", orderModel.ID, model.PaymentStatusSuccess, transaction.ID).
+			Count(&others).Error; err != nil {
+			return err
+		}
+		if others > 0 {
+			log.Warn("订单重复支付，需要退款", "order_id", orderModel.ID, "transaction_id", transaction.ID, "provider", transaction.Provider)
+		}
+		return nil
+	default:
+		log.Warn("订单不是待付款状态，支付成功的交易需要人工处理", "order_id", orderModel.ID, "status", orderModel.Status, "transaction_id", transaction.ID)
+		return nil
+	}
+}
@@ -0,0 +1,271 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
+	go_redis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testProvider 只用于校验通知的支付渠道，模拟已支付订单的另一个支付渠道
+type testProvider struct {
+	PaymentProvider
+	name     string
+	sellerID string
+}
+
+func (p *testProvider) Name() string     { return p.name }
+func (p *testProvider) SellerID() string { return p.sellerID }
+
+// setupTest 使用临时的SQLite数据库和内存Redis初始化支付模块，返回记录支付模块日志的缓冲区
+func setupTest(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	config.Set(config.Config{})
+
+	database.DB = openTestDB(t, &model.User{}, &model.Order{}, &model.OrderEvent{}, &model.PaymentTransaction{})
+
+	server := miniredis.RunT(t)
+	redis.RedisClient = go_redis.NewClient(&go_redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { redis.RedisClient.Close() })
+
+	(&order.ModuleOrder{}).Init()
+	var buf bytes.Buffer
+	log = slog.New(slog.NewTextHandler(&buf, nil))
+	return &buf
+}
+
+// openTestDB 创建临时的SQLite数据库并迁移指定的模型
+// SQLite驱动只把声明为 datetime 等类型的列读取为时间，迁移后将 timestamptz 列改为 datetime
+func openTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.db")
+	db, err := gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	for _, sql := range []string{
+		"PRAGMA writable_schema = ON",
+		"UPDATE sqlite_master SET sql = replace(sql, 'timestamptz', 'datetime') WHERE type = 'table'",
+		"PRAGMA writable_schema = OFF",
+	} {
+		if err := db.Exec(sql).Error; err != nil {
+			t.Fatalf("修改数据库结构失败: %v", err)
+		}
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		sqlDB.Close()
+	}
+
+	// 重新打开数据库使修改后的结构生效
+	db, err = gorm.Open(sqlite.Open(path), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// newTestMockProvider 创建模拟支付渠道
+func newTestMockProvider() *mockProvider {
+	return &mockProvider{secret: "test", trades: map[string]*mockTrade{}, refunds: map[string]*RefundResult{}}
+}
+
+// createUnpaidOrder 创建一个行程已结束、等待付款的订单
+func createUnpaidOrder(t *testing.T, fare float64) *model.Order {
+	t.Helper()
+	endTime := time.Now()
+	orderModel := model.Order{
+		UserOpenID:   "passenger",
+		DriverOpenID: "driver",
+		Status:       model.OrderStatusWaitingForPayment,
+		Fare:         fare,
+		EndTime:      &endTime,
+	}
+	if err := database.DB.Create(&orderModel).Error; err != nil {
+		t.Fatalf("创建订单失败: %v", err)
+	}
+	return &orderModel
+}
+
+// createMockPayment 以模拟支付渠道为订单发起支付，返回支付交易和乘客完成支付后的通知
+func createMockPayment(t *testing.T, provider *mockProvider, orderModel *model.Order) (*model.PaymentTransaction, *Notification) {
+	t.Helper()
+	transaction, err := prepareTransaction(orderModel, provider.Name())
+	if err != nil {
+		t.Fatalf("创建支付交易失败: %v", err)
+	}
+	if _, err := provider.CreatePayment(context.Background(), &CreateRequest{
+		OutTradeNo: transaction.OutTradeNo,
+		Amount:     YuanToFen(transaction.Amount),
+	}); err != nil {
+		t.Fatalf("创建模拟支付失败: %v", err)
+	}
+	notification, err := provider.Pay(transaction.OutTradeNo)
+	if err != nil {
+		t.Fatalf("模拟支付失败: %v", err)
+	}
+	return transaction, notification
+}
+
+// reload 重新读取数据库中的记录
+func reload(t *testing.T, dest interface{}, id uint) {
+	t.Helper()
+	if err := database.DB.First(dest, id).Error; err != nil {
+		t.Fatalf("读取记录失败: %v", err)
+	}
+}
+
+// countCompletedEvents 统计订单变更为已完成的事件数量
+func countCompletedEvents(t *testing.T, orderID uint) int64 {
+	t.Helper()
+	var count int64
+	if err := database.DB.Model(&model.OrderEvent{}).
+		Where("order_id = ? AND to_status = ?", orderID, model.OrderStatusCompleted).
+		Count(&count).Error; err != nil {
+		t.Fatalf("查询订单事件失败: %v", err)
+	}
+	return count
+}
+
+func TestApplyNotificationDuplicate(t *testing.T) {
+	setupTest(t)
+	provider := newTestMockProvider()
+	orderModel := createUnpaidOrder(t, 32.5)
+	transaction, notification := createMockPayment(t, provider, orderModel)
+
+	for i := 0; i < 2; i++ {
+		if err := applyNotification(provider, notification); err != nil {
+			t.Fatalf("第%d次处理通知失败: %v", i+1, err)
+		}
+	}
+
+	reload(t, transaction, transaction.ID)
+	if transaction.Status != model.PaymentStatusSuccess {
+		t.Errorf("交易状态 = %s，期望 %s", transaction.Status, model.PaymentStatusSuccess)
+	}
+	if transaction.NotifyCount != 2 {
+		t.Errorf("通知次数 = %d，期望 2", transaction.NotifyCount)
+	}
+	if transaction.TradeNo != notification.TradeNo {
+		t.Errorf("交易号 = %s，期望 %s", transaction.TradeNo, notification.TradeNo)
+	}
+
+	reload(t, orderModel, orderModel.ID)
+	if orderModel.Status != model.OrderStatusCompleted {
+		t.Errorf("订单状态 = %s，期望 %s", orderModel.Status, model.OrderStatusCompleted)
+	}
+	if count := countCompletedEvents(t, orderModel.ID); count != 1 {
+		t.Errorf("订单完成事件数量 = %d，期望 1", count)
+	}
+}
+
+func TestApplyNotificationRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(notification *Notification)
+	}{
+		{
+			name:   "金额不匹配",
+			modify: func(notification *Notification) { notification.Amount -= 1 },
+		},
+		{
+			name:   "收款方不匹配",
+			modify: func(notification *Notification) { notification.SellerID = "other_seller" },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTest(t)
+			provider := newTestMockProvider()
+			orderModel := createUnpaidOrder(t, 32.5)
+			transaction, notification := createMockPayment(t, provider, orderModel)
+			tt.modify(notification)
+
+			// 返回错误时支付平台会重新发送通知
+			if err := applyNotification(provider, notification); err == nil {
+				t.Fatal("处理通知成功，期望返回错误")
+			}
+
+			reload(t, transaction, transaction.ID)
+			if transaction.Status != model.PaymentStatusPending {
+				t.Errorf("交易状态 = %s，期望 %s", transaction.Status, model.PaymentStatusPending)
+			}
+			if transaction.NotifyCount != 1 {
+				t.Errorf("通知次数 = %d，期望 1", transaction.NotifyCount)
+			}
+
+			reload(t, orderModel, orderModel.ID)
+			if orderModel.Status != model.OrderStatusWaitingForPayment {
+				t.Errorf("订单状态 = %s，期望 %s", orderModel.Status, model.OrderStatusWaitingForPayment)
+			}
+		})
+	}
+}
+
+func TestApplyNotificationPaidByOtherProvider(t *testing.T) {
+	buf := setupTest(t)
+	provider := newTestMockProvider()
+	other := &testProvider{name: ProviderAlipay, sellerID: "2088000000000000"}
+	orderModel := createUnpaidOrder(t, 32.5)
+
+	// 乘客先后在两个支付渠道发起支付，两笔都付款成功
+	otherTransaction, err := prepareTransaction(orderModel, other.Name())
+	if err != nil {
+		t.Fatalf("创建支付交易失败: %v", err)
+	}
+	_, notification := createMockPayment(t, provider, orderModel)
+	if err := applyNotification(provider, notification); err != nil {
+		t.Fatalf("处理通知失败: %v", err)
+	}
+
+	// 订单已完结后收到另一个支付渠道的通知，记录支付成功并提示退款，不返回错误避免支付平台重复通知
+	if err := applyNotification(other, &Notification{
+		Provider:   other.Name(),
+		OutTradeNo: otherTransaction.OutTradeNo,
+		TradeNo:    "2025071622001400000000000001",
+		Status:     TradeStatusSuccess,
+		Amount:     YuanToFen(otherTransaction.Amount),
+		SellerID:   other.SellerID(),
+		PaidAt:     time.Now(),
+	}); err != nil {
+		t.Fatalf("处理通知失败: %v", err)
+	}
+
+	reload(t, otherTransaction, otherTransaction.ID)
+	if otherTransaction.Status != model.PaymentStatusSuccess {
+		t.Errorf("交易状态 = %s，期望 %s", otherTransaction.Status, model.PaymentStatusSuccess)
+	}
+
+	reload(t, orderModel, orderModel.ID)
+	if orderModel.Status != model.OrderStatusCompleted {
+		t.Errorf("订单状态 = %s，期望 %s", orderModel.Status, model.OrderStatusCompleted)
+	}
+	if count := countCompletedEvents(t, orderModel.ID); count != 1 {
+		t.Errorf("订单完成事件数量 = %d，期望 1", count)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("订单重复支付，需要退款")) {
+		t.Error("没有记录订单重复支付")
+	}
+}
@@ -0,0 +1,220 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/wechat"
+	"cab-hive/internal/model"
+
+	"github.com/pkg/errors"
+)
+
+// 未付款订单相关的Redis key
+const (
+	unpaidLockKey         = "payment:unpaid:lock"    // 未付款订单扫描锁，保证多实例部署时同一时间只有一个实例发送提醒
+	unpaidRemindKeyPrefix = "payment:unpaid:remind:" // 付款提醒重试间隔键前缀，后接订单ID
+)
+
+// unpaidRemindRetry 付款提醒发送失败后的重试间隔
+const unpaidRemindRetry = 10 * time.Minute
+
+// 未付款订单默认配置
+const (
+	defaultUnpaidCheck    = time.Minute    // 扫描未付款订单的间隔
+	defaultUnpaidDeadline = 24 * time.Hour // 行程结束后的付款期限
+)
+
+// defaultUnpaidRemind 行程结束后发送付款提醒的默认时间点（秒）
+var defaultUnpaidRemind = []int{600, 3600, 21600}
+
+// remindUnpaidOrders 定时扫描待付款订单，按配置的时间点提醒乘客付款
+// 超过付款期限仍未付款时将乘客记为欠费，并清除已结清乘客的欠费标记
+func remindUnpaidOrders() {
+	interval := unpaidCheckInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 获取调度锁，锁在一个扫描间隔后自动释放
+		locked, err := redis.RedisClient.SetNX(context.Background(), unpaidLockKey, time.Now().Unix(), interval).Result()
+		if err != nil {
+			log.Error("获取未付款订单扫描锁失败", "error", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		checkUnpaidOrders(time.Now())
+	}
+}
+
+// checkUnpaidOrders 检查所有待付款订单，发送到期的付款提醒并标记欠费乘客
+func checkUnpaidOrders(now time.Time) {
+	remind := unpaidRemindOffsets()
+	deadline := unpaidDeadline()
+
+	var orders []model.Order
+	if err := database.DB.Where("status = ? AND end_time IS NOT NULL", model.OrderStatusWaitingForPayment).
+		Order("end_time ASC").Find(&orders).Error; err != nil {
+		log.Error("查询待付款订单失败", "error", err)
+		return
+	}
+
+	overdue := make(map[string]*model.Order)
+	for i := range orders {
+		orderModel := &orders[i]
+		elapsed := now.Sub(*orderModel.EndTime)
+
+		// 超过付款期限的订单，按乘客记录最早到期的订单
+		if elapsed >= deadline {
+			if _, ok := overdue[orderModel.UserOpenID]; !ok {
+				overdue[orderModel.UserOpenID] = orderModel
+			}
+		}
+
+		// 已到达的提醒时间点多于已发送的提醒次数时发送提醒，错过的多个时间点只提醒一次
+		due := 0
+		for _, offset := range remind {
+			if elapsed >= offset {
+				due++
+			}
+		}
+		if due > orderModel.PayRemindCount {
+			sendPaymentReminder(orderModel, due, deadline)
+		}
+	}
+
+	for openID, orderModel := range overdue {
+		markArrears(openID, orderModel, deadline)
+	}
+	clearArrears(now, deadline)
+}
+
+// sendPaymentReminder 通过订阅消息提醒乘客付款，消息发送成功后才记录已发送的提醒次数
+// 以已发送的提醒次数作为更新条件，避免重复记录；发送失败时在重试间隔后再次发送，
+// 乘客未订阅或未配置模板时重试也无法送达，同样记录提醒次数，到下一个提醒时间点再尝试
+func sendPaymentReminder(orderModel *model.Order, count int, deadline time.Duration) {
+	ctx := context.Background()
+	retryKey := fmt.Sprintf("%s%d", unpaidRemindKeyPrefix, orderModel.ID)
+	acquired, err := redis.RedisClient.SetNX(ctx, retryKey, time.Now().Unix(), unpaidRemindRetry).Result()
+	if err != nil {
+		log.Error("获取付款提醒锁失败", "error", err, "order_id", orderModel.ID)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	due := orderModel.EndTime.Add(deadline)
+	overdue := !time.Now().Before(due)
+	tip := "请尽快完成支付，逾期未付将无法下单"
+	if overdue {
+		tip = "已超过付款期限，结清前无法下单"
+	}
+	err = wechat.SendSubscribeMessage(ctx, wechat.SubscribeMessage{
+		ToUser:   orderModel.UserOpenID,
+		Template: config.Get().WeChat.Templates.PaymentReminder,
+		Data: map[string]string{
+			"amount1": fmt.Sprintf("%.2f元", orderModel.Fare),
+			"time2":   due.Format("2006-01-02 15:04"),
+			"thing3":  orderModel.StartLocation.Name + "-" + orderModel.EndLocation.Name,
+			"thing4":  tip,
+		},
+	})
+	delivered := err == nil
+	if errors.Is(err, wechat.ErrNotSubscribed) || errors.Is(err, wechat.ErrTemplateNotConfigured) {
+		log.Warn("无法发送付款提醒，本次不再重试", "error", err, "order_id", orderModel.ID, "user_open_id", orderModel.UserOpenID)
+	} else if err != nil {
+		log.Warn("发送付款提醒失败", "error", err, "order_id", orderModel.ID, "user_open_id", orderModel.UserOpenID)
+		return
+	}
+
+	result := database.DB.Model(&model.Order{}).
+		Where("id = ? AND status = ? AND pay_remind_count = ?", orderModel.ID, model.OrderStatusWaitingForPayment, orderModel.PayRemindCount).
+		Update("pay_remind_count", count)
+	if result.Error != nil {
+		log.Error("更新付款提醒次数失败", "error", result.Error, "order_id", orderModel.ID)
+		return
+	}
+	orderModel.PayRemindCount = count
+	if !delivered {
+		return
+	}
+	log.Info("已提醒乘客付款", "order_id", orderModel.ID, "user_open_id", orderModel.UserOpenID, "count", count, "overdue", overdue)
+}
+
+// markArrears 将超过付款期限仍未付款的乘客记为欠费，欠费开始时间为最早到期订单的付款期限
+// 乘客已经是欠费状态时不重复标记
+func markArrears(openID string, orderModel *model.Order, deadline time.Duration) {
+	since := orderModel.EndTime.Add(deadline)
+	result := database.DB.Model(&model.User{}).
+		Where("open_id = ? AND arrears_since IS NULL", openID).
+		Update("arrears_since", since)
+	if result.Error != nil {
+		log.Error("标记乘客欠费失败", "error", result.Error, "user_open_id", openID)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Warn("乘客超过付款期限未付款，记为欠费", "user_open_id", openID, "order_id", orderModel.ID, "fare", orderModel.Fare)
+	}
+}
+
+// clearArrears 清除已没有超过付款期限的待付款订单的乘客欠费标记
+// 传入乘客OpenID时只检查这些乘客
+func clearArrears(now time.Time, deadline time.Duration, openIDs ...string) {
+	unpaid := database.DB.Model(&model.Order{}).Select("user_open_id").
+		Where("status = ? AND end_time <= ?", model.OrderStatusWaitingForPayment, now.Add(-deadline))
+
+	query := database.DB.Model(&model.User{}).Where("arrears_since IS NOT NULL AND open_id NOT IN (?)", unpaid)
+	if len(openIDs) > 0 {
+		query = query.Where("open_id IN ?", openIDs)
+	}
+	result := query.Update("arrears_since", nil)
+	if result.Error != nil {
+		log.Error("清除乘客欠费标记失败", "error", result.Error, "user_open_ids", openIDs)
+		return
+	}
+	if result.RowsAffected > 0 {
+		log.Info("乘客已结清，清除欠费标记", "count", result.RowsAffected, "user_open_ids", openIDs)
+	}
+}
+
+// unpaidRemindOffsets 返回行程结束后发送付款提醒的时间点，按从小到大排列，忽略非正数
+func unpaidRemindOffsets() []time.Duration {
+	seconds := config.Get().Payment.UnpaidRemind
+	if len(seconds) == 0 {
+		seconds = defaultUnpaidRemind
+	}
+
+	offsets := make([]time.Duration, 0, len(seconds))
+	for _, second := range seconds {
+		if second > 0 {
+			offsets = append(offsets, time.Duration(second)*time.Second)
+		}
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	return offsets
+}
+
+// unpaidDeadline 返回行程结束后的付款期限
+func unpaidDeadline() time.Duration {
+	if deadline := config.Get().Payment.UnpaidDeadline; deadline > 0 {
+		return time.Duration(deadline) * time.Second
+	}
+	return defaultUnpaidDeadline
+}
+
+// unpaidCheckInterval 返回扫描未付款订单的间隔
+func unpaidCheckInterval() time.Duration {
+	if check := config.Get().Payment.UnpaidCheck; check > 0 {
+		return time.Duration(check) * time.Second
+	}
+	return defaultUnpaidCheck
+}
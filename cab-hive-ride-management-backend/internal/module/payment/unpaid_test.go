@@ -0,0 +1,44 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+)
+
+func TestCheckUnpaidOrdersUndeliverableReminder(t *testing.T) {
+	buf := setupTest(t)
+	orderModel := createUnpaidOrder(t, 32.5)
+
+	// 未配置付款提醒模板，提醒无法送达时记录提醒次数，不再每隔重试间隔重复发送
+	for _, tt := range []struct {
+		elapsed  time.Duration
+		expected int
+	}{
+		{elapsed: 15 * time.Minute, expected: 1},
+		{elapsed: 20 * time.Minute, expected: 1},
+		{elapsed: 2 * time.Hour, expected: 2},
+	} {
+		// 内存Redis的时间不会流逝，删除重试间隔键模拟间隔已过
+		redis.RedisClient.Del(context.Background(), fmt.Sprintf("%s%d", unpaidRemindKeyPrefix, orderModel.ID))
+		checkUnpaidOrders(orderModel.EndTime.Add(tt.elapsed))
+
+		var reloaded model.Order
+		reload(t, &reloaded, orderModel.ID)
+		if reloaded.PayRemindCount != tt.expected {
+			t.Errorf("行程结束%s后提醒次数 = %d，期望 %d", tt.elapsed, reloaded.PayRemindCount, tt.expected)
+		}
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte("无法发送付款提醒，本次不再重试")) {
+		t.Error("没有记录无法发送付款提醒")
+	}
+	if bytes.Contains(buf.Bytes(), []byte("已提醒乘客付款")) {
+		t.Error("提醒没有送达时不应记录已提醒乘客")
+	}
+}
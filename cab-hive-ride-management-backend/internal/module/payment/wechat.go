@@ -0,0 +1,519 @@
+package payment
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/httpclient"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// 微信支付 APIv3 的默认配置
+const (
+	defaultWeChatServerURL = "https://api.mch.weixin.qq.com"
+	wechatAuthSchema       = "WECHATPAY2-SHA256-RSA2048"
+	wechatMaxClockSkew     = 5 * time.Minute // 应答和通知的签名时间与服务器时间的最大偏差
+)
+
+// wechatProvider 微信支付小程序JSAPI支付
+// 按 APIv3 规范对请求签名，并使用微信支付公钥验证应答和通知的签名
+type wechatProvider struct {
+	cfg            config.WeChatPay
+	privateKey     *rsa.PrivateKey
+	platformKey    *rsa.PublicKey
+	platformSerial string
+}
+
+// wechatAmount 微信支付金额
+type wechatAmount struct {
+	Total    int64  `json:"total,omitempty"`
+	Refund   int64  `json:"refund,omitempty"`
+	Currency string `json:"currency,omitempty"`
+}
+
+// wechatTransaction 微信支付交易，查询订单应答和支付通知解密后的内容
+type wechatTransaction struct {
+	AppID         string       `json:"appid"`
+	MchID         string       `json:"mchid"`
+	OutTradeNo    string       `json:"out_trade_no"`
+	TransactionID string       `json:"transaction_id"`
+	TradeState    string       `json:"trade_state"`
+	SuccessTime   string       `json:"success_time"`
+	Amount        wechatAmount `json:"amount"`
+}
+
+// wechatRefund 微信支付退款应答
+type wechatRefund struct {
+	RefundID    string       `json:"refund_id"`
+	OutRefundNo string       `json:"out_refund_no"`
+	Status      string       `json:"status"`
+	Amount      wechatAmount `json:"amount"`
+}
+
+// result 转换为统一的退款结果
+func (r *wechatRefund) result() *RefundResult {
+	return &RefundResult{
+		OutRefundNo: r.OutRefundNo,
+		RefundNo:    r.RefundID,
+		Status:      wechatRefundStatus(r.Status),
+		RawStatus:   r.Status,
+		Amount:      r.Amount.Refund,
+	}
+}
+
+// wechatNotification 微信支付通知
+type wechatNotification struct {
+	ID        string `json:"id"`
+	EventType string `json:"event_type"`
+	Resource  struct {
+		Algorithm      string `json:"algorithm"`
+		Ciphertext     string `json:"ciphertext"`
+		AssociatedData string `json:"associated_data"`
+		Nonce          string `json:"nonce"`
+	} `json:"resource"`
+}
+
+// wechatError 微信支付接口错误应答
+type wechatError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+// Error 实现 error 接口
+func (e *wechatError) Error() string {
+	return fmt.Sprintf("微信支付接口返回错误: %d %s %s", e.StatusCode, e.Code, e.Message)
+}
+
+// newWeChatProvider 加载微信支付商户私钥和微信支付公钥，配置不完整时返回 nil
+func newWeChatProvider() *wechatProvider {
+	cfg := config.Get().Payment.WeChatPay
+	if cfg.AppID == "" {
+		cfg.AppID = config.Get().WeChat.AppID
+	}
+	if cfg.ServerURL == "" {
+		cfg.ServerURL = defaultWeChatServerURL
+	}
+
+	// 检查必要配置是否存在
+	if cfg.MchID == "" || cfg.SerialNo == "" || cfg.PrivateKey == "" || cfg.APIv3Key == "" || cfg.PlatformPublicKey == "" {
+		log.Warn("微信支付配置不完整，跳过初始化")
+		return nil
+	}
+	if len(cfg.APIv3Key) != 32 {
+		log.Error("微信支付APIv3密钥长度必须为32字节")
+		return nil
+	}
+
+	privateKey, err := parseRSAPrivateKey(cfg.PrivateKey)
+	if err != nil {
+		log.Error("加载微信支付商户私钥失败", "error", err)
+		return nil
+	}
+	platformKey, err := parseRSAPublicKey(cfg.PlatformPublicKey)
+	if err != nil {
+		log.Error("加载微信支付公钥失败", "error", err)
+		return nil
+	}
+
+	log.Info("微信支付客户端初始化成功")
+	return &wechatProvider{
+		cfg:            cfg,
+		privateKey:     privateKey,
+		platformKey:    platformKey,
+		platformSerial: cfg.PlatformSerial,
+	}
+}
+
+// Name 返回支付渠道名称
+func (p *wechatProvider) Name() string {
+	return ProviderWeChat
+}
+
+// SellerID 返回微信支付商户号
+func (p *wechatProvider) SellerID() string {
+	return p.cfg.MchID
+}
+
+// CreatePayment 创建JSAPI支付，返回小程序调用 wx.requestPayment 所需的参数
+func (p *wechatProvider) CreatePayment(ctx context.Context, req *CreateRequest) (*CreateResult, error) {
+	if req.PayerID == "" {
+		return nil, errors.New("微信支付需要付款用户的OpenID")
+	}
+
+	body := map[string]interface{}{
+		"appid":        p.cfg.AppID,
+		"mchid":        p.cfg.MchID,
+		"description":  req.Subject,
+		"out_trade_no": req.OutTradeNo,
+		"notify_url":   p.cfg.NotifyURL,
+		"amount":       wechatAmount{Total: req.Amount, Currency: "CNY"},
+		"payer":        map[string]string{"openid": req.PayerID},
+	}
+	if req.ClientIP != "" {
+		body["scene_info"] = map[string]string{"payer_client_ip": req.ClientIP}
+	}
+
+	var result struct {
+		PrepayID string `json:"prepay_id"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/v3/pay/transactions/jsapi", body, &result); err != nil {
+		return nil, err
+	}
+
+	// 生成小程序调起支付的签名
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := nonceStr()
+	if err != nil {
+		return nil, err
+	}
+	pkg := "prepay_id=" + result.PrepayID
+	paySign, err := p.sign(p.cfg.AppID + "\n" + timestamp + "\n" + nonce + "\n" + pkg + "\n")
+	if err != nil {
+		return nil, err
+	}
+	return &CreateResult{PayParams: map[string]string{
+		"appId":     p.cfg.AppID,
+		"timeStamp": timestamp,
+		"nonceStr":  nonce,
+		"package":   pkg,
+		"signType":  "RSA",
+		"paySign":   paySign,
+	}}, nil
+}
+
+// QueryPayment 按商户订单号查询交易
+func (p *wechatProvider) QueryPayment(ctx context.Context, outTradeNo string) (*TradeResult, error) {
+	path := "/v3/pay/transactions/out-trade-no/" + url.PathEscape(outTradeNo) + "?mchid=" + url.QueryEscape(p.cfg.MchID)
+
+	var transaction wechatTransaction
+	if err := p.do(ctx, http.MethodGet, path, nil, &transaction); err != nil {
+		return nil, err
+	}
+	return &TradeResult{
+		OutTradeNo: transaction.OutTradeNo,
+		TradeNo:    transaction.TransactionID,
+		Status:     wechatTradeStatus(transaction.TradeState),
+		RawStatus:  transaction.TradeState,
+		Amount:     transaction.Amount.Total,
+		PaidAt:     parseWeChatTime(transaction.SuccessTime),
+	}, nil
+}
+
+// Refund 发起退款，微信支付退款通常为处理中，需要之后查询结果
+func (p *wechatProvider) Refund(ctx context.Context, req *RefundRequest) (*RefundResult, error) {
+	body := map[string]interface{}{
+		"out_trade_no":  req.OutTradeNo,
+		"out_refund_no": req.OutRefundNo,
+		"reason":        req.Reason,
+		"amount":        wechatAmount{Refund: req.Amount, Total: req.TotalAmount, Currency: "CNY"},
+	}
+
+	var refund wechatRefund
+	if err := p.do(ctx, http.MethodPost, "/v3/refund/domestic/refunds", body, &refund); err != nil {
+		if errors.Is(err, ErrTradeNotFound) {
+			return &RefundResult{OutRefundNo: req.OutRefundNo, Status: RefundStatusFailed, Amount: req.Amount, Message: err.Error()}, nil
+		}
+		// 4XX 应答表示微信支付拒绝退款，例如余额不足或超过可退金额
+		var wechatErr *wechatError
+		if errors.As(err, &wechatErr) && wechatErr.StatusCode < http.StatusInternalServerError {
+			return &RefundResult{
+				OutRefundNo: req.OutRefundNo,
+				Status:      RefundStatusFailed,
+				RawStatus:   wechatErr.Code,
+				Amount:      req.Amount,
+				Message:     wechatErr.Message,
+			}, nil
+		}
+		return nil, err
+	}
+	return refund.result(), nil
+}
+
+// QueryRefund 按商户退款单号查询退款
+func (p *wechatProvider) QueryRefund(ctx context.Context, outTradeNo, outRefundNo string) (*RefundResult, error) {
+	var refund wechatRefund
+	if err := p.do(ctx, http.MethodGet, "/v3/refund/domestic/refunds/"+url.PathEscape(outRefundNo), nil, &refund); err != nil {
+		if errors.Is(err, ErrTradeNotFound) {
+			return nil, ErrRefundNotFound
+		}
+		return nil, err
+	}
+	return refund.result(), nil
+}
+
+// VerifyNotification 校验微信支付通知的签名并解密通知内容
+func (p *wechatProvider) VerifyNotification(r *http.Request) (*Notification, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.verify(r.Header, body); err != nil {
+		return nil, err
+	}
+
+	var notification wechatNotification
+	if err := json.Unmarshal(body, &notification); err != nil {
+		return nil, errors.Wrap(err, "解析微信支付通知失败")
+	}
+	if notification.Resource.Algorithm != "AEAD_AES_256_GCM" {
+		return nil, errors.Errorf("不支持的通知加密算法: %s", notification.Resource.Algorithm)
+	}
+	plaintext, err := p.decrypt(notification.Resource.Ciphertext, notification.Resource.Nonce, notification.Resource.AssociatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	var transaction wechatTransaction
+	if err := json.Unmarshal(plaintext, &transaction); err != nil {
+		return nil, errors.Wrap(err, "解析微信支付通知内容失败")
+	}
+	return &Notification{
+		Provider:   ProviderWeChat,
+		OutTradeNo: transaction.OutTradeNo,
+		TradeNo:    transaction.TransactionID,
+		Status:     wechatTradeStatus(transaction.TradeState),
+		RawStatus:  transaction.TradeState,
+		Amount:     transaction.Amount.Total,
+		SellerID:   transaction.MchID,
+		PaidAt:     parseWeChatTime(transaction.SuccessTime),
+		Raw:        string(plaintext),
+	}, nil
+}
+
+// AckNotification 应答微信支付通知，处理失败时返回错误码，微信支付会重新发送通知
+func (p *wechatProvider) AckNotification(c *gin.Context, err error) {
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, wechatError{Code: "FAIL", Message: "失败"})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// do 发送签名的 APIv3 请求，验证应答签名并解析应答内容
+func (p *wechatProvider) do(ctx context.Context, method, path string, body interface{}, result interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	authorization, err := p.authorization(method, path, payload)
+	if err != nil {
+		return err
+	}
+	req := httpclient.Client.R().
+		SetContext(ctx).
+		SetHeader("Authorization", authorization).
+		SetHeader("Accept", "application/json")
+	if payload != nil {
+		req.SetHeader("Content-Type", "application/json").SetBody(payload)
+	}
+
+	resp, err := req.Execute(method, p.cfg.ServerURL+path)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() == http.StatusNotFound {
+		return ErrTradeNotFound
+	}
+	if resp.StatusCode() >= http.StatusMultipleChoices {
+		wechatErr := &wechatError{StatusCode: resp.StatusCode()}
+		_ = json.Unmarshal(resp.Body(), wechatErr)
+		return wechatErr
+	}
+	if err := p.verify(resp.Header(), resp.Body()); err != nil {
+		return errors.Wrap(err, "微信支付应答签名验证失败")
+	}
+	if result != nil && len(resp.Body()) > 0 {
+		return json.Unmarshal(resp.Body(), result)
+	}
+	return nil
+}
+
+// authorization 生成 APIv3 请求的 Authorization 头
+func (p *wechatProvider) authorization(method, path string, payload []byte) (string, error) {
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonce, err := nonceStr()
+	if err != nil {
+		return "", err
+	}
+	signature, err := p.sign(method + "\n" + path + "\n" + timestamp + "\n" + nonce + "\n" + string(payload) + "\n")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(`%s mchid="%s",nonce_str="%s",signature="%s",timestamp="%s",serial_no="%s"`,
+		wechatAuthSchema, p.cfg.MchID, nonce, signature, timestamp, p.cfg.SerialNo), nil
+}
+
+// sign 使用商户私钥对内容做 SHA256-RSA 签名，返回Base64编码的签名
+func (p *wechatProvider) sign(message string) (string, error) {
+	hashed := sha256.Sum256([]byte(message))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// verify 使用微信支付公钥验证应答或通知的签名
+func (p *wechatProvider) verify(header http.Header, body []byte) error {
+	timestamp := header.Get("Wechatpay-Timestamp")
+	nonce := header.Get("Wechatpay-Nonce")
+	signature := header.Get("Wechatpay-Signature")
+	serial := header.Get("Wechatpay-Serial")
+	if timestamp == "" || nonce == "" || signature == "" {
+		return errors.New("缺少微信支付签名")
+	}
+	if p.platformSerial != "" && serial != p.platformSerial {
+		return errors.Errorf("微信支付公钥ID不匹配: %s", serial)
+	}
+
+	// 拒绝签名时间偏差过大的请求，防止重放
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.Wrap(err, "微信支付签名时间格式错误")
+	}
+	if skew := time.Since(time.Unix(seconds, 0)); skew > wechatMaxClockSkew || skew < -wechatMaxClockSkew {
+		return errors.New("微信支付签名已过期")
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return errors.Wrap(err, "微信支付签名格式错误")
+	}
+	hashed := sha256.Sum256([]byte(timestamp + "\n" + nonce + "\n" + string(body) + "\n"))
+	return rsa.VerifyPKCS1v15(p.platformKey, crypto.SHA256, hashed[:], decoded)
+}
+
+// decrypt 使用APIv3密钥解密通知内容
+func (p *wechatProvider) decrypt(ciphertext, nonce, associatedData string) ([]byte, error) {
+	decoded, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil {
+		return nil, errors.Wrap(err, "微信支付通知密文格式错误")
+	}
+	block, err := aes.NewCipher([]byte(p.cfg.APIv3Key))
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := gcm.Open(nil, []byte(nonce), decoded, []byte(associatedData))
+	if err != nil {
+		return nil, errors.Wrap(err, "解密微信支付通知失败")
+	}
+	return plaintext, nil
+}
+
+// wechatTradeStatus 将微信支付交易状态转换为统一的交易状态
+func wechatTradeStatus(state string) TradeStatus {
+	switch state {
+	case "SUCCESS":
+		return TradeStatusSuccess
+	case "REFUND":
+		return TradeStatusRefunded
+	case "CLOSED", "REVOKED":
+		return TradeStatusClosed
+	case "PAYERROR":
+		return TradeStatusFailed
+	default:
+		return TradeStatusPending
+	}
+}
+
+// wechatRefundStatus 将微信支付退款状态转换为统一的退款状态
+func wechatRefundStatus(status string) RefundStatus {
+	switch status {
+	case "SUCCESS":
+		return RefundStatusSuccess
+	case "CLOSED", "ABNORMAL":
+		return RefundStatusFailed
+	default:
+		return RefundStatusPending
+	}
+}
+
+// parseWeChatTime 解析微信支付返回的 RFC3339 时间，解析失败时返回零值
+func parseWeChatTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// nonceStr 生成32位随机字符串
+func nonceStr() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return strings.ToUpper(hex.EncodeToString(buf)), nil
+}
+
+// parseRSAPrivateKey 解析PEM格式的RSA私钥，支持 PKCS#8 和 PKCS#1
+func parseRSAPrivateKey(key string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil {
+		return nil, errors.New("私钥不是有效的PEM格式")
+	}
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		privateKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("私钥不是RSA私钥")
+		}
+		return privateKey, nil
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+// parseRSAPublicKey 解析PEM格式的RSA公钥，支持微信支付公钥和平台证书
+func parseRSAPublicKey(key string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(key)))
+	if block == nil {
+		return nil, errors.New("公钥不是有效的PEM格式")
+	}
+
+	var parsed interface{}
+	if block.Type == "CERTIFICATE" {
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		parsed = certificate.PublicKey
+	} else {
+		var err error
+		if parsed, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+
+	publicKey, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("公钥不是RSA公钥")
+	}
+	return publicKey, nil
+}
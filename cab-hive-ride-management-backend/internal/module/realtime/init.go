@@ -0,0 +1,24 @@
+package realtime
+
+import (
+	"cab-hive/internal/global/logger"
+	"log/slog"
+)
+
+var log *slog.Logger
+
+// ModuleRealtime 实时推送模块结构体
+type ModuleRealtime struct{}
+
+// GetName 获取模块名称
+func (m *ModuleRealtime) GetName() string {
+	return "realtime"
+}
+
+// Init 初始化实时推送模块
+func (m *ModuleRealtime) Init() {
+	log = logger.New("realtime")
+
+	// 订阅Redis中的订单事件，转发给本实例的客户端
+	go defaultHub.run()
+}
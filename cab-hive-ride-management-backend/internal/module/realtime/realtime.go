@@ -0,0 +1,260 @@
+package realtime
+
+import (
+	"cab-hive/internal/global/redis"
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// orderChannelBase 订单事件的Redis发布订阅频道前缀，完整频道为 order_events:<订单ID>
+const orderChannelBase = "order_events:"
+
+// userChannelBase 只推送给订单一方的事件的Redis发布订阅频道前缀，完整频道为 user_events:<OpenID>
+const userChannelBase = "user_events:"
+
+// adminAlertChannel 管理员告警队列的Redis发布订阅频道
+const adminAlertChannel = "admin_alerts"
+
+// subscriberBuffer 每个客户端缓冲的事件数量，客户端处理过慢时丢弃新事件
+const subscriberBuffer = 16
+
+// 订单事件类型
+const (
+	EventStatus   = "status"   // 订单状态变更
+	EventLocation = "location" // 承接订单的司机位置更新
+	EventAlert    = "alert"    // 订单安全告警
+	EventDispatch = "dispatch" // 订单派单进度变更
+)
+
+// Event 定义推送给客户端的订单事件
+type Event struct {
+	Type    string      `json:"type"`
+	OrderID uint        `json:"order_id"`
+	Data    interface{} `json:"data"`
+	Time    int64       `json:"time"`
+}
+
+// StatusData 定义订单状态变更事件的内容
+type StatusData struct {
+	From         string `json:"from"`
+	To           string `json:"to"`
+	ActorRole    string `json:"actor_role"`
+	Reason       string `json:"reason"`
+	DriverOpenID string `json:"driver_open_id"`
+}
+
+// LocationData 定义司机位置更新事件的内容
+type LocationData struct {
+	DriverOpenID string  `json:"driver_open_id"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	UpdateTime   int64   `json:"update_time"`
+}
+
+// AlertData 定义安全告警事件的内容
+// 紧急求助事件的 Type 为 sos，此时 AlertID 为空，IncidentID 为紧急求助事件ID
+type AlertData struct {
+	AlertID      uint    `json:"alert_id,omitempty"`
+	IncidentID   uint    `json:"incident_id,omitempty"`
+	Type         string  `json:"type"`
+	Priority     string  `json:"priority,omitempty"`
+	Status       string  `json:"status"`
+	DriverOpenID string  `json:"driver_open_id"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Message      string  `json:"message"`
+}
+
+// DispatchData 定义派单进度事件的内容
+type DispatchData struct {
+	Status    string `json:"status"`
+	Rounds    int    `json:"rounds"`
+	MaxRounds int    `json:"max_rounds"`
+	Message   string `json:"message"`
+}
+
+// message 定义从Redis收到的订单事件
+type message struct {
+	Type string
+	Data string
+}
+
+// hub 管理本实例中订阅订单事件的客户端
+// 所有实例都通过Redis发布订阅接收订单事件，再转发给本实例的客户端
+type hub struct {
+	mu          sync.RWMutex
+	subscribers map[uint]map[chan message]string // 订阅订单事件的客户端及其OpenID
+	admins      map[chan message]struct{}        // 订阅告警队列的管理员
+}
+
+// defaultHub 本实例的订单事件分发器
+var defaultHub = &hub{
+	subscribers: make(map[uint]map[chan message]string),
+	admins:      make(map[chan message]struct{}),
+}
+
+// PublishStatus 发布订单状态变更事件
+func PublishStatus(orderID uint, data StatusData) error {
+	return publish(orderID, EventStatus, data)
+}
+
+// PublishLocation 发布承接订单的司机位置更新事件
+func PublishLocation(orderID uint, data LocationData) error {
+	return publish(orderID, EventLocation, data)
+}
+
+// PublishDispatch 发布订单派单进度事件，目前只在达到最大派单轮次仍无司机接单时推送给乘客
+func PublishDispatch(orderID uint, data DispatchData) error {
+	return publish(orderID, EventDispatch, data)
+}
+
+// PublishAlert 发布订单安全告警事件
+// 告警同时推送给订阅该订单的乘客和司机，以及订阅告警队列的管理员
+func PublishAlert(orderID uint, data AlertData) error {
+	if err := publish(orderID, EventAlert, data); err != nil {
+		return err
+	}
+	return PublishAdminAlert(orderID, data)
+}
+
+// PublishAdminAlert 发布只推送给订阅告警队列的管理员的告警事件
+func PublishAdminAlert(orderID uint, data AlertData) error {
+	return publishChannel(adminAlertChannel, orderID, EventAlert, data)
+}
+
+// PublishIncident 发布紧急求助事件
+// 只推送给订阅告警队列的管理员和订阅该订单的发起人，订单的另一方收不到
+func PublishIncident(orderID uint, reporterOpenID string, data AlertData) error {
+	if err := publishChannel(userChannelBase+reporterOpenID, orderID, EventAlert, data); err != nil {
+		return err
+	}
+	return PublishAdminAlert(orderID, data)
+}
+
+// publish 将订单事件发布到Redis，由各实例转发给订阅该订单的客户端
+func publish(orderID uint, eventType string, data interface{}) error {
+	return publishChannel(orderChannelBase+strconv.FormatUint(uint64(orderID), 10), orderID, eventType, data)
+}
+
+// publishChannel 将订单事件发布到Redis的指定频道
+func publishChannel(channel string, orderID uint, eventType string, data interface{}) error {
+	payload, err := json.Marshal(Event{
+		Type:    eventType,
+		OrderID: orderID,
+		Data:    data,
+		Time:    time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return redis.RedisClient.Publish(context.Background(), channel, payload).Err()
+}
+
+// subscribe 订阅订单事件，openID 为订阅的用户，用于接收只推送给该用户的事件
+func (h *hub) subscribe(orderID uint, openID string) chan message {
+	ch := make(chan message, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[orderID] == nil {
+		h.subscribers[orderID] = make(map[chan message]string)
+	}
+	h.subscribers[orderID][ch] = openID
+	return ch
+}
+
+// unsubscribe 取消订阅订单事件
+func (h *hub) unsubscribe(orderID uint, ch chan message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subscribers[orderID], ch)
+	if len(h.subscribers[orderID]) == 0 {
+		delete(h.subscribers, orderID)
+	}
+}
+
+// subscribeAdmin 订阅管理员告警队列
+func (h *hub) subscribeAdmin() chan message {
+	ch := make(chan message, subscriberBuffer)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.admins[ch] = struct{}{}
+	return ch
+}
+
+// unsubscribeAdmin 取消订阅管理员告警队列
+func (h *hub) unsubscribeAdmin(ch chan message) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.admins, ch)
+}
+
+// broadcastAdmins 将告警转发给本实例中订阅告警队列的管理员
+func (h *hub) broadcastAdmins(msg message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.admins {
+		select {
+		case ch <- msg:
+		default:
+			log.Warn("管理员处理告警过慢，丢弃告警")
+		}
+	}
+}
+
+// broadcast 将订单事件转发给本实例中订阅该订单的客户端，openID 不为空时只转发给该用户
+// 客户端缓冲已满时丢弃该事件，避免单个慢客户端阻塞其他客户端
+func (h *hub) broadcast(orderID uint, openID string, msg message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch, subscriber := range h.subscribers[orderID] {
+		if openID != "" && subscriber != openID {
+			continue
+		}
+		select {
+		case ch <- msg:
+		default:
+			log.Warn("客户端处理订单事件过慢，丢弃事件", "order_id", orderID, "type", msg.Type)
+		}
+	}
+}
+
+// run 订阅Redis中所有订单事件频道、用户事件频道和管理员告警频道，并转发给本实例的客户端
+// 连接断开时由Redis客户端自动重新订阅
+func (h *hub) run() {
+	pubsub := redis.RedisClient.PSubscribe(context.Background(), orderChannelBase+"*", userChannelBase+"*", adminAlertChannel)
+	defer pubsub.Close()
+
+	for redisMsg := range pubsub.Channel() {
+		if redisMsg.Channel == adminAlertChannel {
+			h.broadcastAdmins(message{Type: EventAlert, Data: redisMsg.Payload})
+			continue
+		}
+
+		var event struct {
+			Type    string `json:"type"`
+			OrderID uint   `json:"order_id"`
+		}
+		if err := json.Unmarshal([]byte(redisMsg.Payload), &event); err != nil {
+			log.Error("解析订单事件失败", "error", err, "channel", redisMsg.Channel)
+			continue
+		}
+
+		// 用户事件只转发给该用户对订单的订阅
+		if strings.HasPrefix(redisMsg.Channel, userChannelBase) {
+			h.broadcast(event.OrderID, strings.TrimPrefix(redisMsg.Channel, userChannelBase), message{Type: event.Type, Data: redisMsg.Payload})
+			continue
+		}
+
+		orderID, err := strconv.ParseUint(strings.TrimPrefix(redisMsg.Channel, orderChannelBase), 10, 64)
+		if err != nil {
+			continue
+		}
+		h.broadcast(uint(orderID), "", message{Type: event.Type, Data: redisMsg.Payload})
+	}
+}
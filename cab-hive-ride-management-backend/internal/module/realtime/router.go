@@ -0,0 +1,18 @@
+package realtime
+
+import (
+	"cab-hive/internal/global/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitRouter 初始化实时推送模块的路由
+func (m *ModuleRealtime) InitRouter(r *gin.RouterGroup) {
+	// 订阅订单实时事件（SSE）
+	// 需要用户认证，乘客、承接订单的司机和管理员可以订阅
+	r.GET("/realtime/orders/:id", middleware.Auth(1), SubscribeOrder)
+
+	// 订阅管理员告警队列（SSE）
+	// 需要管理员认证
+	r.GET("/realtime/alerts", middleware.Auth(3), SubscribeAlerts)
+}
@@ -0,0 +1,174 @@
+package realtime
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"encoding/json"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// keepaliveInterval 连接空闲时发送心跳事件的间隔，防止代理断开空闲连接
+const keepaliveInterval = 15 * time.Second
+
+// SubscribeOrder 处理订阅订单实时事件的请求
+// 使用 Server-Sent Events 推送订单状态变更和承接司机的位置，
+// 连接建立后先推送一次订单当前状态，订单完成或取消后关闭连接
+func SubscribeOrder(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 查找订单，非管理员只能订阅自己的订单或自己承接的订单
+	query := database.DB.Where("id = ?", c.Param("id"))
+	if payload.RoleID != 3 {
+		query = query.Where("(user_open_id = ? OR driver_open_id = ?)", payload.OpenID, payload.OpenID)
+	}
+	var orderModel model.Order
+	if err := query.First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 管理员订阅他人的订单可以看到司机实时位置，需要填写原因并记录审计
+	if payload.RoleID == 3 && orderModel.UserOpenID != payload.OpenID && orderModel.DriverOpenID != payload.OpenID {
+		reason := strings.TrimSpace(c.Query("reason"))
+		if reason == "" {
+			response.Fail(c, response.ErrInvalidRequest.WithTips("管理员订阅订单需要填写原因"))
+			return
+		}
+		if err := database.DB.Create(&model.LocationAudit{
+			AdminOpenID:  payload.OpenID,
+			DriverOpenID: orderModel.DriverOpenID,
+			OrderID:      orderModel.ID,
+			Source:       model.LocationAuditSourceRealtime,
+			Reason:       reason,
+			ClientIP:     c.ClientIP(),
+		}).Error; err != nil {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+			return
+		}
+		log.Warn("管理员订阅订单实时事件", "admin_open_id", payload.OpenID, "order_id", orderModel.ID, "reason", reason)
+	}
+
+	// 先订阅再读取订单当前状态，避免遗漏两者之间发生的状态变更
+	ch := defaultHub.subscribe(orderModel.ID, payload.OpenID)
+	defer defaultHub.unsubscribe(orderModel.ID, ch)
+	if err := database.DB.First(&orderModel, orderModel.ID).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	snapshot, _ := json.Marshal(Event{
+		Type:    EventStatus,
+		OrderID: orderModel.ID,
+		Data:    StatusData{To: orderModel.Status, DriverOpenID: orderModel.DriverOpenID},
+		Time:    time.Now().Unix(),
+	})
+	c.SSEvent(EventStatus, string(snapshot))
+	c.Writer.Flush()
+	if isFinished(orderModel.Status) {
+		return
+	}
+
+	log.Info("客户端订阅订单事件", "order_id", orderModel.ID, "open_id", payload.OpenID)
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepalive.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case msg := <-ch:
+			c.SSEvent(msg.Type, msg.Data)
+			// 订单完成或取消后不会再有新事件，关闭连接
+			if msg.Type == EventStatus {
+				var event struct {
+					Data StatusData `json:"data"`
+				}
+				if err := json.Unmarshal([]byte(msg.Data), &event); err == nil && isFinished(event.Data.To) {
+					return false
+				}
+			}
+			return true
+		}
+	})
+	log.Info("客户端取消订阅订单事件", "order_id", orderModel.ID, "open_id", payload.OpenID)
+}
+
+// isFinished 判断订单是否已完成或已取消
+func isFinished(status string) bool {
+	return status == model.OrderStatusCompleted || status == model.OrderStatusCancelled
+}
+
+// SubscribeAlerts 处理管理员订阅告警队列的请求
+// 使用 Server-Sent Events 推送所有订单的安全告警，未处理的告警请通过告警列表查询
+func SubscribeAlerts(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	ch := defaultHub.subscribeAdmin()
+	defer defaultHub.unsubscribeAdmin(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Writer.Flush()
+
+	log.Info("管理员订阅告警队列", "open_id", payload.OpenID)
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-keepalive.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case msg := <-ch:
+			c.SSEvent(msg.Type, msg.Data)
+			return true
+		}
+	})
+	log.Info("管理员取消订阅告警队列", "open_id", payload.OpenID)
+}
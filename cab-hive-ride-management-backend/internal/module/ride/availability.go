@@ -0,0 +1,394 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 司机在线状态使用的Redis键
+const (
+	driverOnlineKeyBase = "driver:online:"           // 司机在线信息前缀
+	driverHeartbeatKey  = "drivers:heartbeat"        // 在线司机最近心跳时间的有序集合
+	driverIdleGeoKey    = "drivers:idle_by_location" // 在线空闲司机的地理位置索引
+)
+
+// 心跳检测默认配置
+const (
+	defaultHeartbeatTimeout       = 90 * time.Second // 超过该时间没有心跳自动下线
+	defaultHeartbeatCheckInterval = 30 * time.Second // 心跳检测间隔
+)
+
+// DriverStatus 定义司机在线信息结构体
+type DriverStatus struct {
+	OpenID        string `json:"open_id"`
+	VehicleID     uint   `json:"vehicle_id"`
+	OnlineTime    int64  `json:"online_time"`
+	LastHeartbeat int64  `json:"last_heartbeat"`
+	IdleSince     int64  `json:"idle_since"` // 最近一次进入空闲状态的时间，有进行中订单时为0
+}
+
+// GoOnlineRequest 定义司机上线请求的结构体
+type GoOnlineRequest struct {
+	VehicleID uint    `json:"vehicle_id" binding:"required"`
+	Latitude  float64 `json:"latitude" binding:"required"`
+	Longitude float64 `json:"longitude" binding:"required"`
+}
+
+// DriverStatusResponse 定义司机在线状态响应的结构体
+type DriverStatusResponse struct {
+	Online        bool    `json:"online"`
+	Idle          bool    `json:"idle"`
+	VehicleID     uint    `json:"vehicle_id"`
+	OnlineTime    *string `json:"online_time"`
+	LastHeartbeat *string `json:"last_heartbeat"`
+}
+
+// GoOnline 处理司机上线接单的请求
+// 只有审核通过且未被封禁的司机，使用本人名下审核通过的车辆才能上线
+func GoOnline(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req GoOnlineRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 检查司机资质和车辆
+	if err := checkDriverVehicle(payload.OpenID, req.VehicleID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 保存司机位置
+	now := time.Now()
+	location := DriverLocation{
+		OpenID:     payload.OpenID,
+		Latitude:   req.Latitude,
+		Longitude:  req.Longitude,
+		UpdateTime: now.Unix(),
+	}
+	if err := saveDriverLocation(location); err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	// 记录在线信息
+	status := DriverStatus{
+		OpenID:        payload.OpenID,
+		VehicleID:     req.VehicleID,
+		OnlineTime:    now.Unix(),
+		LastHeartbeat: now.Unix(),
+	}
+
+	// 没有进行中订单的司机加入空闲司机索引
+	idle, err := refreshDriverAvailability(location)
+	if err != nil {
+		log.Error("更新空闲司机索引失败", "error", err, "driver_open_id", payload.OpenID)
+	}
+	if idle {
+		status.IdleSince = now.Unix()
+	}
+
+	if err := saveDriverStatus(status); err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机上线", "driver_open_id", payload.OpenID, "vehicle_id", req.VehicleID)
+	response.Success(c, newDriverStatusResponse(&status))
+}
+
+// GoOffline 处理司机下线的请求
+func GoOffline(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	if err := SetDriverOffline(payload.OpenID); err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机下线", "driver_open_id", payload.OpenID)
+	response.Success(c, newDriverStatusResponse(nil))
+}
+
+// GetDriverStatus 处理司机查询自己在线状态的请求
+func GetDriverStatus(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	status, err := getDriverStatus(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, newDriverStatusResponse(status))
+}
+
+// checkDriverVehicle 检查司机是否审核通过且未被封禁，车辆是否属于该司机且审核通过
+// 司机上线和认领预约订单时调用，不满足条件时返回业务错误
+func checkDriverVehicle(driverOpenID string, vehicleID uint) error {
+	var driver model.Driver
+	if err := database.DB.Where("open_id = ?", driverOpenID).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.ErrNotFound.WithTips("司机信息不存在")
+		}
+		return response.ErrDatabase.WithOrigin(err)
+	}
+	if driver.Status != "approved" {
+		log.Warn("司机状态不允许接单", "driver_open_id", driverOpenID, "status", driver.Status)
+		return response.ErrForbidden.WithTips("司机未审核通过或已被封禁")
+	}
+
+	var vehicle model.Vehicle
+	if err := database.DB.Where("id = ? AND driver_id = ? AND status = ?", vehicleID, driverOpenID, "approved").First(&vehicle).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return response.ErrNotFound.WithTips("车辆不存在或不属于该司机或未审核通过")
+		}
+		return response.ErrDatabase.WithOrigin(err)
+	}
+	return nil
+}
+
+// saveDriverStatus 保存司机在线信息并记录心跳时间
+func saveDriverStatus(status DriverStatus) error {
+	statusJSON, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := redis.RedisClient.TxPipeline()
+	pipe.Set(ctx, driverOnlineKeyBase+status.OpenID, statusJSON, 0)
+	pipe.ZAdd(ctx, driverHeartbeatKey, go_redis.Z{Score: float64(status.LastHeartbeat), Member: status.OpenID})
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// getDriverStatus 获取司机在线信息，司机不在线时返回nil
+func getDriverStatus(driverOpenID string) (*DriverStatus, error) {
+	ctx := context.Background()
+	statusJSON, err := redis.RedisClient.Get(ctx, driverOnlineKeyBase+driverOpenID).Result()
+	if err != nil {
+		if errors.Is(err, go_redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var status DriverStatus
+	if err := json.Unmarshal([]byte(statusJSON), &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SetDriverOffline 将司机设置为离线，并从心跳集合和空闲司机索引中移除
+// 司机主动下线、心跳超时和司机被封禁时调用
+func SetDriverOffline(driverOpenID string) error {
+	ctx := context.Background()
+	pipe := redis.RedisClient.TxPipeline()
+	pipe.Del(ctx, driverOnlineKeyBase+driverOpenID)
+	pipe.ZRem(ctx, driverHeartbeatKey, driverOpenID)
+	pipe.ZRem(ctx, driverIdleGeoKey, driverOpenID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// recordHeartbeat 记录在线司机的心跳，司机不在线时不做处理
+// 司机上传位置即视为一次心跳
+func recordHeartbeat(location DriverLocation) error {
+	status, err := getDriverStatus(location.OpenID)
+	if err != nil || status == nil {
+		return err
+	}
+
+	idle, err := refreshDriverAvailability(location)
+	if err != nil {
+		return err
+	}
+
+	// 记录司机进入空闲状态的时间，派单时据此计算空闲时长
+	status.LastHeartbeat = location.UpdateTime
+	if !idle {
+		status.IdleSince = 0
+	} else if status.IdleSince == 0 {
+		status.IdleSince = location.UpdateTime
+	}
+	return saveDriverStatus(*status)
+}
+
+// refreshDriverAvailability 根据司机是否有进行中的订单维护空闲司机索引，返回司机是否空闲
+func refreshDriverAvailability(location DriverLocation) (bool, error) {
+	activeOrder, err := getDriverActiveOrder(location.OpenID)
+	if err != nil {
+		return false, err
+	}
+	if activeOrder != nil {
+		return false, markDriverBusy(location.OpenID)
+	}
+
+	ctx := context.Background()
+	err = redis.RedisClient.GeoAdd(ctx, driverIdleGeoKey, &go_redis.GeoLocation{
+		Name:      location.OpenID,
+		Longitude: location.Longitude,
+		Latitude:  location.Latitude,
+	}).Err()
+	return err == nil, err
+}
+
+// markDriverBusy 将司机从空闲司机索引中移除，司机接单后调用
+func markDriverBusy(driverOpenID string) error {
+	return redis.RedisClient.ZRem(context.Background(), driverIdleGeoKey, driverOpenID).Err()
+}
+
+// isDriverIdle 判断司机是否在空闲司机索引中
+func isDriverIdle(driverOpenID string) bool {
+	positions, err := redis.RedisClient.GeoPos(context.Background(), driverIdleGeoKey, driverOpenID).Result()
+	return err == nil && len(positions) > 0 && positions[0] != nil
+}
+
+// isDriverOnline 判断司机是否在线
+func isDriverOnline(driverOpenID string) (bool, error) {
+	status, err := getDriverStatus(driverOpenID)
+	return status != nil, err
+}
+
+// heartbeatTimeout 获取心跳超时时间
+func heartbeatTimeout() time.Duration {
+	if timeout := config.Get().Dispatch.HeartbeatTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defaultHeartbeatTimeout
+}
+
+// heartbeatCheckInterval 获取心跳检测间隔
+func heartbeatCheckInterval() time.Duration {
+	if interval := config.Get().Dispatch.HeartbeatCheckInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return defaultHeartbeatCheckInterval
+}
+
+// watchHeartbeats 定期将超过心跳超时时间未上报位置的司机设置为离线
+// 下线操作是幂等的，多个实例同时运行不会产生冲突
+func watchHeartbeats() {
+	ticker := time.NewTicker(heartbeatCheckInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := expireStaleDrivers(); err != nil {
+			log.Error("检测司机心跳失败", "error", err)
+		}
+	}
+}
+
+// expireStaleDrivers 将心跳超时的司机设置为离线
+func expireStaleDrivers() error {
+	ctx := context.Background()
+	deadline := time.Now().Add(-heartbeatTimeout()).Unix()
+
+	staleDrivers, err := redis.RedisClient.ZRangeByScore(ctx, driverHeartbeatKey, &go_redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(deadline, 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, driverOpenID := range staleDrivers {
+		if err := SetDriverOffline(driverOpenID); err != nil {
+			log.Error("司机心跳超时下线失败", "error", err, "driver_open_id", driverOpenID)
+			continue
+		}
+		log.Info("司机心跳超时，自动下线", "driver_open_id", driverOpenID)
+	}
+	return nil
+}
+
+// newDriverStatusResponse 将司机在线信息转换为响应格式
+func newDriverStatusResponse(status *DriverStatus) DriverStatusResponse {
+	if status == nil {
+		return DriverStatusResponse{}
+	}
+
+	formatUnix := func(ts int64) *string {
+		formatted := time.Unix(ts, 0).Format("2006/01/02 15:04:05")
+		return &formatted
+	}
+	return DriverStatusResponse{
+		Online:        true,
+		Idle:          isDriverIdle(status.OpenID),
+		VehicleID:     status.VehicleID,
+		OnlineTime:    formatUnix(status.OnlineTime),
+		LastHeartbeat: formatUnix(status.LastHeartbeat),
+	}
+}
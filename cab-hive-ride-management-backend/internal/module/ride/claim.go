@@ -0,0 +1,559 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/global/wechat"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 预约订单认领默认配置
+const (
+	defaultClaimHorizon        = 48 * time.Hour   // 司机可以认领多久以内的预约订单
+	defaultClaimBuffer         = 30 * time.Minute // 同一司机认领的两个预约订单之间至少间隔的时间
+	defaultCancelPenaltyWindow = 2 * time.Hour    // 距预约时间不超过该值时放弃认领计为违约
+	defaultPenaltyLimit        = 3                // 统计周期内违约次数上限
+	defaultPenaltyDays         = 30               // 违约次数的统计周期（天）
+	defaultRemindBefore        = 30 * time.Minute // 距预约时间不超过该值时提醒认领的司机上线
+	defaultReservationRadius   = 10.0             // 浏览预约订单的默认半径（公里）
+	maxReservationRadius       = 50.0             // 浏览预约订单的最大半径（公里）
+)
+
+// 预约订单提醒发送失败时的重试配置
+const (
+	claimRemindKeyPrefix = "reservation:remind:" // 提醒重试间隔键前缀，后接认领ID
+	claimRemindRetry     = 5 * time.Minute       // 提醒发送失败后的重试间隔
+)
+
+// ClaimReservationRequest 定义司机认领预约订单请求的结构体
+type ClaimReservationRequest struct {
+	VehicleID uint `json:"vehicle_id" binding:"required"`
+}
+
+// ReservationResponse 定义可认领预约订单响应的结构体
+type ReservationResponse struct {
+	Distance float64              `json:"distance"`
+	Order    RequestOrderResponse `json:"order"`
+}
+
+// ClaimResponse 定义预约订单认领响应的结构体
+type ClaimResponse struct {
+	ClaimID     uint                  `json:"claim_id"`
+	OrderID     uint                  `json:"order_id"`
+	VehicleID   uint                  `json:"vehicle_id"`
+	Status      string                `json:"status"`
+	Penalized   bool                  `json:"penalized"`
+	ReserveTime string                `json:"reserve_time"`
+	RemindedAt  *string               `json:"reminded_at"`
+	Order       *RequestOrderResponse `json:"order,omitempty"`
+}
+
+// claimDuration 读取预约订单认领配置中的时间，未配置时使用默认值
+func claimDuration(seconds int, defaultValue time.Duration) time.Duration {
+	if seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultValue
+}
+
+// ListReservations 处理司机浏览附近可认领预约订单的请求
+// 默认使用司机最近上传的位置，也可以通过 latitude、longitude 指定位置
+func ListReservations(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 确定搜索位置
+	location := &DriverLocation{OpenID: payload.OpenID}
+	latitude, latErr := strconv.ParseFloat(c.Query("latitude"), 64)
+	longitude, lngErr := strconv.ParseFloat(c.Query("longitude"), 64)
+	if latErr == nil && lngErr == nil {
+		location.Latitude = latitude
+		location.Longitude = longitude
+	} else {
+		saved, err := getDriverLocation(payload.OpenID)
+		if err != nil {
+			response.Fail(c, response.ErrInvalidRequest.WithTips("请先上传位置或指定搜索位置"))
+			return
+		}
+		location = saved
+	}
+
+	radius, err := strconv.ParseFloat(c.DefaultQuery("radius", "0"), 64)
+	if err != nil || radius <= 0 {
+		radius = defaultReservationRadius
+	}
+	if radius > maxReservationRadius {
+		radius = maxReservationRadius
+	}
+
+	// 从数据库查询预约时间在可认领范围内且未被认领的预约订单
+	// Redis中的订单内容有过期时间，不能覆盖提前一天以上的预约单
+	now := time.Now()
+	horizon := claimDuration(config.Get().Reservation.ClaimHorizon, defaultClaimHorizon)
+	var orders []model.Order
+	if err := database.DB.Where("status = ? AND reserve_time > ? AND reserve_time <= ?",
+		model.OrderStatusReserved, now.Add(reservationLeadTime()), now.Add(horizon)).
+		Where("id NOT IN (?)", database.DB.Model(&model.ReservationClaim{}).Select("order_id").Where("status = ?", model.ClaimStatusActive)).
+		Find(&orders).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 只返回起点在搜索半径内的订单，按距离由近到远排序
+	reservations := make([]ReservationResponse, 0, len(orders))
+	for i := range orders {
+		orderModel := &orders[i]
+		distance := calculateDistance(location.Latitude, location.Longitude, orderModel.StartLocation.Latitude, orderModel.StartLocation.Longitude)
+		if distance > radius {
+			continue
+		}
+		reservations = append(reservations, ReservationResponse{
+			Distance: distance,
+			Order:    newRequestOrderResponse(orderModel),
+		})
+	}
+	sort.Slice(reservations, func(a, b int) bool {
+		return reservations[a].Distance < reservations[b].Distance
+	})
+	if limit := searchLimit(); len(reservations) > limit {
+		reservations = reservations[:limit]
+	}
+
+	// 返回成功响应
+	response.Success(c, reservations)
+}
+
+// ClaimReservation 处理司机认领预约订单的请求
+// 同一司机认领的订单时间不能重叠，违约次数过多的司机不能认领
+func ClaimReservation(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req ClaimReservationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 检查司机资质和车辆
+	if err := checkDriverVehicle(payload.OpenID, req.VehicleID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 检查违约次数
+	if err := checkClaimPenalties(payload.OpenID); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 查找预约订单
+	var orderModel model.Order
+	if err := database.DB.Where("id = ?", c.Param("id")).First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if orderModel.Status != model.OrderStatusReserved || !isClaimable(&orderModel, time.Now()) {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单不是可认领的预约订单"))
+		return
+	}
+
+	claim := model.ReservationClaim{
+		OrderID:      orderModel.ID,
+		DriverOpenID: payload.OpenID,
+		VehicleID:    req.VehicleID,
+		ReserveTime:  *orderModel.ReserveTime,
+		Duration:     orderModel.Duration,
+		Status:       model.ClaimStatusActive,
+	}
+
+	// 同一订单只能有一条有效认领，由唯一索引保证并发认领时只有一个成功
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁定司机记录，同一司机的认领依次执行，避免并发认领时间重叠的订单
+		var driver model.Driver
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("open_id = ?", payload.OpenID).First(&driver).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+
+		// 检查与已认领订单的时间是否重叠
+		if err := checkClaimOverlap(tx, payload.OpenID, &orderModel); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&model.ReservationClaim{}).Where("order_id = ? AND status = ?", orderModel.ID, model.ClaimStatusActive).Count(&count).Error; err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		if count > 0 {
+			return response.ErrAlreadyExists.WithTips("订单已被其他司机认领")
+		}
+		if err := tx.Create(&claim).Error; err != nil {
+			return response.ErrAlreadyExists.WithTips("订单已被其他司机认领")
+		}
+		return nil
+	})
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机认领预约订单", "order_id", orderModel.ID, "driver_open_id", payload.OpenID, "reserve_time", claim.ReserveTime)
+	response.Success(c, newClaimResponse(&claim, &orderModel))
+}
+
+// ReleaseReservation 处理司机放弃已认领预约订单的请求
+// 距预约时间不超过违约时限时放弃计为违约
+func ReleaseReservation(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查找司机对该订单的有效认领
+	var claim model.ReservationClaim
+	if err := database.DB.Where("order_id = ? AND driver_open_id = ? AND status = ?", c.Param("id"), payload.OpenID, model.ClaimStatusActive).
+		First(&claim).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("没有该订单的有效认领"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	now := time.Now()
+	penaltyWindow := claimDuration(config.Get().Reservation.CancelPenaltyWindow, defaultCancelPenaltyWindow)
+	penalized := claim.ReserveTime.Sub(now) <= penaltyWindow
+
+	result := database.DB.Model(&claim).Where("status = ?", model.ClaimStatusActive).Updates(map[string]interface{}{
+		"status":    model.ClaimStatusReleased,
+		"penalized": penalized,
+		"closed_at": now,
+	})
+	if result.Error != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.Fail(c, response.ErrOrderStatusConflict.WithTips("认领状态已变更"))
+		return
+	}
+	claim.Status = model.ClaimStatusReleased
+	claim.Penalized = penalized
+
+	// 返回成功响应
+	log.Info("司机放弃认领预约订单", "order_id", claim.OrderID, "driver_open_id", payload.OpenID, "penalized", penalized)
+	response.Success(c, newClaimResponse(&claim, nil))
+}
+
+// GetClaimedReservations 处理司机查询自己有效认领的预约订单的请求
+func GetClaimedReservations(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	var claims []model.ReservationClaim
+	if err := database.DB.Where("driver_open_id = ? AND status = ?", payload.OpenID, model.ClaimStatusActive).
+		Order("reserve_time ASC").Find(&claims).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 批量查询认领的订单
+	orderIDs := make([]uint, len(claims))
+	for i, claim := range claims {
+		orderIDs[i] = claim.OrderID
+	}
+	orders := make(map[uint]*model.Order, len(claims))
+	if len(orderIDs) > 0 {
+		var orderList []model.Order
+		if err := database.DB.Where("id IN ?", orderIDs).Find(&orderList).Error; err != nil {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+			return
+		}
+		for i := range orderList {
+			orders[orderList[i].ID] = &orderList[i]
+		}
+	}
+
+	claimList := make([]ClaimResponse, len(claims))
+	for i := range claims {
+		claimList[i] = newClaimResponse(&claims[i], orders[claims[i].OrderID])
+	}
+
+	// 返回成功响应
+	response.Success(c, claimList)
+}
+
+// isClaimable 判断预约订单的预约时间是否在可认领范围内
+// 即将由调度转为即时单的订单不能再认领
+func isClaimable(orderModel *model.Order, now time.Time) bool {
+	if orderModel.ReserveTime == nil {
+		return false
+	}
+	horizon := claimDuration(config.Get().Reservation.ClaimHorizon, defaultClaimHorizon)
+	return orderModel.ReserveTime.After(now.Add(reservationLeadTime())) && !orderModel.ReserveTime.After(now.Add(horizon))
+}
+
+// checkClaimPenalties 检查司机在统计周期内的违约次数是否已达上限
+func checkClaimPenalties(driverOpenID string) error {
+	cfg := config.Get().Reservation
+	limit := cfg.PenaltyLimit
+	if limit <= 0 {
+		limit = defaultPenaltyLimit
+	}
+	days := cfg.PenaltyDays
+	if days <= 0 {
+		days = defaultPenaltyDays
+	}
+
+	var count int64
+	if err := database.DB.Model(&model.ReservationClaim{}).
+		Where("driver_open_id = ? AND penalized = ? AND closed_at > ?", driverOpenID, true, time.Now().AddDate(0, 0, -days)).
+		Count(&count).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+	if count >= int64(limit) {
+		log.Warn("司机违约次数过多，拒绝认领预约订单", "driver_open_id", driverOpenID, "count", count)
+		return response.ErrForbidden.WithTips("近期违约次数过多，暂时无法认领预约订单")
+	}
+	return nil
+}
+
+// checkClaimOverlap 检查预约订单与司机已认领订单的时间是否重叠
+// 每个订单占用从预约时间开始、持续预计时长加间隔时间的时段，需要在锁定司机记录的事务中调用
+func checkClaimOverlap(tx *gorm.DB, driverOpenID string, orderModel *model.Order) error {
+	var claims []model.ReservationClaim
+	if err := tx.Where("driver_open_id = ? AND status = ?", driverOpenID, model.ClaimStatusActive).Find(&claims).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	buffer := claimDuration(config.Get().Reservation.ClaimBuffer, defaultClaimBuffer)
+	start := *orderModel.ReserveTime
+	end := start.Add(time.Duration(orderModel.Duration)*time.Minute + buffer)
+	for _, claim := range claims {
+		claimEnd := claim.ReserveTime.Add(time.Duration(claim.Duration)*time.Minute + buffer)
+		if start.Before(claimEnd) && claim.ReserveTime.Before(end) {
+			return response.ErrInvalidRequest.WithTips("与已认领的预约订单时间冲突")
+		}
+	}
+	return nil
+}
+
+// processClaims 维护预约订单认领，由预约单调度定期调用
+// 关闭乘客已取消订单的认领，并提醒临近预约时间的司机上线
+func processClaims() error {
+	now := time.Now()
+
+	// 乘客取消订单后认领失效
+	if err := database.DB.Model(&model.ReservationClaim{}).
+		Where("status = ? AND order_id IN (?)", model.ClaimStatusActive,
+			database.DB.Model(&model.Order{}).Select("id").Where("status = ?", model.OrderStatusCancelled)).
+		Updates(map[string]interface{}{"status": model.ClaimStatusCancelled, "closed_at": now}).Error; err != nil {
+		return err
+	}
+
+	// 提醒临近预约时间的司机按时上线，已过预约时间的认领不再提醒
+	remindBefore := claimDuration(config.Get().Reservation.RemindBefore, defaultRemindBefore)
+	var claims []model.ReservationClaim
+	if err := database.DB.Where("status = ? AND reminded_at IS NULL AND reserve_time > ? AND reserve_time <= ?",
+		model.ClaimStatusActive, now, now.Add(remindBefore)).
+		Find(&claims).Error; err != nil {
+		return err
+	}
+	for i := range claims {
+		remindClaim(&claims[i])
+	}
+	return nil
+}
+
+// remindClaim 通过订阅消息提醒认领的司机按时上线，消息发送成功后才记录提醒时间
+// 发送失败时在重试间隔后再次发送，直到预约时间
+func remindClaim(claim *model.ReservationClaim) {
+	ctx := context.Background()
+	retryKey := fmt.Sprintf("%s%d", claimRemindKeyPrefix, claim.ID)
+	acquired, err := redis.RedisClient.SetNX(ctx, retryKey, time.Now().Unix(), claimRemindRetry).Result()
+	if err != nil {
+		log.Error("获取预约订单提醒锁失败", "error", err, "claim_id", claim.ID)
+		return
+	}
+	if !acquired {
+		return
+	}
+
+	var orderModel model.Order
+	if err := database.DB.First(&orderModel, claim.OrderID).Error; err != nil {
+		log.Error("查询预约订单失败", "error", err, "order_id", claim.OrderID)
+		return
+	}
+
+	if err := wechat.SendSubscribeMessage(ctx, wechat.SubscribeMessage{
+		ToUser:   claim.DriverOpenID,
+		Template: config.Get().WeChat.Templates.ReservationReminder,
+		Data: map[string]string{
+			"time1":  claim.ReserveTime.Format("2006-01-02 15:04"),
+			"thing2": orderModel.StartLocation.Name,
+			"thing3": orderModel.EndLocation.Name,
+			"thing4": "请按时上线承接预约订单",
+		},
+	}); err != nil {
+		log.Warn("发送预约订单提醒失败", "error", err, "claim_id", claim.ID, "driver_open_id", claim.DriverOpenID)
+		return
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(claim).Where("reminded_at IS NULL").Update("reminded_at", now).Error; err != nil {
+		log.Error("记录预约订单提醒失败", "error", err, "claim_id", claim.ID)
+		return
+	}
+	online, _ := isDriverOnline(claim.DriverOpenID)
+	log.Info("已提醒司机按时上线承接预约订单", "order_id", claim.OrderID, "driver_open_id", claim.DriverOpenID, "reserve_time", claim.ReserveTime, "online", online)
+}
+
+// fulfillClaim 由认领预约订单的司机直接承接订单
+// 司机在线且没有进行中的订单时承接成功，否则认领失效，订单转为普通派单；
+// 司机未上线时计为违约。返回订单是否已由认领的司机承接
+func fulfillClaim(orderModel *model.Order, claim *model.ReservationClaim) bool {
+	now := time.Now()
+	status, err := getDriverStatus(claim.DriverOpenID)
+	if err != nil {
+		log.Error("查询司机在线状态失败", "error", err, "driver_open_id", claim.DriverOpenID)
+	}
+
+	if status != nil {
+		activeOrder, err := getDriverActiveOrder(claim.DriverOpenID)
+		if err == nil && activeOrder == nil {
+			// 以预约时间作为开始时间，订单直接进入等待司机接驾
+			err = order.Transition(orderModel, model.OrderStatusWaitingForPickup, order.SystemActor("预约订单由认领的司机承接"), map[string]interface{}{
+				"driver_open_id": claim.DriverOpenID,
+				"vehicle_id":     status.VehicleID,
+				"start_time":     orderModel.ReserveTime,
+			})
+			if err == nil {
+				database.DB.Model(claim).Updates(map[string]interface{}{"status": model.ClaimStatusFulfilled, "closed_at": now})
+				if err := markDriverBusy(claim.DriverOpenID); err != nil {
+					log.Error("从空闲司机索引移除司机失败", "error", err, "driver_open_id", claim.DriverOpenID)
+				}
+				if err := cancelDriverOffers(claim.DriverOpenID); err != nil {
+					log.Error("取消司机待响应的派单邀请失败", "error", err, "driver_open_id", claim.DriverOpenID)
+				}
+				log.Info("预约订单由认领的司机承接", "order_id", orderModel.ID, "driver_open_id", claim.DriverOpenID)
+				return true
+			}
+		}
+		if err != nil {
+			log.Error("认领的司机承接预约订单失败", "error", err, "order_id", orderModel.ID, "driver_open_id", claim.DriverOpenID)
+		}
+	}
+
+	// 司机未上线或无法承接，认领失效，订单转为普通派单
+	database.DB.Model(claim).Updates(map[string]interface{}{
+		"status":    model.ClaimStatusMissed,
+		"penalized": status == nil,
+		"closed_at": now,
+	})
+	log.Warn("认领的司机未能承接预约订单，转为普通派单", "order_id", orderModel.ID, "driver_open_id", claim.DriverOpenID, "online", status != nil)
+	return false
+}
+
+// newClaimResponse 将预约订单认领转换为响应格式
+func newClaimResponse(claim *model.ReservationClaim, orderModel *model.Order) ClaimResponse {
+	resp := ClaimResponse{
+		ClaimID:     claim.ID,
+		OrderID:     claim.OrderID,
+		VehicleID:   claim.VehicleID,
+		Status:      claim.Status,
+		Penalized:   claim.Penalized,
+		ReserveTime: claim.ReserveTime.Format("2006/01/02 15:04:05"),
+	}
+	if claim.RemindedAt != nil {
+		remindedAt := claim.RemindedAt.Format("2006/01/02 15:04:05")
+		resp.RemindedAt = &remindedAt
+	}
+	if orderModel != nil {
+		orderResp := newRequestOrderResponse(orderModel)
+		resp.Order = &orderResp
+	}
+	return resp
+}
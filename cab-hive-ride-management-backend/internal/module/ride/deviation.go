@@ -0,0 +1,121 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/safety"
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 偏航检测的默认配置
+const (
+	defaultDeviationThreshold = 500.0            // 偏航距离阈值（米）
+	defaultDeviationDwell     = 60 * time.Second // 持续偏航多久后告警
+)
+
+// deviationThreshold 返回偏航距离阈值（公里）
+func deviationThreshold() float64 {
+	if threshold := config.Get().Safety.DeviationThreshold; threshold > 0 {
+		return threshold / 1000
+	}
+	return defaultDeviationThreshold / 1000
+}
+
+// deviationDwell 返回持续偏航多久后产生告警
+func deviationDwell() time.Duration {
+	if dwell := config.Get().Safety.DeviationDwell; dwell > 0 {
+		return time.Duration(dwell) * time.Second
+	}
+	return defaultDeviationDwell
+}
+
+// deviationKey 返回记录订单开始偏航时间的Redis key
+func deviationKey(orderID uint) string {
+	return fmt.Sprintf("order_deviation:%d", orderID)
+}
+
+// checkDeviation 检查行程中的司机是否偏离规划路线
+// 司机位置到路线折线的距离超过阈值时开始计时，持续超过停留时间后产生安全告警，回到路线附近后重新计时
+func checkDeviation(orderModel *model.Order, location DriverLocation) error {
+	if len(orderModel.RoutePoints) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	key := deviationKey(orderModel.ID)
+	distance := distanceToPolyline(location.Latitude, location.Longitude, orderModel.RoutePoints)
+	if distance <= deviationThreshold() {
+		return redis.RedisClient.Del(ctx, key).Err()
+	}
+
+	// 记录开始偏航的时间，已在偏航中时保留原来的时间
+	if err := redis.RedisClient.SetNX(ctx, key, location.UpdateTime, trailTTL).Err(); err != nil {
+		return err
+	}
+	since, err := redis.RedisClient.Get(ctx, key).Int64()
+	if err != nil {
+		return err
+	}
+	elapsed := time.Duration(location.UpdateTime-since) * time.Second
+	if elapsed < deviationDwell() {
+		return nil
+	}
+
+	created, err := safety.RaiseAlert(&model.SafetyAlert{
+		OrderID:      orderModel.ID,
+		UserOpenID:   orderModel.UserOpenID,
+		DriverOpenID: orderModel.DriverOpenID,
+		Type:         model.SafetyAlertTypeRouteDeviation,
+		Latitude:     location.Latitude,
+		Longitude:    location.Longitude,
+		Distance:     math.Round(distance * 1000),
+		Message:      fmt.Sprintf("司机偏离规划路线%.0f米，已持续%.0f秒", distance*1000, elapsed.Seconds()),
+	})
+	if err != nil {
+		return err
+	}
+	if created {
+		log.Warn("司机偏离规划路线", "order_id", orderModel.ID, "driver_open_id", orderModel.DriverOpenID, "distance", fmt.Sprintf("%.0f米", distance*1000))
+	}
+	return nil
+}
+
+// distanceToPolyline 计算点到折线的最短距离（单位：公里）
+func distanceToPolyline(latitude, longitude float64, points model.LocationPoints) float64 {
+	if len(points) == 1 {
+		return calculateDistance(latitude, longitude, points[0].Latitude, points[0].Longitude)
+	}
+
+	minDistance := math.MaxFloat64
+	for i := 1; i < len(points); i++ {
+		if distance := distanceToSegment(latitude, longitude, points[i-1], points[i]); distance < minDistance {
+			minDistance = distance
+		}
+	}
+	return minDistance
+}
+
+// distanceToSegment 计算点到线段的最短距离（单位：公里）
+// 以该点为原点将线段投影到局部平面坐标中计算，城市范围内误差可以忽略
+func distanceToSegment(latitude, longitude float64, a, b model.LocationPoint) float64 {
+	const earthRadius = 6371.0 // 地球半径（单位：公里）
+
+	// 将经纬度转换为以该点为原点的平面坐标（单位：公里）
+	scale := math.Cos(latitude * math.Pi / 180)
+	ax := (a.Longitude - longitude) * math.Pi / 180 * earthRadius * scale
+	ay := (a.Latitude - latitude) * math.Pi / 180 * earthRadius
+	bx := (b.Longitude - longitude) * math.Pi / 180 * earthRadius * scale
+	by := (b.Latitude - latitude) * math.Pi / 180 * earthRadius
+
+	// 原点在线段上的投影位置，限制在线段两端之间
+	dx, dy := bx-ax, by-ay
+	t := 0.0
+	if lengthSquared := dx*dx + dy*dy; lengthSquared > 0 {
+		t = math.Max(0, math.Min(1, -(ax*dx+ay*dy)/lengthSquared))
+	}
+	return math.Hypot(ax+t*dx, ay+t*dy)
+}
@@ -0,0 +1,76 @@
+package ride
+
+import (
+	"math"
+	"testing"
+
+	"cab-hive/internal/model"
+)
+
+// segmentTolerance 局部平面近似与球面距离允许的误差（公里）
+const segmentTolerance = 0.001
+
+func TestDistanceToSegment(t *testing.T) {
+	// 纬度36度上沿经度方向约900米的线段
+	a := model.LocationPoint{Latitude: 36.0, Longitude: 117.0}
+	b := model.LocationPoint{Latitude: 36.0, Longitude: 117.01}
+
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		a, b      model.LocationPoint
+		expected  float64
+	}{
+		{name: "在线段上", latitude: 36.0, longitude: 117.005, a: a, b: b, expected: 0},
+		{name: "在线段端点", latitude: 36.0, longitude: 117.01, a: a, b: b, expected: 0},
+		{name: "垂直于线段中部", latitude: 36.001, longitude: 117.005, a: a, b: b, expected: calculateDistance(36.001, 117.005, 36.0, 117.005)},
+		{name: "超出终点", latitude: 36.0, longitude: 117.02, a: a, b: b, expected: calculateDistance(36.0, 117.02, 36.0, 117.01)},
+		{name: "超出起点", latitude: 36.0, longitude: 116.99, a: a, b: b, expected: calculateDistance(36.0, 116.99, 36.0, 117.0)},
+		{name: "斜向超出终点", latitude: 36.001, longitude: 117.02, a: a, b: b, expected: calculateDistance(36.001, 117.02, 36.0, 117.01)},
+		{name: "斜向超出起点", latitude: 35.999, longitude: 116.99, a: a, b: b, expected: calculateDistance(35.999, 116.99, 36.0, 117.0)},
+		{name: "线段方向相反", latitude: 36.0, longitude: 117.02, a: b, b: a, expected: calculateDistance(36.0, 117.02, 36.0, 117.01)},
+		{name: "线段退化为一个点", latitude: 36.001, longitude: 117.0, a: a, b: a, expected: calculateDistance(36.001, 117.0, 36.0, 117.0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := distanceToSegment(tt.latitude, tt.longitude, tt.a, tt.b)
+			if math.Abs(distance-tt.expected) > segmentTolerance {
+				t.Errorf("距离 = %.4f公里，期望 %.4f公里", distance, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDistanceToPolyline(t *testing.T) {
+	// 先向东再向北的折线
+	route := model.LocationPoints{
+		{Latitude: 36.0, Longitude: 117.0},
+		{Latitude: 36.0, Longitude: 117.01},
+		{Latitude: 36.01, Longitude: 117.01},
+	}
+
+	tests := []struct {
+		name      string
+		points    model.LocationPoints
+		latitude  float64
+		longitude float64
+		expected  float64
+	}{
+		{name: "只有一个点", points: route[:1], latitude: 36.001, longitude: 117.0, expected: calculateDistance(36.001, 117.0, 36.0, 117.0)},
+		{name: "靠近第一段", points: route, latitude: 35.999, longitude: 117.005, expected: calculateDistance(35.999, 117.005, 36.0, 117.005)},
+		{name: "靠近第二段", points: route, latitude: 36.005, longitude: 117.012, expected: calculateDistance(36.005, 117.012, 36.005, 117.01)},
+		{name: "在拐角内侧取较近的一段", points: route, latitude: 36.002, longitude: 117.009, expected: calculateDistance(36.002, 117.009, 36.002, 117.01)},
+		{name: "超出折线终点", points: route, latitude: 36.02, longitude: 117.01, expected: calculateDistance(36.02, 117.01, 36.01, 117.01)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			distance := distanceToPolyline(tt.latitude, tt.longitude, tt.points)
+			if math.Abs(distance-tt.expected) > segmentTolerance {
+				t.Errorf("距离 = %.4f公里，期望 %.4f公里", distance, tt.expected)
+			}
+		})
+	}
+}
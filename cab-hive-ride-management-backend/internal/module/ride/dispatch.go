@@ -0,0 +1,670 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/global/wechat"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"cab-hive/internal/module/realtime"
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 自动派单使用的Redis键
+const (
+	dispatchLockKey          = "dispatch:lock"       // 派单扫描锁，保证多实例部署时同一时刻只有一个实例派单
+	dispatchExhaustedKeyBase = "dispatch:exhausted:" // 已达到最大派单轮次的订单标记
+)
+
+// 自动派单默认配置
+const (
+	defaultDispatchInterval = 2 * time.Second  // 派单扫描间隔
+	defaultOfferTimeout     = 20 * time.Second // 司机响应邀请的时限
+	defaultOfferRadius      = 5.0              // 搜索空闲司机的半径（公里）
+	defaultMaxRounds        = 5                // 最多派单轮次
+)
+
+// 派单进度，供乘客查询
+const (
+	DispatchStatusSearching = "searching" // 正在寻找司机
+	DispatchStatusOffering  = "offering"  // 已向司机发出邀请，等待响应
+	DispatchStatusNoDriver  = "no_driver" // 达到最大派单轮次仍无司机接单
+	DispatchStatusMatched   = "matched"   // 已有司机接单
+	DispatchStatusClosed    = "closed"    // 订单已取消或不再需要派单
+)
+
+// noDriverMessage 达到最大派单轮次仍无司机接单时提示乘客的内容
+const noDriverMessage = "附近暂无司机接单，请稍后重试或取消订单"
+
+// OfferRequest 定义司机响应派单邀请请求的结构体
+type OfferRequest struct {
+	OfferID uint `json:"offer_id" binding:"required"`
+}
+
+// OfferResponse 定义派单邀请响应的结构体
+type OfferResponse struct {
+	OfferID   uint                 `json:"offer_id"`
+	OrderID   uint                 `json:"order_id"`
+	Round     int                  `json:"round"`
+	Distance  float64              `json:"distance"`
+	Status    string               `json:"status"`
+	ExpiresAt string               `json:"expires_at"`
+	Order     RequestOrderResponse `json:"order"`
+}
+
+// DispatchStatusResponse 定义订单派单进度响应的结构体
+type DispatchStatusResponse struct {
+	OrderID   uint   `json:"order_id"`
+	Status    string `json:"status"`
+	Rounds    int    `json:"rounds"`
+	MaxRounds int    `json:"max_rounds"`
+	Message   string `json:"message"`
+}
+
+// dispatchInterval 获取派单扫描间隔
+// 批量派单策略按收集窗口定期求解
+func dispatchInterval() time.Duration {
+	dispatch := config.Get().Dispatch
+	if dispatch.Strategy == StrategyBatch {
+		if dispatch.BatchInterval > 0 {
+			return time.Duration(dispatch.BatchInterval) * time.Second
+		}
+		return defaultBatchInterval
+	}
+	if dispatch.DispatchInterval > 0 {
+		return time.Duration(dispatch.DispatchInterval) * time.Second
+	}
+	return defaultDispatchInterval
+}
+
+// offerTimeout 获取司机响应邀请的时限
+func offerTimeout() time.Duration {
+	if timeout := config.Get().Dispatch.OfferTimeout; timeout > 0 {
+		return time.Duration(timeout) * time.Second
+	}
+	return defaultOfferTimeout
+}
+
+// offerRadius 获取派单时搜索空闲司机的半径
+func offerRadius() float64 {
+	if radius := config.Get().Dispatch.OfferRadius; radius > 0 {
+		return radius
+	}
+	return defaultOfferRadius
+}
+
+// maxRounds 获取最多派单轮次
+func maxRounds() int {
+	if rounds := config.Get().Dispatch.MaxRounds; rounds > 0 {
+		return rounds
+	}
+	return defaultMaxRounds
+}
+
+// runDispatcher 定期扫描等待接单的订单并向附近的空闲司机发出邀请
+func runDispatcher() {
+	ticker := time.NewTicker(dispatchInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := dispatchOnce(); err != nil {
+			log.Error("自动派单失败", "error", err)
+		}
+	}
+}
+
+// dispatchOnce 执行一次派单扫描
+// 依次处理超时的邀请、失效的邀请，再为没有待响应邀请的订单发出新一轮邀请
+func dispatchOnce() error {
+	ctx := context.Background()
+
+	// 获取派单锁，锁在一个扫描间隔后自动释放
+	locked, err := redis.RedisClient.SetNX(ctx, dispatchLockKey, time.Now().Unix(), dispatchInterval()).Result()
+	if err != nil || !locked {
+		return err
+	}
+
+	if err := expireOffers(); err != nil {
+		return err
+	}
+	if err := cancelStaleOffers(); err != nil {
+		return err
+	}
+
+	// 获取等待司机接单的订单
+	orderIDs, err := redis.RedisClient.SMembers(ctx, orderStatusKeyBase+model.OrderStatusWaitingForDriver).Result()
+	if err != nil {
+		return err
+	}
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	// 已有待响应邀请的司机本轮不再派单
+	var busyDrivers []string
+	if err := database.DB.Model(&model.DispatchOffer{}).
+		Where("status = ?", model.OfferStatusPending).
+		Pluck("driver_open_id", &busyDrivers).Error; err != nil {
+		return err
+	}
+	busy := make(map[string]bool, len(busyDrivers))
+	for _, driverOpenID := range busyDrivers {
+		busy[driverOpenID] = true
+	}
+
+	problem, rounds, err := buildOfferProblem(orderIDs, busy)
+	if err != nil || problem == nil {
+		return err
+	}
+
+	// 由配置的派单策略分配订单和司机，并发出邀请
+	strategy := currentStrategy()
+	for _, assignment := range strategy.Assign(problem) {
+		orderModel := problem.Orders[assignment.Order].Order
+		offer := model.DispatchOffer{
+			OrderID:      orderModel.ID,
+			DriverOpenID: problem.Drivers[assignment.Driver].OpenID,
+			Round:        rounds[orderModel.ID] + 1,
+			Distance:     assignment.Distance,
+			Strategy:     strategy.Name(),
+			Status:       model.OfferStatusPending,
+			ExpiresAt:    time.Now().Add(offerTimeout()),
+		}
+		if err := database.DB.Create(&offer).Error; err != nil {
+			log.Error("发出派单邀请失败", "error", err, "order_id", offer.OrderID)
+			continue
+		}
+		log.Info("向司机发出派单邀请", "order_id", offer.OrderID, "driver_open_id", offer.DriverOpenID, "round", offer.Round, "distance", offer.Distance, "strategy", offer.Strategy)
+	}
+	return nil
+}
+
+// expireOffers 将超过响应时限的邀请标记为超时
+func expireOffers() error {
+	now := time.Now()
+	result := database.DB.Model(&model.DispatchOffer{}).
+		Where("status = ? AND expires_at < ?", model.OfferStatusPending, now).
+		Updates(map[string]interface{}{"status": model.OfferStatusExpired, "responded_at": now})
+	if result.RowsAffected > 0 {
+		log.Info("派单邀请超时", "count", result.RowsAffected)
+	}
+	return result.Error
+}
+
+// cancelStaleOffers 取消订单已不再等待接单的邀请
+func cancelStaleOffers() error {
+	return database.DB.Model(&model.DispatchOffer{}).
+		Where("status = ? AND order_id NOT IN (?)", model.OfferStatusPending,
+			database.DB.Model(&model.Order{}).Select("id").Where("status = ?", model.OrderStatusWaitingForDriver)).
+		Updates(map[string]interface{}{"status": model.OfferStatusCancelled, "responded_at": time.Now()}).Error
+}
+
+// cancelDriverOffers 取消司机所有待响应的邀请，司机已承接其他订单时调用
+func cancelDriverOffers(driverOpenID string) error {
+	result := database.DB.Model(&model.DispatchOffer{}).
+		Where("driver_open_id = ? AND status = ?", driverOpenID, model.OfferStatusPending).
+		Updates(map[string]interface{}{"status": model.OfferStatusCancelled, "responded_at": time.Now()})
+	if result.RowsAffected > 0 {
+		log.Info("司机已承接其他订单，取消待响应的派单邀请", "driver_open_id", driverOpenID, "count", result.RowsAffected)
+	}
+	return result.Error
+}
+
+// buildOfferProblem 构建本轮自动派单的派单问题，同时返回各订单已发出的邀请数量
+// 跳过有待响应邀请或已达到最大派单轮次的订单，同一订单不会重复邀请同一名司机，没有可派的订单时返回nil
+func buildOfferProblem(orderIDStrs []string, busy map[string]bool) (*DispatchProblem, map[uint]int, error) {
+	orderIDs := make([]uint, 0, len(orderIDStrs))
+	for _, orderIDStr := range orderIDStrs {
+		if orderID, err := strconv.ParseUint(orderIDStr, 10, 64); err == nil {
+			orderIDs = append(orderIDs, uint(orderID))
+		}
+	}
+	if len(orderIDs) == 0 {
+		return nil, nil, nil
+	}
+	sort.Slice(orderIDs, func(a, b int) bool { return orderIDs[a] < orderIDs[b] })
+
+	var offers []model.DispatchOffer
+	if err := database.DB.Where("order_id IN ?", orderIDs).Find(&offers).Error; err != nil {
+		return nil, nil, err
+	}
+	rounds := make(map[uint]int)
+	pending := make(map[uint]bool)
+	offered := make(map[uint]map[string]bool)
+	for _, offer := range offers {
+		rounds[offer.OrderID]++
+		if offer.Status == model.OfferStatusPending {
+			pending[offer.OrderID] = true
+		}
+		if offered[offer.OrderID] == nil {
+			offered[offer.OrderID] = make(map[string]bool)
+		}
+		offered[offer.OrderID][offer.DriverOpenID] = true
+	}
+
+	var orders []*model.Order
+	var nearby [][]go_redis.GeoLocation
+	driverIndex := make(map[string]int)
+	var driverOpenIDs []string
+	for _, orderID := range orderIDs {
+		if pending[orderID] {
+			continue
+		}
+
+		// 达到最大派单轮次后停止派单，只记录并通知乘客一次
+		if rounds[orderID] >= maxRounds() {
+			key := dispatchExhaustedKeyBase + strconv.FormatUint(uint64(orderID), 10)
+			if first, err := redis.RedisClient.SetNX(context.Background(), key, time.Now().Unix(), 24*time.Hour).Result(); err == nil && first {
+				log.Warn("订单达到最大派单轮次，无司机接单", "order_id", orderID, "rounds", rounds[orderID])
+				go notifyNoDriver(orderID, rounds[orderID])
+			}
+			continue
+		}
+
+		orderModel, err := getCachedOrder(orderID)
+		if err != nil {
+			log.Error("读取订单失败", "error", err, "order_id", orderID)
+			continue
+		}
+		if orderModel == nil {
+			continue
+		}
+
+		// 查找订单起点附近可以邀请的空闲司机
+		locations, err := searchIdleDrivers(orderModel)
+		if err != nil {
+			return nil, nil, err
+		}
+		var candidates []go_redis.GeoLocation
+		for _, location := range locations {
+			if busy[location.Name] || offered[orderID][location.Name] {
+				continue
+			}
+			candidates = append(candidates, location)
+			if _, ok := driverIndex[location.Name]; !ok {
+				driverIndex[location.Name] = len(driverOpenIDs)
+				driverOpenIDs = append(driverOpenIDs, location.Name)
+			}
+		}
+		if len(candidates) == 0 {
+			continue
+		}
+		orders = append(orders, orderModel)
+		nearby = append(nearby, candidates)
+	}
+	if len(orders) == 0 {
+		return nil, rounds, nil
+	}
+
+	// 构建距离矩阵，不在订单附近的司机不能匹配
+	distances := make([][]float64, len(orders))
+	for i := range orders {
+		distances[i] = make([]float64, len(driverOpenIDs))
+		for j := range distances[i] {
+			distances[i][j] = math.Inf(1)
+		}
+		for _, location := range nearby[i] {
+			distances[i][driverIndex[location.Name]] = location.Dist
+		}
+	}
+	return newDispatchProblem(orders, driverOpenIDs, distances), rounds, nil
+}
+
+// searchIdleDrivers 查找订单起点附近的空闲司机，按距离由近到远排序
+func searchIdleDrivers(orderModel *model.Order) ([]go_redis.GeoLocation, error) {
+	return redis.RedisClient.GeoSearchLocation(context.Background(), driverIdleGeoKey, &go_redis.GeoSearchLocationQuery{
+		GeoSearchQuery: go_redis.GeoSearchQuery{
+			Longitude:  orderModel.StartLocation.Longitude,
+			Latitude:   orderModel.StartLocation.Latitude,
+			Radius:     offerRadius(),
+			RadiusUnit: "km",
+			Sort:       "ASC",
+			Count:      searchLimit(),
+		},
+		WithDist: true,
+	}).Result()
+}
+
+// notifyNoDriver 通知乘客订单达到最大派单轮次仍无司机接单
+// 通过订单实时事件推送给正在等待的乘客，同时发送订阅消息，乘客离开小程序后也能收到
+func notifyNoDriver(orderID uint, rounds int) {
+	if err := realtime.PublishDispatch(orderID, realtime.DispatchData{
+		Status:    DispatchStatusNoDriver,
+		Rounds:    rounds,
+		MaxRounds: maxRounds(),
+		Message:   noDriverMessage,
+	}); err != nil {
+		log.Error("推送派单进度失败", "error", err, "order_id", orderID)
+	}
+
+	orderModel, err := getCachedOrder(orderID)
+	if err != nil || orderModel == nil {
+		log.Error("读取订单失败，无法发送无司机接单通知", "error", err, "order_id", orderID)
+		return
+	}
+	if err := wechat.SendSubscribeMessage(context.Background(), wechat.SubscribeMessage{
+		ToUser:   orderModel.UserOpenID,
+		Template: config.Get().WeChat.Templates.NoDriver,
+		Data: map[string]string{
+			"thing1": orderModel.StartLocation.Name,
+			"thing2": orderModel.EndLocation.Name,
+			"thing3": noDriverMessage,
+		},
+	}); err != nil {
+		log.Warn("发送无司机接单通知失败", "error", err, "order_id", orderID, "user_open_id", orderModel.UserOpenID)
+		return
+	}
+	log.Info("已通知乘客无司机接单", "order_id", orderID, "user_open_id", orderModel.UserOpenID)
+}
+
+// getCachedOrder 从Redis中读取订单内容，订单已过期时返回nil
+func getCachedOrder(orderID uint) (*model.Order, error) {
+	orderJSON, err := redis.RedisClient.Get(context.Background(), orderKeyBase+strconv.FormatUint(uint64(orderID), 10)).Result()
+	if err != nil {
+		if errors.Is(err, go_redis.Nil) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var orderModel model.Order
+	if err := json.Unmarshal([]byte(orderJSON), &orderModel); err != nil {
+		return nil, err
+	}
+	return &orderModel, nil
+}
+
+// GetPendingOffer 处理司机查询当前待响应派单邀请的请求
+func GetPendingOffer(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 查询未过期的待响应邀请
+	var offer model.DispatchOffer
+	if err := database.DB.Where("driver_open_id = ? AND status = ? AND expires_at > ?",
+		payload.OpenID, model.OfferStatusPending, time.Now()).
+		Order("id DESC").First(&offer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Success(c, nil)
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 查询邀请对应的订单
+	var orderModel model.Order
+	if err := database.DB.Where("id = ?", offer.OrderID).First(&orderModel).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, newOfferResponse(&offer, &orderModel))
+}
+
+// AcceptOffer 处理司机接受派单邀请的请求
+// 使用司机上线时选择的车辆接单，订单状态从 waiting_for_driver 变更为 waiting_for_pickup
+func AcceptOffer(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req OfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 司机必须在线，接单车辆取自上线信息
+	status, err := getDriverStatus(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+	if status == nil {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("司机未上线，无法接单"))
+		return
+	}
+
+	// 司机已通过抢单或预约认领承接了其他订单时不能再接受邀请，同时取消司机所有待响应的邀请
+	activeOrder, err := getDriverActiveOrder(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+	if activeOrder != nil {
+		if err := cancelDriverOffers(payload.OpenID); err != nil {
+			log.Error("取消司机待响应的派单邀请失败", "error", err, "driver_open_id", payload.OpenID)
+		}
+		response.Fail(c, response.ErrInvalidRequest.WithTips("司机有未完成的订单，无法接受派单"))
+		return
+	}
+
+	// 以待响应且未过期为条件接受邀请，防止与超时处理并发冲突
+	now := time.Now()
+	result := database.DB.Model(&model.DispatchOffer{}).
+		Where("id = ? AND driver_open_id = ? AND status = ? AND expires_at > ?", req.OfferID, payload.OpenID, model.OfferStatusPending, now).
+		Updates(map[string]interface{}{"status": model.OfferStatusAccepted, "responded_at": now})
+	if result.Error != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("派单邀请不存在或已失效"))
+		return
+	}
+
+	var offer model.DispatchOffer
+	if err := database.DB.Where("id = ?", req.OfferID).First(&offer).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 查找订单并变更状态，订单已被取消或被其他司机承接时邀请作废
+	var orderModel model.Order
+	err = database.DB.Where("id = ?", offer.OrderID).First(&orderModel).Error
+	if err == nil {
+		err = order.Transition(&orderModel, model.OrderStatusWaitingForPickup, driverActor(payload.OpenID, "司机接受派单"), map[string]interface{}{
+			"driver_open_id": payload.OpenID,
+			"vehicle_id":     status.VehicleID,
+		})
+	}
+	if err != nil {
+		database.DB.Model(&offer).Update("status", model.OfferStatusCancelled)
+		if errors.Is(err, response.ErrOrderStatusConflict) || errors.Is(err, response.ErrIllegalTransition) {
+			response.Fail(c, response.ErrOrderStatusConflict.WithTips("订单已被取消或已由其他司机承接"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 司机接单后不再是空闲状态，其他待响应的邀请作废
+	if err := markDriverBusy(payload.OpenID); err != nil {
+		log.Error("从空闲司机索引移除司机失败", "error", err, "driver_open_id", payload.OpenID)
+	}
+	if err := cancelDriverOffers(payload.OpenID); err != nil {
+		log.Error("取消司机待响应的派单邀请失败", "error", err, "driver_open_id", payload.OpenID)
+	}
+
+	// 返回成功响应
+	log.Info("司机接受派单邀请", "offer_id", offer.ID, "order_id", offer.OrderID, "driver_open_id", payload.OpenID)
+	response.Success(c, newOfferResponse(&offer, &orderModel))
+}
+
+// DeclineOffer 处理司机拒绝派单邀请的请求
+// 拒绝后系统在下一次扫描时将订单派给下一名司机
+func DeclineOffer(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req OfferRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	result := database.DB.Model(&model.DispatchOffer{}).
+		Where("id = ? AND driver_open_id = ? AND status = ?", req.OfferID, payload.OpenID, model.OfferStatusPending).
+		Updates(map[string]interface{}{"status": model.OfferStatusDeclined, "responded_at": time.Now()})
+	if result.Error != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(result.Error))
+		return
+	}
+	if result.RowsAffected == 0 {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("派单邀请不存在或已失效"))
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机拒绝派单邀请", "offer_id", req.OfferID, "driver_open_id", payload.OpenID)
+	response.Success(c, nil)
+}
+
+// GetDispatchStatus 处理乘客查询订单派单进度的请求
+// 达到最大派单轮次仍无司机接单时提示乘客
+func GetDispatchStatus(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 查找订单，非管理员只能查询自己的订单
+	query := database.DB.Where("id = ?", c.Param("id"))
+	if payload.RoleID != 3 {
+		query = query.Where("user_open_id = ?", payload.OpenID)
+	}
+	var orderModel model.Order
+	if err := query.First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 统计派单轮次
+	var offers []model.DispatchOffer
+	if err := database.DB.Where("order_id = ?", orderModel.ID).Find(&offers).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	resp := DispatchStatusResponse{
+		OrderID:   orderModel.ID,
+		Rounds:    len(offers),
+		MaxRounds: maxRounds(),
+	}
+	pending := false
+	for _, offer := range offers {
+		if offer.Status == model.OfferStatusPending {
+			pending = true
+		}
+	}
+
+	switch {
+	case orderModel.DriverOpenID != "":
+		resp.Status = DispatchStatusMatched
+		resp.Message = "司机已接单"
+	case orderModel.Status != model.OrderStatusWaitingForDriver:
+		resp.Status = DispatchStatusClosed
+		resp.Message = "订单不在派单中"
+	case pending:
+		resp.Status = DispatchStatusOffering
+		resp.Message = "正在等待司机确认"
+	case len(offers) >= resp.MaxRounds:
+		resp.Status = DispatchStatusNoDriver
+		resp.Message = noDriverMessage
+	default:
+		resp.Status = DispatchStatusSearching
+		resp.Message = "正在为您寻找附近的司机"
+	}
+
+	// 返回成功响应
+	response.Success(c, resp)
+}
+
+// newOfferResponse 将派单邀请转换为响应格式
+func newOfferResponse(offer *model.DispatchOffer, orderModel *model.Order) OfferResponse {
+	return OfferResponse{
+		OfferID:   offer.ID,
+		OrderID:   offer.OrderID,
+		Round:     offer.Round,
+		Distance:  offer.Distance,
+		Status:    offer.Status,
+		ExpiresAt: offer.ExpiresAt.Format("2006/01/02 15:04:05"),
+		Order:     newRequestOrderResponse(orderModel),
+	}
+}
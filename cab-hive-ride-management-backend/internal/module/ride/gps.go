@@ -0,0 +1,225 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/safety"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+)
+
+// 定位处理的默认配置
+const (
+	defaultMaxSpeed          = 150.0 // 最大合理车速（公里/小时）
+	defaultSmoothWindow      = 5     // 中值滤波窗口大小
+	defaultMinStep           = 5.0   // 里程累加的最小位移（米）
+	defaultUploadInterval    = 5     // 建议司机端上传位置的间隔（秒）
+	defaultSOSUploadInterval = 1     // 有未处理完成的紧急求助时建议进行中订单的司机端上传位置的间隔（秒）
+)
+
+// maxClockSkew 允许客户端定位时间超前服务器时间的最大值，超过时使用服务器时间
+const maxClockSkew = time.Minute
+
+// odometerTTL 订单里程状态在Redis中的保留时间，与订单轨迹一致
+const odometerTTL = trailTTL
+
+// odometerState 定义进行中订单的定位处理状态
+// 保存最近一次有效定位、滤波窗口和已累加的里程，每次司机上传位置时更新
+type odometerState struct {
+	LastTime        int64                `json:"last_time"`         // 最近一次有效定位的时间（Unix毫秒）
+	LastLatitude    float64              `json:"last_latitude"`     // 最近一次有效定位的原始纬度
+	LastLongitude   float64              `json:"last_longitude"`    // 最近一次有效定位的原始经度
+	Window          model.LocationPoints `json:"window"`            // 最近的有效原始定位，用于中值滤波
+	Anchor          *model.LocationPoint `json:"anchor"`            // 上一次累加里程时的平滑位置
+	AnchorStatus    string               `json:"anchor_status"`     // 记录锚点时的订单状态，状态变化后重新记录锚点
+	Distance        float64              `json:"distance"`          // 行程中累加的里程（公里）
+	InProgressCount int                  `json:"in_progress_count"` // 行程中的有效定位数量
+	Dropped         int                  `json:"dropped"`           // 被丢弃的定位数量
+}
+
+// maxSpeed 返回相邻两次定位之间的最大合理车速（公里/小时）
+func maxSpeed() float64 {
+	if speed := config.Get().GPS.MaxSpeed; speed > 0 {
+		return speed
+	}
+	return defaultMaxSpeed
+}
+
+// smoothWindow 返回中值滤波窗口大小
+func smoothWindow() int {
+	if window := config.Get().GPS.SmoothWindow; window > 0 {
+		return window
+	}
+	return defaultSmoothWindow
+}
+
+// minStep 返回里程累加的最小位移（公里）
+func minStep() float64 {
+	if step := config.Get().GPS.MinStep; step > 0 {
+		return step / 1000
+	}
+	return defaultMinStep / 1000
+}
+
+// newUploadLocationResponse 返回建议司机端下次上传位置的间隔
+// 系统中有未处理完成的紧急求助时，所有有进行中订单的司机都缩短间隔，便于管理员跟踪；
+// 不只缩短求助订单的间隔，避免司机从间隔的变化得知乘客求助
+func newUploadLocationResponse(activeOrder *model.Order) UploadLocationResponse {
+	if activeOrder != nil && safety.HasOpenIncident() {
+		if interval := config.Get().Safety.SOSUploadInterval; interval > 0 {
+			return UploadLocationResponse{UploadInterval: interval}
+		}
+		return UploadLocationResponse{UploadInterval: defaultSOSUploadInterval}
+	}
+	if interval := config.Get().GPS.UploadInterval; interval > 0 {
+		return UploadLocationResponse{UploadInterval: interval}
+	}
+	return UploadLocationResponse{UploadInterval: defaultUploadInterval}
+}
+
+// odometerKey 返回订单里程状态在Redis中的key
+func odometerKey(orderID uint) string {
+	return fmt.Sprintf("order_odometer:%d", orderID)
+}
+
+// loadOdometer 从Redis读取订单的定位处理状态，不存在时返回空状态
+func loadOdometer(orderID uint) (*odometerState, error) {
+	stateJSON, err := redis.RedisClient.Get(context.Background(), odometerKey(orderID)).Result()
+	if err != nil {
+		if errors.Is(err, go_redis.Nil) {
+			return &odometerState{}, nil
+		}
+		return nil, err
+	}
+
+	var state odometerState
+	if err := json.Unmarshal([]byte(stateJSON), &state); err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// saveOdometer 将订单的定位处理状态写入Redis
+func saveOdometer(orderID uint, state *odometerState) error {
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return redis.RedisClient.Set(context.Background(), odometerKey(orderID), stateJSON, odometerTTL).Err()
+}
+
+// processLocation 处理进行中订单的司机定位
+// 依次丢弃时间戳乱序和车速不合理的定位，对有效定位做中值滤波，并在行程中累加里程
+// 返回平滑后的位置，定位被丢弃时返回 nil 和丢弃原因
+func processLocation(orderModel *model.Order, latitude, longitude float64, timestamp int64) (*model.LocationPoint, string, error) {
+	state, err := loadOdometer(orderModel.ID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// 丢弃不合理的定位
+	if reason := checkLocation(state, latitude, longitude, timestamp); reason != "" {
+		state.Dropped++
+		if err := saveOdometer(orderModel.ID, state); err != nil {
+			return nil, "", err
+		}
+		return nil, reason, nil
+	}
+	state.LastTime = timestamp
+	state.LastLatitude = latitude
+	state.LastLongitude = longitude
+
+	// 中值滤波，窗口内保留最近的有效定位
+	state.Window = append(state.Window, model.LocationPoint{Latitude: latitude, Longitude: longitude})
+	if size := smoothWindow(); len(state.Window) > size {
+		state.Window = state.Window[len(state.Window)-size:]
+	}
+	smoothed := medianPoint(state.Window)
+
+	// 只在行程中累加里程，订单状态变化后从新位置重新开始计算
+	if state.Anchor == nil || state.AnchorStatus != orderModel.Status {
+		state.Anchor = &smoothed
+		state.AnchorStatus = orderModel.Status
+	} else if orderModel.Status == model.OrderStatusInProgress {
+		step := calculateDistance(state.Anchor.Latitude, state.Anchor.Longitude, smoothed.Latitude, smoothed.Longitude)
+		if step >= minStep() {
+			state.Distance += step
+			state.Anchor = &smoothed
+		}
+	}
+	if orderModel.Status == model.OrderStatusInProgress {
+		state.InProgressCount++
+	}
+
+	if err := saveOdometer(orderModel.ID, state); err != nil {
+		return nil, "", err
+	}
+	return &smoothed, "", nil
+}
+
+// checkLocation 检查定位是否可信，不可信时返回丢弃原因
+func checkLocation(state *odometerState, latitude, longitude float64, timestamp int64) string {
+	if state.LastTime == 0 {
+		return ""
+	}
+
+	// 时间戳不晚于上一次有效定位，说明是重复或乱序到达的定位
+	if timestamp <= state.LastTime {
+		return "时间戳乱序"
+	}
+
+	// 车速超过合理范围，说明定位发生了跳变
+	hours := float64(timestamp-state.LastTime) / float64(time.Hour/time.Millisecond)
+	distance := calculateDistance(state.LastLatitude, state.LastLongitude, latitude, longitude)
+	if distance/hours > maxSpeed() {
+		return fmt.Sprintf("车速过快（%.0f公里/小时）", distance/hours)
+	}
+	return ""
+}
+
+// medianPoint 分别取经度和纬度的中位数作为平滑后的位置
+func medianPoint(points model.LocationPoints) model.LocationPoint {
+	latitudes := make([]float64, len(points))
+	longitudes := make([]float64, len(points))
+	for i, point := range points {
+		latitudes[i] = point.Latitude
+		longitudes[i] = point.Longitude
+	}
+	return model.LocationPoint{Latitude: median(latitudes), Longitude: median(longitudes)}
+}
+
+// median 计算中位数，偶数个数时取中间两个数的平均值
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
+
+// odometerDistance 返回订单行程中按定位累加的里程（公里），保留两位小数
+// 行程中的有效定位少于两个时无法计算里程，返回 false
+func odometerDistance(orderID uint) (float64, bool, error) {
+	state, err := loadOdometer(orderID)
+	if err != nil {
+		return 0, false, err
+	}
+	if state.InProgressCount < 2 {
+		return 0, false, nil
+	}
+	return math.Round(state.Distance*100) / 100, true, nil
+}
+
+// clearOdometer 行程结束后删除订单的定位处理状态
+func clearOdometer(orderID uint) error {
+	return redis.RedisClient.Del(context.Background(), odometerKey(orderID)).Err()
+}
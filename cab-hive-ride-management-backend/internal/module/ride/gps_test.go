@@ -0,0 +1,163 @@
+package ride
+
+import (
+	"math"
+	"testing"
+
+	"cab-hive/config"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+
+	"github.com/alicebob/miniredis/v2"
+	go_redis "github.com/redis/go-redis/v9"
+)
+
+// setupTestRedis 使用内存Redis和默认配置初始化行程模块
+func setupTestRedis(t *testing.T) {
+	t.Helper()
+	config.Set(config.Config{})
+
+	server := miniredis.RunT(t)
+	redis.RedisClient = go_redis.NewClient(&go_redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { redis.RedisClient.Close() })
+}
+
+func TestMedianPoint(t *testing.T) {
+	tests := []struct {
+		name     string
+		points   model.LocationPoints
+		expected model.LocationPoint
+	}{
+		{
+			name:     "单个定位",
+			points:   model.LocationPoints{{Latitude: 36.1, Longitude: 117.1}},
+			expected: model.LocationPoint{Latitude: 36.1, Longitude: 117.1},
+		},
+		{
+			name:     "偶数个定位取中间两个的平均值",
+			points:   model.LocationPoints{{Latitude: 36.4, Longitude: 117.1}, {Latitude: 36.1, Longitude: 117.4}},
+			expected: model.LocationPoint{Latitude: 36.25, Longitude: 117.25},
+		},
+		{
+			// 经度和纬度分别取中位数，跳变的定位不影响结果
+			name: "奇数个定位过滤跳变",
+			points: model.LocationPoints{
+				{Latitude: 36.1, Longitude: 117.3},
+				{Latitude: 36.9, Longitude: 117.1},
+				{Latitude: 36.2, Longitude: 117.2},
+			},
+			expected: model.LocationPoint{Latitude: 36.2, Longitude: 117.2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point := medianPoint(tt.points)
+			if math.Abs(point.Latitude-tt.expected.Latitude) > 1e-9 || math.Abs(point.Longitude-tt.expected.Longitude) > 1e-9 {
+				t.Errorf("平滑位置 = %+v，期望 %+v", point, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCheckLocation(t *testing.T) {
+	config.Set(config.Config{})
+	last := &odometerState{LastTime: 1752633000000, LastLatitude: 36.0, LastLongitude: 117.0}
+
+	tests := []struct {
+		name      string
+		state     *odometerState
+		latitude  float64
+		timestamp int64
+		dropped   bool
+	}{
+		{name: "第一个定位", state: &odometerState{}, latitude: 36.0, timestamp: 1752633000000},
+		{name: "时间戳相同", state: last, latitude: 36.0001, timestamp: 1752633000000, dropped: true},
+		{name: "时间戳早于上一次定位", state: last, latitude: 36.0001, timestamp: 1752632990000, dropped: true},
+		// 10秒移动约111米，车速约40公里/小时
+		{name: "正常行驶", state: last, latitude: 36.001, timestamp: 1752633010000},
+		// 10秒移动约1.1公里，车速约400公里/小时
+		{name: "车速过快", state: last, latitude: 36.01, timestamp: 1752633010000, dropped: true},
+		// 间隔足够长时同样的位移是合理的
+		{name: "间隔较长的位移", state: last, latitude: 36.01, timestamp: 1752633060000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason := checkLocation(tt.state, tt.latitude, 117.0, tt.timestamp)
+			if (reason != "") != tt.dropped {
+				t.Errorf("丢弃原因 = %q，期望丢弃 %v", reason, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestProcessLocationOdometer(t *testing.T) {
+	setupTestRedis(t)
+	orderModel := &model.Order{Model: model.Model{ID: 1}, Status: model.OrderStatusDriverArrived}
+	const start = int64(1752633000000)
+
+	fixes := []struct {
+		status    string
+		latitude  float64
+		timestamp int64
+		dropped   bool
+	}{
+		// 接到乘客前的定位不累加里程
+		{status: model.OrderStatusDriverArrived, latitude: 35.999, timestamp: start - 20000},
+		{status: model.OrderStatusDriverArrived, latitude: 36.0, timestamp: start - 10000},
+		{status: model.OrderStatusInProgress, latitude: 36.0, timestamp: start},
+		{status: model.OrderStatusInProgress, latitude: 36.001, timestamp: start + 10000},
+		// 乱序到达的定位被丢弃
+		{status: model.OrderStatusInProgress, latitude: 36.0005, timestamp: start + 5000, dropped: true},
+		{status: model.OrderStatusInProgress, latitude: 36.002, timestamp: start + 20000},
+		// 跳变的定位被丢弃
+		{status: model.OrderStatusInProgress, latitude: 36.1, timestamp: start + 30000, dropped: true},
+		{status: model.OrderStatusInProgress, latitude: 36.003, timestamp: start + 30000},
+		{status: model.OrderStatusInProgress, latitude: 36.004, timestamp: start + 40000},
+	}
+	for i, fix := range fixes {
+		orderModel.Status = fix.status
+		smoothed, reason, err := processLocation(orderModel, fix.latitude, 117.0, fix.timestamp)
+		if err != nil {
+			t.Fatalf("第%d个定位处理失败: %v", i+1, err)
+		}
+		if (smoothed == nil) != fix.dropped {
+			t.Errorf("第%d个定位丢弃原因 = %q，期望丢弃 %v", i+1, reason, fix.dropped)
+		}
+	}
+
+	state, err := loadOdometer(orderModel.ID)
+	if err != nil {
+		t.Fatalf("读取里程状态失败: %v", err)
+	}
+	if state.Dropped != 2 {
+		t.Errorf("丢弃数量 = %d，期望 2", state.Dropped)
+	}
+	if state.InProgressCount != 5 {
+		t.Errorf("行程中有效定位数量 = %d，期望 5", state.InProgressCount)
+	}
+
+	// 窗口内取中位数后，行程中的平滑位置由纬度36.0移动到36.002
+	distance, ok, err := odometerDistance(orderModel.ID)
+	if err != nil || !ok {
+		t.Fatalf("计算里程失败: %v, %v", ok, err)
+	}
+	expected := math.Round(calculateDistance(36.0, 117.0, 36.002, 117.0)*100) / 100
+	if distance != expected {
+		t.Errorf("里程 = %.2f，期望 %.2f", distance, expected)
+	}
+}
+
+func TestOdometerDistanceTooFewFixes(t *testing.T) {
+	setupTestRedis(t)
+	orderModel := &model.Order{Model: model.Model{ID: 1}, Status: model.OrderStatusInProgress}
+	if _, _, err := processLocation(orderModel, 36.0, 117.0, 1752633000000); err != nil {
+		t.Fatalf("定位处理失败: %v", err)
+	}
+
+	// 行程中只有一个有效定位时无法计算里程
+	if _, ok, err := odometerDistance(orderModel.ID); err != nil || ok {
+		t.Errorf("计算里程 = %v, %v，期望无法计算", ok, err)
+	}
+}
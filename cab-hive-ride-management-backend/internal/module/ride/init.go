@@ -1,7 +1,9 @@
 package ride
 
 import (
+	"cab-hive/config"
 	"cab-hive/internal/global/logger"
+	"cab-hive/internal/module/order"
 	"log/slog"
 )
 
@@ -18,6 +20,20 @@ func (m *ModuleRide) GetName() string {
 // Init 初始化乘车模块
 func (m *ModuleRide) Init() {
 	log = logger.New("ride")
+
+	// 行程结束或取消后保存订单轨迹
+	order.OnTransition(persistTrail)
+
+	// 启动司机心跳检测
+	go watchHeartbeats()
+
+	// 启动预约单调度
+	go scheduleReservations()
+
+	// 启动自动派单
+	if config.Get().Dispatch.AutoDispatch {
+		go runDispatcher()
+	}
 }
 
 // selfInit 自初始化函数
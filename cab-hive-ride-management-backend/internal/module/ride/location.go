@@ -7,6 +7,7 @@ import (
 	"cab-hive/internal/global/response"
 	"cab-hive/internal/model"
 	"cab-hive/internal/module/order"
+	"cab-hive/internal/module/realtime"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -30,6 +31,12 @@ type DriverLocation struct {
 type UploadLocationRequest struct {
 	Latitude  float64 `json:"latitude" binding:"required"`
 	Longitude float64 `json:"longitude" binding:"required"`
+	Timestamp int64   `json:"timestamp"` // 定位时间（Unix毫秒），不填时使用服务器时间
+}
+
+// UploadLocationResponse 定义上传位置响应的结构体
+type UploadLocationResponse struct {
+	UploadInterval int `json:"upload_interval"` // 建议下次上传位置的间隔（秒），订单有司机发起的紧急求助时缩短
 }
 
 // UploadLocation 处理司机上传位置信息的请求
@@ -61,82 +68,127 @@ func UploadLocation(c *gin.Context) {
 		return
 	}
 
+	// 定位时间以客户端上报为准，未上报或明显超前于服务器时间时使用服务器时间
+	now := time.Now()
+	timestamp := req.Timestamp
+	if timestamp <= 0 || timestamp > now.Add(maxClockSkew).UnixMilli() {
+		timestamp = now.UnixMilli()
+	}
+
 	// 创建位置信息
 	location := DriverLocation{
 		OpenID:     payload.OpenID,
 		Latitude:   req.Latitude,
 		Longitude:  req.Longitude,
-		UpdateTime: time.Now().Unix(),
+		UpdateTime: timestamp / 1000,
 	}
 
-	// 将位置信息存储到 Redis
-	err := saveDriverLocation(location)
+	// 检查司机是否有进行中的订单，进行中订单的定位需要先过滤和平滑
+	activeOrder, err := getDriverActiveOrder(payload.OpenID)
 	if err != nil {
+		log.Error("查询司机进行中订单时出错", "error", err)
+		// 即使出错也继续执行，按原始定位保存
+	} else if activeOrder != nil {
+		smoothed, reason, err := processLocation(activeOrder, req.Latitude, req.Longitude, timestamp)
+		if err != nil {
+			log.Error("处理司机定位失败，使用原始定位", "error", err, "order_id", activeOrder.ID)
+		} else if smoothed == nil {
+			// 不可信的定位不保存也不推送，但仍视为一次心跳
+			log.Warn("丢弃不可信的司机定位", "reason", reason, "driver_open_id", payload.OpenID, "order_id", activeOrder.ID)
+			if err := recordHeartbeat(location); err != nil {
+				log.Error("记录司机心跳失败", "error", err, "driver_open_id", payload.OpenID)
+			}
+			response.Success(c, newUploadLocationResponse(activeOrder))
+			return
+		} else {
+			location.Latitude = smoothed.Latitude
+			location.Longitude = smoothed.Longitude
+		}
+	}
+
+	// 将位置信息存储到 Redis
+	if err := saveDriverLocation(location); err != nil {
 		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
 		return
 	}
 
-	// 检查司机是否有进行中的订单
-	activeOrder, err := getDriverActiveOrder(payload.OpenID)
-	if err != nil {
-		log.Error("查询司机进行中订单时出错", "error", err)
-		// 即使出错也继续执行，因为位置上传本身是成功的
-	} else if activeOrder != nil {
+	// 在线司机上传位置即视为心跳，同时维护空闲司机索引
+	if err := recordHeartbeat(location); err != nil {
+		log.Error("记录司机心跳失败", "error", err, "driver_open_id", payload.OpenID)
+	}
+
+	if activeOrder != nil {
+		// 追加到订单轨迹，行程结束后写入数据库
+		if err := appendTrailPoint(activeOrder.ID, model.TrailPoint{
+			Latitude:  location.Latitude,
+			Longitude: location.Longitude,
+			Status:    activeOrder.Status,
+			Time:      location.UpdateTime,
+		}); err != nil {
+			log.Error("追加订单轨迹失败", "error", err, "order_id", activeOrder.ID)
+		}
+
+		// 推送司机位置给订阅该订单的客户端
+		if err := realtime.PublishLocation(activeOrder.ID, realtime.LocationData{
+			DriverOpenID: payload.OpenID,
+			Latitude:     location.Latitude,
+			Longitude:    location.Longitude,
+			UpdateTime:   location.UpdateTime,
+		}); err != nil {
+			log.Error("推送司机位置失败", "error", err, "order_id", activeOrder.ID)
+		}
+
 		// 检查订单状态
 		if activeOrder.Status == model.OrderStatusWaitingForPickup {
 			// 如果订单状态是等待司机到达起点，则检查司机是否接近起点
 			distance := calculateDistance(
-				req.Latitude, req.Longitude,
+				location.Latitude, location.Longitude,
 				activeOrder.StartLocation.Latitude, activeOrder.StartLocation.Longitude)
 
 			// 设置距离阈值（单位：公里），20米 = 0.02公里
 			const distanceThreshold = 0.02 // 20米阈值
 
-			// 如果距离小于阈值，则记录日志并更新订单状态
+			// 如果距离小于阈值，则更新订单状态为司机已到达
 			if distance <= distanceThreshold {
-				// 更新订单状态为司机已到达
-				activeOrder.Status = model.OrderStatusDriverArrived
-				if err := database.DB.Model(&model.Order{}).Where("id = ?", activeOrder.ID).Update("status", model.OrderStatusDriverArrived).Error; err != nil {
+				if err := order.Transition(activeOrder, model.OrderStatusDriverArrived,
+					order.DriverActor(payload.OpenID, "司机到达上车点").At(location.Latitude, location.Longitude), nil); err != nil {
 					log.Error("更新订单状态失败", "error", err, "order_id", activeOrder.ID)
-				} else {
-					// 更新Redis中的订单状态
-					// 先从旧状态集合中移除
-					if err := order.RemoveOrderFromRedis(activeOrder.ID, model.OrderStatusWaitingForPickup); err != nil {
-						log.Error("从Redis移除订单失败", "error", err, "order_id", activeOrder.ID)
-					}
-					// 再添加到新状态集合中
-					if err := order.AddOrderToRedisStatusSet(activeOrder); err != nil {
-						log.Error("添加订单到Redis失败", "error", err, "order_id", activeOrder.ID)
-					}
 				}
 			}
-		} else {
-			// 否则进行原来的司机偏离路线的检测
-			// 计算司机当前位置与订单路线点的最短距离
-			distance := calculateDistanceToRoutePoints(
-				req.Latitude, req.Longitude,
-				activeOrder.RoutePoints)
-
-			// 设置距离阈值（单位：公里）
-			const distanceThreshold = 50.0 // 50公里阈值
-
-			// 如果距离超过阈值，则报警
-			if distance > distanceThreshold {
-				log.Warn("警告：司机当前位置距离订单路线过远",
-					"driver_open_id", payload.OpenID,
-					"distance", fmt.Sprintf("%.2f公里", distance),
-					"threshold", fmt.Sprintf("%.2f公里", distanceThreshold))
+		} else if activeOrder.Status == model.OrderStatusInProgress {
+			// 行程中检测司机是否偏离规划路线
+			if err := checkDeviation(activeOrder, location); err != nil {
+				log.Error("检测司机偏航失败", "error", err, "order_id", activeOrder.ID)
 			}
 		}
 	}
 
 	// 返回成功响应
-	response.Success(c, nil)
+	response.Success(c, newUploadLocationResponse(activeOrder))
 }
 
-// GetDriverLocation 处理查询司机位置信息的请求
-// 公开接口，任何认证用户都可以查询
+// GetDriverLocation 处理按司机ID查询司机位置信息的请求
+// 仅限管理员，需要填写查看原因并记录审计；乘客通过订单查询承接司机的位置
 func GetDriverLocation(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为管理员
+	if payload.RoleID != 3 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
 	// 获取司机 ID 参数
 	driverID := c.Param("id")
 	if driverID == "" {
@@ -144,6 +196,12 @@ func GetDriverLocation(c *gin.Context) {
 		return
 	}
 
+	// 记录审计
+	if err := auditLocationAccess(c, payload.OpenID, driverID, 0, model.LocationAuditSourceDriver); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
 	// 从 Redis 获取司机位置信息
 	location, err := getDriverLocation(driverID)
 	if err != nil {
@@ -217,6 +275,16 @@ func getDriverActiveOrder(driverOpenID string) (*model.Order, error) {
 	return &order, nil
 }
 
+// driverActor 创建附带司机最新位置的订单操作人
+// 获取不到司机位置时不记录位置
+func driverActor(driverOpenID, reason string) order.Actor {
+	actor := order.DriverActor(driverOpenID, reason)
+	if location, err := getDriverLocation(driverOpenID); err == nil {
+		actor = actor.At(location.Latitude, location.Longitude)
+	}
+	return actor
+}
+
 // calculateDistance 计算两个经纬度点之间的距离（使用Haversine公式）
 // 返回距离（单位：公里）
 func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
@@ -241,25 +309,3 @@ func calculateDistance(lat1, lon1, lat2, lon2 float64) float64 {
 	distance := earthRadius * c
 	return distance
 }
-
-// calculateDistanceToRoutePoints 计算司机位置到订单路线点的最短距离
-// 返回距离（单位：公里）
-func calculateDistanceToRoutePoints(driverLat, driverLon float64, routePoints model.LocationPoints) float64 {
-	// 如果路线点为空，返回最大距离
-	if len(routePoints) == 0 {
-		return math.MaxFloat64
-	}
-
-	// 初始化最短距离为最大值
-	minDistance := math.MaxFloat64
-
-	// 遍历所有路线点，计算到每个点的距离，找出最短距离
-	for _, point := range routePoints {
-		distance := calculateDistance(driverLat, driverLon, point.Latitude, point.Longitude)
-		if distance < minDistance {
-			minDistance = distance
-		}
-	}
-
-	return minDistance
-}
@@ -0,0 +1,178 @@
+package ride
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// LocationAuditResponse 定义司机位置查看审计记录响应的结构体
+type LocationAuditResponse struct {
+	ID           uint   `json:"id"`
+	AdminOpenID  string `json:"admin_open_id"`
+	DriverOpenID string `json:"driver_open_id"`
+	OrderID      uint   `json:"order_id"`
+	Source       string `json:"source"`
+	Reason       string `json:"reason"`
+	ClientIP     string `json:"client_ip"`
+	CreateTime   string `json:"create_time"`
+}
+
+// LocationAuditListResponse 定义司机位置查看审计记录列表响应的结构体
+type LocationAuditListResponse struct {
+	Audits     []LocationAuditResponse `json:"audits"`
+	Pagination order.Pagination        `json:"pagination"`
+}
+
+// locationVisibleStatuses 乘客可以查看承接司机位置的订单状态
+var locationVisibleStatuses = map[string]bool{
+	model.OrderStatusWaitingForPickup: true,
+	model.OrderStatusDriverArrived:    true,
+	model.OrderStatusInProgress:       true,
+}
+
+// GetOrderDriverLocation 处理查询订单承接司机位置的请求
+// 只有订单的乘客在等待接驾、司机已到达和行程中可以查看，管理员填写原因后可以查看并记录审计
+func GetOrderDriverLocation(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 查找订单，非管理员只能查看自己的订单
+	query := database.DB.Where("id = ?", c.Param("id"))
+	if payload.RoleID != 3 {
+		query = query.Where("user_open_id = ?", payload.OpenID)
+	}
+	var orderModel model.Order
+	if err := query.First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if orderModel.DriverOpenID == "" {
+		response.Fail(c, response.ErrNotFound.WithTips("订单尚未有司机承接"))
+		return
+	}
+
+	if payload.RoleID == 3 {
+		// 管理员查看需要填写原因并记录审计
+		if err := auditLocationAccess(c, payload.OpenID, orderModel.DriverOpenID, orderModel.ID, model.LocationAuditSourceOrder); err != nil {
+			response.Fail(c, err)
+			return
+		}
+	} else if !locationVisibleStatuses[orderModel.Status] {
+		response.Fail(c, response.ErrForbidden.WithTips("订单当前状态不能查看司机位置"))
+		return
+	}
+
+	// 从 Redis 获取司机位置信息
+	location, err := getDriverLocation(orderModel.DriverOpenID)
+	if err != nil {
+		response.Fail(c, response.ErrNotFound.WithTips("未找到司机位置信息"))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, location)
+}
+
+// GetLocationAudits 处理管理员查询司机位置查看审计记录的请求
+func GetLocationAudits(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.LocationAudit{})
+	if adminOpenID := c.Query("admin_open_id"); adminOpenID != "" {
+		query = query.Where("admin_open_id = ?", adminOpenID)
+	}
+	if driverOpenID := c.Query("driver_open_id"); driverOpenID != "" {
+		query = query.Where("driver_open_id = ?", driverOpenID)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 查询审计记录
+	var audits []model.LocationAudit
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("id DESC").Find(&audits).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	auditList := make([]LocationAuditResponse, len(audits))
+	for i, audit := range audits {
+		auditList[i] = LocationAuditResponse{
+			ID:           audit.ID,
+			AdminOpenID:  audit.AdminOpenID,
+			DriverOpenID: audit.DriverOpenID,
+			OrderID:      audit.OrderID,
+			Source:       audit.Source,
+			Reason:       audit.Reason,
+			ClientIP:     audit.ClientIP,
+			CreateTime:   audit.CreatedAt.Format("2006/01/02 15:04:05"),
+		}
+	}
+
+	// 返回成功响应
+	response.Success(c, LocationAuditListResponse{
+		Audits: auditList,
+		Pagination: order.Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	})
+}
+
+// auditLocationAccess 记录管理员查看司机位置的审计记录
+// 查看原因从请求参数 reason 中读取，未填写时返回业务错误
+func auditLocationAccess(c *gin.Context, adminOpenID, driverOpenID string, orderID uint, source string) error {
+	reason := strings.TrimSpace(c.Query("reason"))
+	if reason == "" {
+		return response.ErrInvalidRequest.WithTips("管理员查看司机位置需要填写原因")
+	}
+
+	audit := model.LocationAudit{
+		AdminOpenID:  adminOpenID,
+		DriverOpenID: driverOpenID,
+		OrderID:      orderID,
+		Source:       source,
+		Reason:       reason,
+		ClientIP:     c.ClientIP(),
+	}
+	if err := database.DB.Create(&audit).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	log.Warn("管理员查看司机位置", "admin_open_id", adminOpenID, "driver_open_id", driverOpenID, "order_id", orderID, "source", source, "reason", reason)
+	return nil
+}
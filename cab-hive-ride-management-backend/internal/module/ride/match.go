@@ -0,0 +1,177 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+	"context"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 订单匹配使用的Redis键
+const (
+	orderGeoKeyBase    = "ride_orders_by_start_location:" // 各状态订单起点地理位置索引前缀
+	orderStatusKeyBase = "ride_orders:"                   // 订单状态集合前缀
+	orderKeyBase       = "ride_order:"                    // 订单内容前缀
+)
+
+// defaultSearchRadii 未配置搜索半径时使用的扩展步长（公里）
+var defaultSearchRadii = []float64{1, 3, 5, 10}
+
+// defaultSearchLimit 未配置时每个半径最多取回的订单数量
+const defaultSearchLimit = 50
+
+// orderCandidate 定义候选订单及其与司机的距离
+type orderCandidate struct {
+	order    model.Order
+	distance float64 // 司机到订单起点的距离（公里）
+}
+
+// searchRadii 获取订单搜索半径的扩展步长
+// maxDistance 大于0时只保留不超过该距离的半径，并以该距离作为最后一步
+func searchRadii(maxDistance float64) []float64 {
+	radii := config.Get().Dispatch.SearchRadii
+	if len(radii) == 0 {
+		radii = defaultSearchRadii
+	}
+	if maxDistance <= 0 {
+		return radii
+	}
+
+	limited := make([]float64, 0, len(radii)+1)
+	for _, radius := range radii {
+		if radius < maxDistance {
+			limited = append(limited, radius)
+		}
+	}
+	return append(limited, maxDistance)
+}
+
+// searchLimit 获取每个半径最多取回的订单数量
+func searchLimit() int {
+	if limit := config.Get().Dispatch.SearchLimit; limit > 0 {
+		return limit
+	}
+	return defaultSearchLimit
+}
+
+// driverMatchDistance 根据司机的平均评分获取可匹配订单的最大距离（单位：公里）
+// 评价次数足够且平均评分低于阈值的司机只能匹配近距离订单，返回0表示不限制
+func driverMatchDistance(driverOpenID string) (float64, error) {
+	dispatch := config.Get().Dispatch
+	if dispatch.LowRatingThreshold <= 0 || dispatch.LowRatingMaxDistance <= 0 {
+		return 0, nil
+	}
+
+	var driver model.Driver
+	if err := database.DB.Where("open_id = ?", driverOpenID).First(&driver).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if driver.RatingCount >= dispatch.LowRatingMinCount && driver.Rating < dispatch.LowRatingThreshold {
+		log.Info("司机评分较低，限制匹配距离", "driver_open_id", driverOpenID, "rating", driver.Rating, "max_distance", dispatch.LowRatingMaxDistance)
+		return dispatch.LowRatingMaxDistance, nil
+	}
+	return 0, nil
+}
+
+// matchOrder 为司机匹配订单
+// 使用订单起点的GEO索引按半径由小到大搜索，只在当前半径内没有等待接单的订单时才扩大半径，
+// 由配置的派单策略从候选订单中选出订单，maxDistance 大于0时只匹配该距离（公里）以内的订单，没有合适的订单时返回nil
+func matchOrder(driverLocation *DriverLocation, maxDistance float64) (*model.Order, error) {
+	for _, radius := range searchRadii(maxDistance) {
+		candidates, err := searchWaitingOrders(driverLocation, radius)
+		if err != nil {
+			return nil, err
+		}
+		if len(candidates) > 0 {
+			return pickOrder(driverLocation.OpenID, candidates), nil
+		}
+	}
+	return nil, nil
+}
+
+// searchWaitingOrders 查找司机附近指定半径（公里）内等待接单的订单
+func searchWaitingOrders(driverLocation *DriverLocation, radius float64) ([]orderCandidate, error) {
+	return searchOrdersByStatus(driverLocation, radius, model.OrderStatusWaitingForDriver, searchLimit())
+}
+
+// searchOrdersByStatus 查找司机附近指定半径（公里）内指定状态的订单，按起点距离由近到远排序，最多返回 limit 个
+// 每个状态的订单使用单独的GEO索引，搜索时直接限制数量，不会扫描其他状态的订单
+func searchOrdersByStatus(driverLocation *DriverLocation, radius float64, status string, limit int) ([]orderCandidate, error) {
+	ctx := context.Background()
+	redisClient := redis.RedisClient
+
+	// 按起点距离由近到远搜索订单
+	locations, err := redisClient.GeoSearchLocation(ctx, orderGeoKeyBase+status, &go_redis.GeoSearchLocationQuery{
+		GeoSearchQuery: go_redis.GeoSearchQuery{
+			Longitude:  driverLocation.Longitude,
+			Latitude:   driverLocation.Latitude,
+			Radius:     radius,
+			RadiusUnit: "km",
+			Sort:       "ASC",
+			Count:      limit,
+		},
+		WithDist: true,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(locations) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(locations))
+	distances := make([]float64, len(locations))
+	for i, location := range locations {
+		keys[i] = orderKeyBase + location.Name
+		distances[i] = location.Dist
+	}
+
+	// 批量获取订单内容
+	values, err := redisClient.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make([]orderCandidate, 0, len(values))
+	for i, value := range values {
+		orderJSON, ok := value.(string)
+		if !ok {
+			continue // 跳过已过期的订单
+		}
+
+		var orderModel model.Order
+		if err := json.Unmarshal([]byte(orderJSON), &orderModel); err != nil {
+			continue // 跳过无法解析的订单
+		}
+		candidates = append(candidates, orderCandidate{order: orderModel, distance: distances[i]})
+	}
+
+	return candidates, nil
+}
+
+// pickOrder 由配置的派单策略从候选订单中为司机选出订单
+func pickOrder(driverOpenID string, candidates []orderCandidate) *model.Order {
+	orders := make([]*model.Order, len(candidates))
+	distances := make([][]float64, len(candidates))
+	for i := range candidates {
+		orders[i] = &candidates[i].order
+		distances[i] = []float64{candidates[i].distance}
+	}
+
+	problem := newDispatchProblem(orders, []string{driverOpenID}, distances)
+	assignments := currentStrategy().Assign(problem)
+	if len(assignments) == 0 {
+		return nil
+	}
+	return orders[assignments[0].Order]
+}
@@ -0,0 +1,144 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// reservationLockKey 预约单调度锁，保证多实例部署时同一时刻只有一个实例处理预约单
+const reservationLockKey = "reservation:lock"
+
+// 预约单调度默认配置
+const (
+	defaultReservationLeadTime      = 10 * time.Minute // 距预约时间不超过该值时转为即时单
+	defaultReservationCheckInterval = 30 * time.Second // 预约单调度扫描间隔
+)
+
+// reservationLeadTime 获取预约单提前转为即时单的时间
+func reservationLeadTime() time.Duration {
+	if leadTime := config.Get().Reservation.LeadTime; leadTime > 0 {
+		return time.Duration(leadTime) * time.Second
+	}
+	return defaultReservationLeadTime
+}
+
+// reservationCheckInterval 获取预约单调度扫描间隔
+func reservationCheckInterval() time.Duration {
+	if interval := config.Get().Reservation.CheckInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return defaultReservationCheckInterval
+}
+
+// isOverdueReservation 判断订单是否为已过预约时间仍未派出的预约单
+func isOverdueReservation(orderModel *model.Order, now time.Time) bool {
+	return orderModel.ReserveTime != nil && now.After(*orderModel.ReserveTime)
+}
+
+// scheduleReservations 定期将临近预约时间的预约单转为即时单
+func scheduleReservations() {
+	ticker := time.NewTicker(reservationCheckInterval())
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 获取调度锁，锁在一个扫描间隔后自动释放
+		locked, err := redis.RedisClient.SetNX(context.Background(), reservationLockKey, time.Now().Unix(), reservationCheckInterval()).Result()
+		if err != nil {
+			log.Error("获取预约单调度锁失败", "error", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		if err := processClaims(); err != nil {
+			log.Error("处理预约订单认领失败", "error", err)
+		}
+
+		processedOrders, err := promoteReserveOrders(order.SystemActor("预约时间临近，转为即时单"))
+		if err != nil {
+			log.Error("处理预约订单失败", "error", err)
+			continue
+		}
+		if len(processedOrders) > 0 {
+			log.Info("预约订单转为即时单", "order_ids", processedOrders)
+		}
+	}
+}
+
+// promoteReserveOrders 将距预约时间不超过提前量的预约单转为即时单，返回处理的订单ID
+// 预约单从数据库中查询，Redis中的订单内容有过期时间，不能覆盖提前一天以上的预约单；
+// 按预约时间由早到晚处理，乘客有其他进行中的订单时跳过，等待下一次调度；
+// 已被司机认领的订单由认领的司机直接承接，司机未能承接时转为普通派单
+func promoteReserveOrders(actor order.Actor) ([]uint, error) {
+	// 查询临近预约时间的预约单
+	deadline := time.Now().Add(reservationLeadTime())
+	var dueOrders []model.Order
+	if err := database.DB.Where("status = ? AND reserve_time <= ?", model.OrderStatusReserved, deadline).
+		Order("reserve_time ASC").Find(&dueOrders).Error; err != nil {
+		return nil, err
+	}
+
+	// 查询临近预约时间订单的有效认领
+	claims := make(map[uint]*model.ReservationClaim)
+	if len(dueOrders) > 0 {
+		dueOrderIDs := make([]uint, len(dueOrders))
+		for i := range dueOrders {
+			dueOrderIDs[i] = dueOrders[i].ID
+		}
+		var claimList []model.ReservationClaim
+		if err := database.DB.Where("order_id IN ? AND status = ?", dueOrderIDs, model.ClaimStatusActive).Find(&claimList).Error; err != nil {
+			return nil, err
+		}
+		for i := range claimList {
+			claims[claimList[i].OrderID] = &claimList[i]
+		}
+	}
+
+	var processedOrders []uint
+	for i := range dueOrders {
+		orderModel := &dueOrders[i]
+
+		// 检查用户是否有除该预约单以外进行中的订单
+		var unfinishedOrder model.Order
+		err := database.DB.Where("user_open_id = ? AND id <> ? AND status NOT IN (?, ?)",
+			orderModel.UserOpenID, orderModel.ID, model.OrderStatusCompleted, model.OrderStatusCancelled).
+			First(&unfinishedOrder).Error
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Error("查询用户未完成订单失败", "error", err, "order_id", orderModel.ID)
+			continue
+		}
+
+		// 已认领的订单优先由认领的司机承接
+		if claim, ok := claims[orderModel.ID]; ok && fulfillClaim(orderModel, claim) {
+			processedOrders = append(processedOrders, orderModel.ID)
+			continue
+		}
+
+		// 更新订单状态为等待司机接单，使用预约时间作为开始时间
+		// 状态机以订单当前状态为条件更新，乘客同时取消订单时跳过
+		if err := order.Transition(orderModel, model.OrderStatusWaitingForDriver, actor, map[string]interface{}{
+			"start_time": orderModel.ReserveTime,
+		}); err != nil {
+			if !errors.Is(err, response.ErrOrderStatusConflict) {
+				log.Error("更新预约订单状态失败", "error", err, "order_id", orderModel.ID)
+			}
+			continue
+		}
+
+		processedOrders = append(processedOrders, orderModel.ID)
+	}
+	return processedOrders, nil
+}
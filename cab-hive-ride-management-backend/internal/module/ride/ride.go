@@ -3,18 +3,12 @@ package ride
 import (
 	"cab-hive/internal/global/database"
 	"cab-hive/internal/global/jwt"
-	"cab-hive/internal/global/redis"
 	"cab-hive/internal/global/response"
 	"cab-hive/internal/model"
 	"cab-hive/internal/module/order"
-	"context"
-	"encoding/json"
-	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/pkg/errors"
 	"gorm.io/gorm"
-	"math"
-	"time"
 )
 
 // RequestOrderResponse 定义请求订单的响应结构
@@ -38,6 +32,7 @@ type RequestOrderResponse struct {
 	CancelReason  string               `json:"cancel_reason"`
 	Rating        int                  `json:"rating"`
 	ReserveTime   *string              `json:"reserve_time"`
+	FareDetail    model.FareBreakdown  `json:"fare_detail"`
 }
 
 // RequestOrder 处理司机请求订单的请求
@@ -76,6 +71,17 @@ func RequestOrder(c *gin.Context) {
 		return
 	}
 
+	// 只有在线的司机才能请求订单
+	online, err := isDriverOnline(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+	if !online {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("司机未上线，无法请求订单"))
+		return
+	}
+
 	// 从Redis中获取司机位置信息
 	driverLocation, err := getDriverLocation(payload.OpenID)
 	if err != nil {
@@ -83,8 +89,15 @@ func RequestOrder(c *gin.Context) {
 		return
 	}
 
-	// 从Redis中匹配最近的订单
-	matchedOrder, err := matchNearestOrder(driverLocation)
+	// 按司机评分确定可匹配的订单距离
+	maxDistance, err := driverMatchDistance(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 从Redis中按派单策略匹配订单
+	matchedOrder, err := matchOrder(driverLocation, maxDistance)
 	if err != nil {
 		response.Fail(c, response.ErrDatabase.WithOrigin(err))
 		return
@@ -94,8 +107,13 @@ func RequestOrder(c *gin.Context) {
 		return
 	}
 
-	// 转换为响应格式
-	orderResp := RequestOrderResponse{
+	// 返回成功响应
+	response.Success(c, newRequestOrderResponse(matchedOrder))
+}
+
+// newRequestOrderResponse 将订单转换为司机端订单响应格式
+func newRequestOrderResponse(matchedOrder *model.Order) RequestOrderResponse {
+	return RequestOrderResponse{
 		ID:            matchedOrder.ID,
 		UserOpenID:    matchedOrder.UserOpenID,
 		DriverOpenID:  matchedOrder.DriverOpenID,
@@ -139,10 +157,8 @@ func RequestOrder(c *gin.Context) {
 			}
 			return nil
 		}(),
+		FareDetail: matchedOrder.FareDetail,
 	}
-
-	// 返回成功响应
-	response.Success(c, orderResp)
 }
 
 // TakeOrderRequest 定义接单请求的结构体
@@ -187,6 +203,17 @@ func TakeOrder(c *gin.Context) {
 		return
 	}
 
+	// 只有在线的司机才能接单
+	online, err := isDriverOnline(payload.OpenID)
+	if err != nil {
+		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+		return
+	}
+	if !online {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("司机未上线，无法接单"))
+		return
+	}
+
 	// 解析请求参数
 	var req TakeOrderRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -217,92 +244,33 @@ func TakeOrder(c *gin.Context) {
 	}
 
 	// 更新订单状态、司机信息和车辆ID
-	orderModel.DriverOpenID = payload.OpenID
-	orderModel.VehicleID = req.VehicleID
-	orderModel.Status = model.OrderStatusWaitingForPickup
-
-	// 更新订单状态和司机信息
-	orderModel.DriverOpenID = payload.OpenID
-	orderModel.Status = model.OrderStatusWaitingForPickup
-
-	// 保存订单到数据库
-	if err := database.DB.Save(&orderModel).Error; err != nil {
-		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+	// 状态机以订单当前状态为条件更新，两个司机同时接单时只有一个能成功
+	if err := order.Transition(&orderModel, model.OrderStatusWaitingForPickup, driverActor(payload.OpenID, "司机接单"), map[string]interface{}{
+		"driver_open_id": payload.OpenID,
+		"vehicle_id":     req.VehicleID,
+	}); err != nil {
+		if errors.Is(err, response.ErrOrderStatusConflict) {
+			response.Fail(c, response.ErrOrderStatusConflict.WithTips("订单已被其他司机接单"))
+		} else {
+			response.Fail(c, err)
+		}
 		return
 	}
 
-	// 更新Redis中的订单状态
-	if err := order.RemoveOrderFromRedis(orderModel.ID, model.OrderStatusWaitingForDriver); err != nil {
-		// 注意：这里不返回错误，因为订单已经成功保存到数据库
-		// Redis操作失败不应该影响主要业务流程
+	// 司机接单后不再是空闲状态，待响应的派单邀请作废
+	if err := markDriverBusy(payload.OpenID); err != nil {
+		log.Error("从空闲司机索引移除司机失败", "error", err, "driver_open_id", payload.OpenID)
 	}
-
-	if err := order.AddOrderToRedisStatusSet(&orderModel); err != nil {
-		// 注意：这里不返回错误，因为订单已经成功保存到数据库
-		// Redis操作失败不应该影响主要业务流程
+	if err := cancelDriverOffers(payload.OpenID); err != nil {
+		log.Error("取消司机待响应的派单邀请失败", "error", err, "driver_open_id", payload.OpenID)
 	}
 
 	// 返回成功响应
 	response.Success(c, nil)
 }
 
-// matchNearestOrder 匹配距离司机最近的订单
-func matchNearestOrder(driverLocation *DriverLocation) (*model.Order, error) {
-	// 从Redis中获取等待司机接单的订单集合
-	ctx := context.Background()
-	redisClient := redis.RedisClient
-
-	// 获取等待司机接单的订单ID集合
-	orderIDs, err := redisClient.SMembers(ctx, "ride_orders:"+model.OrderStatusWaitingForDriver).Result()
-	if err != nil {
-		return nil, err
-	}
-
-	// 如果没有等待接单的订单，返回错误
-	if len(orderIDs) == 0 {
-		return nil, nil
-	}
-
-	// 查找最近的订单
-	var nearestOrder *model.Order
-	minDistance := math.MaxFloat64
-
-	// 遍历所有等待接单的订单
-	for _, orderIDStr := range orderIDs {
-		// 获取订单详细信息
-		orderKey := fmt.Sprintf("ride_order:%s", orderIDStr)
-		orderJSON, err := redisClient.Get(ctx, orderKey).Result()
-		if err != nil {
-			continue // 跳过无法获取的订单
-		}
-
-		// 反序列化订单数据
-		var orderModel model.Order
-		if err := json.Unmarshal([]byte(orderJSON), &orderModel); err != nil {
-			continue // 跳过无法解析的订单
-		}
-
-		// 计算司机与订单路线点的最短距离
-		distance := calculateDistanceToRoutePoints(
-			driverLocation.Latitude, driverLocation.Longitude,
-			orderModel.RoutePoints)
-
-		// 更新最近的订单
-		if distance < minDistance {
-			minDistance = distance
-			nearestOrder = &orderModel
-		}
-	}
-
-	// 如果没有找到合适的订单，返回错误
-	if nearestOrder == nil {
-		return nil, errors.New("没有找到合适的订单")
-	}
-
-	return nearestOrder, nil
-}
-
 // ProcessReserveOrders 处理预约订单，将到达预约时间的订单转换为即时单
+// 预约单由后台调度自动处理，该接口供管理员手动触发
 func ProcessReserveOrders(c *gin.Context) {
 	// 从上下文中获取载荷
 	payloadInterface, exists := c.Get("payload")
@@ -323,75 +291,13 @@ func ProcessReserveOrders(c *gin.Context) {
 		return
 	}
 
-	// 从Redis中获取所有预约中的订单
-	ctx := context.Background()
-	redisClient := redis.RedisClient
-
-	// 获取预约中订单的ID集合
-	orderIDs, err := redisClient.SMembers(ctx, "ride_orders:"+model.OrderStatusReserved).Result()
+	// 处理临近预约时间的订单
+	processedOrders, err := promoteReserveOrders(order.AdminActor(payload.OpenID, "预约时间临近，转为即时单"))
 	if err != nil {
 		response.Fail(c, response.ErrServerInternal.WithOrigin(err))
 		return
 	}
 
-	// 如果没有预约中的订单，直接返回成功
-	if len(orderIDs) == 0 {
-		response.Success(c, nil)
-		return
-	}
-
-	// 处理每个预约订单
-	var processedOrders []uint
-	for _, orderIDStr := range orderIDs {
-		// 获取订单详细信息
-		orderKey := fmt.Sprintf("ride_order:%s", orderIDStr)
-		orderJSON, err := redisClient.Get(ctx, orderKey).Result()
-		if err != nil {
-			continue // 跳过无法获取的订单
-		}
-
-		// 反序列化订单数据
-		var orderModel model.Order
-		if err := json.Unmarshal([]byte(orderJSON), &orderModel); err != nil {
-			continue // 跳过无法解析的订单
-		}
-
-		// 检查预约时间是否已到（离预约时间只剩10分钟）
-		if orderModel.ReserveTime != nil && time.Until(*orderModel.ReserveTime) <= 10*time.Minute {
-			// 检查用户是否有进行中的订单
-			var unfinishedOrder model.Order
-			err := database.DB.Where("user_open_id = ? AND status NOT IN (?, ?)",
-				orderModel.UserOpenID, model.OrderStatusCompleted, model.OrderStatusCancelled).
-				First(&unfinishedOrder).Error
-
-			// 如果用户没有未完成的订单，则处理该预约订单
-			if err != nil && errors.Is(err, gorm.ErrRecordNotFound) {
-				// 更新订单状态为等待司机接单
-				orderModel.Status = model.OrderStatusWaitingForDriver
-				orderModel.StartTime = orderModel.ReserveTime // 使用预约时间作为开始时间
-
-				// 更新数据库中的订单
-				if err := database.DB.Save(&orderModel).Error; err != nil {
-					log.Error("更新预约订单状态失败", "error", err, "order_id", orderModel.ID)
-					continue
-				}
-
-				// 更新Redis中的订单状态
-				// 先从预约状态集合中移除
-				if err := order.RemoveOrderFromRedis(orderModel.ID, model.OrderStatusReserved); err != nil {
-					log.Error("从Redis移除预约订单失败", "error", err, "order_id", orderModel.ID)
-				}
-
-				// 添加到等待司机接单状态集合
-				if err := order.AddOrderToRedisStatusSet(&orderModel); err != nil {
-					log.Error("添加预约订单到等待司机接单集合失败", "error", err, "order_id", orderModel.ID)
-				}
-
-				processedOrders = append(processedOrders, orderModel.ID)
-			}
-		}
-	}
-
 	// 返回成功响应
 	response.Success(c, gin.H{"processed_orders": processedOrders})
 }
@@ -14,23 +14,56 @@ import (
 func (m *ModuleRide) InitRouter(r *gin.RouterGroup) {
 	// 定义乘车模块的路由组，所有乘车相关端点以 /rides 为前缀
 	rideGroup := r.Group("/rides")
+
+	// 乘客查询订单派单进度 - 需要用户认证
+	rideGroup.GET("/dispatch/:id", middleware.Auth(1), GetDispatchStatus)
+
+	// 乘客查询订单承接司机的位置 - 需要用户认证，仅限订单乘客，管理员查看记录审计
+	r.GET("/orders/:id/driver-location", middleware.Auth(1), GetOrderDriverLocation)
+
+	// 查询订单规划路线和实际行驶轨迹 - 需要用户认证，仅限订单乘客、承接司机和管理员
+	r.GET("/orders/:id/route", middleware.Auth(1), GetOrderRoute)
+
+	// 乘客创建行程分享链接 - 需要用户认证，仅限订单乘客
+	r.POST("/orders/:id/share", middleware.Auth(1), CreateTripShare)
+
+	// 查看行程分享页面和内容 - 无需认证，凭签名的分享Token访问，订单结束后失效
+	r.GET("/share/trips/:token", ViewTripShare)
+	r.GET("/share/trips/:token/data", GetTripShare)
 	
 	// 司机位置相关路由 - 需要司机或管理员权限
 	rideGroup.Use(middleware.Auth(2))
 	{
+		// 司机上线接单
+		rideGroup.POST("/online", GoOnline)
+		// 司机下线
+		rideGroup.POST("/offline", GoOffline)
+		// 司机查询自己的在线状态
+		rideGroup.GET("/status", GetDriverStatus)
 		// 司机上传位置
 		rideGroup.POST("/location", UploadLocation)
 		// 司机请求订单
 		rideGroup.GET("/order/request", RequestOrder)
 		// 司机接单
 		rideGroup.POST("/order/take", TakeOrder)
-	}
-	
-	// 获取司机位置 - 需要用户认证（信息公开）
-	rideGroup.Use(middleware.Auth(1))
-	{
-		// 获取司机位置
-		rideGroup.GET("/location/:id", GetDriverLocation)
+		// 司机查询当前派单邀请
+		rideGroup.GET("/offer", GetPendingOffer)
+		// 司机接受派单邀请
+		rideGroup.POST("/offer/accept", AcceptOffer)
+		// 司机拒绝派单邀请
+		rideGroup.POST("/offer/decline", DeclineOffer)
+		// 司机浏览附近可认领的预约订单
+		rideGroup.GET("/reservations", ListReservations)
+		// 司机查询已认领的预约订单
+		rideGroup.GET("/reservations/claimed", GetClaimedReservations)
+		// 司机认领预约订单
+		rideGroup.POST("/reservations/:id/claim", ClaimReservation)
+		// 司机放弃认领预约订单
+		rideGroup.POST("/reservations/:id/release", ReleaseReservation)
+		// 司机接到乘客，开始行程
+		rideGroup.POST("/order/pickup", PickupPassenger)
+		// 司机到达终点，结束行程
+		rideGroup.POST("/order/complete", CompleteTrip)
 	}
 	
 	// 管理员路由 - 需要管理呈权限
@@ -38,5 +71,9 @@ func (m *ModuleRide) InitRouter(r *gin.RouterGroup) {
 	{
 		// 处理预约订单
 		rideGroup.POST("/orders/process-reserve", ProcessReserveOrders)
+		// 按司机ID获取司机位置（记录审计）
+		rideGroup.GET("/location/:id", GetDriverLocation)
+		// 查询司机位置查看审计记录
+		rideGroup.GET("/admin/location-audits", GetLocationAudits)
 	}
 }
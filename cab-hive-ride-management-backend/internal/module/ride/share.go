@@ -0,0 +1,272 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// 行程分享的默认配置
+const (
+	defaultShareTTL   = 4 * time.Hour // 分享链接有效期
+	defaultShareSpeed = 30.0          // 无法从订单估算车速时使用的平均车速（公里/小时）
+	shareDetourFactor = 1.3           // 接驾段按直线距离估算实际路程时的绕行系数
+)
+
+// shareStatusText 可以分享的订单状态及展示给查看者的说明
+var shareStatusText = map[string]string{
+	model.OrderStatusWaitingForDriver: "正在等待司机接单",
+	model.OrderStatusWaitingForPickup: "司机正在前往上车点",
+	model.OrderStatusDriverArrived:    "司机已到达上车点",
+	model.OrderStatusInProgress:       "行程进行中",
+}
+
+// TripShareResponse 定义创建行程分享链接响应的结构体
+type TripShareResponse struct {
+	Token     string `json:"token"`
+	URL       string `json:"url"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+// TripShareView 定义行程分享页面展示的内容
+// 只包含紧急联系人了解行程进度所需的信息，不包含乘客和司机的联系方式
+type TripShareView struct {
+	Status         string         `json:"status"`
+	StatusText     string         `json:"status_text"`
+	StartName      string         `json:"start_name"`
+	EndName        string         `json:"end_name"`
+	DriverName     string         `json:"driver_name"`     // 司机称呼，只展示姓氏
+	PlateNumber    string         `json:"plate_number"`    // 车牌号码
+	VehicleColor   string         `json:"vehicle_color"`   // 车辆颜色
+	VehicleDesc    string         `json:"vehicle_desc"`    // 车辆品牌和型号
+	DriverLocation *ShareLocation `json:"driver_location"` // 司机实时位置，获取不到时为空
+	ETATarget      string         `json:"eta_target"`      // 预计到达的目标: pickup（上车点）, destination（终点）
+	ETAMinutes     *int           `json:"eta_minutes"`     // 预计到达还需的分钟数，无法估算时为空
+	ExpiresAt      string         `json:"expires_at"`      // 分享链接过期时间
+}
+
+// ShareLocation 定义行程分享中的司机位置，不包含司机的OpenID
+type ShareLocation struct {
+	Latitude   float64 `json:"latitude"`
+	Longitude  float64 `json:"longitude"`
+	UpdateTime int64   `json:"update_time"`
+}
+
+// CreateTripShare 处理乘客创建行程分享链接的请求
+// 链接带有签名和过期时间，紧急联系人无需登录即可查看行程进度
+func CreateTripShare(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 查找当前乘客的订单
+	var orderModel model.Order
+	if err := database.DB.Where("id = ? AND user_open_id = ?", c.Param("id"), payload.OpenID).First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if _, ok := shareStatusText[orderModel.Status]; !ok {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("只有进行中的订单可以分享行程"))
+		return
+	}
+
+	// 签发分享Token
+	expiresAt := time.Now().Add(shareTTL())
+	token := jwt.CreateShareToken(orderModel.ID, expiresAt)
+	url := strings.TrimRight(config.Get().Safety.ShareBaseURL, "/") + config.Get().Prefix + "/share/trips/" + token
+
+	// 返回成功响应
+	log.Info("创建行程分享链接", "order_id", orderModel.ID, "user_open_id", payload.OpenID, "expires_at", expiresAt)
+	response.Success(c, TripShareResponse{
+		Token:     token,
+		URL:       url,
+		ExpiresAt: expiresAt.Format("2006/01/02 15:04:05"),
+	})
+}
+
+// GetTripShare 处理查看行程分享内容的请求，无需登录
+func GetTripShare(c *gin.Context) {
+	view, err := loadTripShare(c.Param("token"))
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, view)
+}
+
+// ViewTripShare 处理打开行程分享页面的请求，无需登录
+// 页面由服务端渲染当前内容，之后定时请求 GetTripShare 刷新
+func ViewTripShare(c *gin.Context) {
+	token := c.Param("token")
+	view, err := loadTripShare(token)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "服务器内部错误"
+		var respErr *response.Error
+		if errors.As(err, &respErr) && respErr.Code < http.StatusInternalServerError {
+			status = int(respErr.Code)
+			message = respErr.Message
+		}
+		c.HTML(status, "trip_share.html", gin.H{
+			"error": message,
+		})
+		return
+	}
+
+	c.HTML(http.StatusOK, "trip_share.html", gin.H{
+		"view":     view,
+		"data_url": config.Get().Prefix + "/share/trips/" + token + "/data",
+	})
+}
+
+// loadTripShare 校验分享Token并生成行程分享内容
+// Token无效、过期或订单已结束时返回业务错误
+func loadTripShare(token string) (*TripShareView, error) {
+	claims, ok := jwt.ParseShareToken(token)
+	if !ok {
+		return nil, response.ErrNotFound.WithTips("分享链接无效或已过期")
+	}
+
+	var orderModel model.Order
+	if err := database.DB.Where("id = ?", claims.OrderID).First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ErrNotFound.WithTips("分享链接无效或已过期")
+		}
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 订单结束后链接立即失效
+	statusText, ok := shareStatusText[orderModel.Status]
+	if !ok {
+		return nil, response.ErrNotFound.WithTips("行程已结束，分享链接已失效")
+	}
+
+	view := &TripShareView{
+		Status:     orderModel.Status,
+		StatusText: statusText,
+		StartName:  orderModel.StartLocation.Name,
+		EndName:    orderModel.EndLocation.Name,
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0).Format("2006/01/02 15:04:05"),
+	}
+	if orderModel.DriverOpenID == "" {
+		return view, nil
+	}
+
+	// 司机和车辆信息，只展示查看者辨认车辆所需的内容
+	var driver model.Driver
+	if err := database.DB.Where("open_id = ?", orderModel.DriverOpenID).First(&driver).Error; err == nil {
+		view.DriverName = driverCallName(driver.Name)
+	} else {
+		log.Error("查询司机信息失败", "error", err, "order_id", orderModel.ID)
+	}
+	var vehicle model.Vehicle
+	if err := database.DB.Where("id = ?", orderModel.VehicleID).First(&vehicle).Error; err == nil {
+		view.PlateNumber = vehicle.PlateNumber
+		view.VehicleColor = vehicle.Color
+		view.VehicleDesc = strings.TrimSpace(vehicle.Brand + " " + vehicle.ModelName)
+	} else {
+		log.Error("查询车辆信息失败", "error", err, "order_id", orderModel.ID)
+	}
+
+	// 司机实时位置和预计到达时间
+	location, err := getDriverLocation(orderModel.DriverOpenID)
+	if err != nil {
+		return view, nil
+	}
+	view.DriverLocation = &ShareLocation{
+		Latitude:   location.Latitude,
+		Longitude:  location.Longitude,
+		UpdateTime: location.UpdateTime,
+	}
+	view.ETATarget, view.ETAMinutes = estimateArrival(&orderModel, location)
+	return view, nil
+}
+
+// estimateArrival 估算司机到达上车点或终点还需的分钟数
+// 接驾段按到上车点的直线距离乘以绕行系数估算，行程中按剩余规划路线估算，车速取订单规划的平均车速
+func estimateArrival(orderModel *model.Order, location *DriverLocation) (string, *int) {
+	var target string
+	var remaining float64
+	switch orderModel.Status {
+	case model.OrderStatusWaitingForPickup:
+		target = "pickup"
+		remaining = calculateDistance(location.Latitude, location.Longitude,
+			orderModel.StartLocation.Latitude, orderModel.StartLocation.Longitude) * shareDetourFactor
+	case model.OrderStatusDriverArrived:
+		target = "pickup"
+	case model.OrderStatusInProgress:
+		target = "destination"
+		remaining = remainingRouteDistance(orderModel, location)
+	default:
+		return "", nil
+	}
+
+	speed := defaultShareSpeed
+	if orderModel.Distance > 0 && orderModel.Duration > 0 {
+		speed = orderModel.Distance / (float64(orderModel.Duration) / 60)
+	}
+	minutes := int(math.Ceil(remaining / speed * 60))
+	return target, &minutes
+}
+
+// remainingRouteDistance 计算从离司机最近的路线点到终点的剩余路线长度（单位：公里）
+// 没有路线点时按到终点的直线距离计算
+func remainingRouteDistance(orderModel *model.Order, location *DriverLocation) float64 {
+	points := orderModel.RoutePoints
+	if len(points) == 0 {
+		return calculateDistance(location.Latitude, location.Longitude,
+			orderModel.EndLocation.Latitude, orderModel.EndLocation.Longitude)
+	}
+
+	nearest := 0
+	minDistance := math.MaxFloat64
+	for i, point := range points {
+		if distance := calculateDistance(location.Latitude, location.Longitude, point.Latitude, point.Longitude); distance < minDistance {
+			minDistance = distance
+			nearest = i
+		}
+	}
+	return minDistance + polylineDistance(points[nearest:])
+}
+
+// driverCallName 返回对司机的称呼，只保留姓氏，例如“王师傅”
+func driverCallName(name string) string {
+	runes := []rune(strings.TrimSpace(name))
+	if len(runes) == 0 {
+		return "司机"
+	}
+	return string(runes[0]) + "师傅"
+}
+
+// shareTTL 返回行程分享链接的有效期
+func shareTTL() time.Duration {
+	if ttl := config.Get().Safety.ShareTTL; ttl > 0 {
+		return time.Duration(ttl) * time.Second
+	}
+	return defaultShareTTL
+}
@@ -0,0 +1,397 @@
+package ride
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"time"
+)
+
+// 派单策略名称
+const (
+	StrategyNearest  = "nearest"  // 距离优先
+	StrategyRating   = "rating"   // 评分加权，优先派给评分高的司机
+	StrategyFairness = "fairness" // 公平性加权，优先派给空闲时间长的司机
+	StrategyBatch    = "batch"    // 批量派单，按时间窗口收集订单和司机后求全局最优分配
+)
+
+// 派单策略默认配置
+const (
+	defaultRatingWeight   = 1.0              // 司机评分每低于满分1星增加的排序距离（公里）
+	defaultFairnessWeight = 0.2              // 司机每空闲1分钟减少的排序距离（公里）
+	defaultBatchInterval  = 5 * time.Second  // 批量派单的收集窗口
+	maxFairnessIdle       = 30 * time.Minute // 计入公平性加权的最长空闲时间，避免长时间空闲的司机被派往过远的订单
+	fullRating            = 5.0              // 满分评分
+)
+
+// DispatchProblem 定义一次派单需要求解的订单与司机匹配问题
+type DispatchProblem struct {
+	Orders    []DispatchOrder
+	Drivers   []DispatchDriver
+	Distances [][]float64 // Distances[i][j] 为司机j到订单i起点的距离（公里），不能匹配时为正无穷
+	Now       time.Time
+}
+
+// DispatchOrder 定义参与派单的订单
+type DispatchOrder struct {
+	Order   *model.Order
+	Penalty float64 // 低信誉乘客的订单在排序时增加的距离（公里）
+	Boost   float64 // 已过预约时间仍未派出的订单在排序时减少的距离（公里）
+}
+
+// DispatchDriver 定义参与派单的司机
+type DispatchDriver struct {
+	OpenID      string
+	Rating      float64
+	RatingCount int
+	IdleSince   time.Time // 最近一次进入空闲状态的时间，未知时为零值
+}
+
+// DispatchAssignment 定义派单结果，表示将订单分配给司机
+type DispatchAssignment struct {
+	Order    int     // 订单在 DispatchProblem.Orders 中的下标
+	Driver   int     // 司机在 DispatchProblem.Drivers 中的下标
+	Distance float64 // 司机到订单起点的距离（公里）
+}
+
+// DispatchStrategy 定义派单策略
+// 司机请求订单和系统自动派单都通过派单策略决定订单与司机的分配，
+// 每个订单最多分配给一名司机，每名司机最多分配一个订单
+type DispatchStrategy interface {
+	// Name 返回策略名称，记录在派单邀请中用于对比不同策略的效果
+	Name() string
+	// Assign 求解派单问题，返回订单与司机的分配结果
+	Assign(problem *DispatchProblem) []DispatchAssignment
+}
+
+// costFunc 计算将订单i分配给司机j的代价，代价越小越优先
+type costFunc func(problem *DispatchProblem, i, j int) float64
+
+// dispatchStrategies 所有可用的派单策略
+var dispatchStrategies = map[string]DispatchStrategy{
+	StrategyNearest:  &greedyStrategy{name: StrategyNearest, cost: nearestCost},
+	StrategyRating:   &greedyStrategy{name: StrategyRating, cost: ratingCost},
+	StrategyFairness: &greedyStrategy{name: StrategyFairness, cost: fairnessCost},
+	StrategyBatch:    &batchStrategy{cost: nearestCost},
+}
+
+// currentStrategy 获取配置的派单策略，未配置或配置错误时使用距离优先策略
+func currentStrategy() DispatchStrategy {
+	name := config.Get().Dispatch.Strategy
+	if name == "" {
+		return dispatchStrategies[StrategyNearest]
+	}
+	strategy, ok := dispatchStrategies[name]
+	if !ok {
+		log.Warn("未知的派单策略，使用距离优先策略", "strategy", name)
+		return dispatchStrategies[StrategyNearest]
+	}
+	return strategy
+}
+
+// nearestCost 以司机到订单起点的距离作为代价，低信誉乘客的订单增加距离，逾期的预约单减少距离
+func nearestCost(problem *DispatchProblem, i, j int) float64 {
+	return problem.Distances[i][j] + problem.Orders[i].Penalty - problem.Orders[i].Boost
+}
+
+// ratingCost 在距离代价的基础上，按司机评分低于满分的差值增加代价
+// 尚未收到评价的司机不做调整
+func ratingCost(problem *DispatchProblem, i, j int) float64 {
+	cost := nearestCost(problem, i, j)
+	driver := problem.Drivers[j]
+	if driver.RatingCount == 0 {
+		return cost
+	}
+
+	weight := config.Get().Dispatch.RatingWeight
+	if weight <= 0 {
+		weight = defaultRatingWeight
+	}
+	return cost + weight*(fullRating-driver.Rating)
+}
+
+// fairnessCost 在距离代价的基础上，按司机的空闲时长减少代价
+func fairnessCost(problem *DispatchProblem, i, j int) float64 {
+	cost := nearestCost(problem, i, j)
+	driver := problem.Drivers[j]
+	if driver.IdleSince.IsZero() {
+		return cost
+	}
+
+	idle := problem.Now.Sub(driver.IdleSince)
+	if idle < 0 {
+		idle = 0
+	}
+	if idle > maxFairnessIdle {
+		idle = maxFairnessIdle
+	}
+
+	weight := config.Get().Dispatch.FairnessWeight
+	if weight <= 0 {
+		weight = defaultFairnessWeight
+	}
+	return cost - weight*idle.Minutes()
+}
+
+// greedyStrategy 贪心派单策略
+// 按代价由小到大依次分配，订单和司机都未被分配时才分配
+type greedyStrategy struct {
+	name string
+	cost costFunc
+}
+
+// Name 返回策略名称
+func (s *greedyStrategy) Name() string {
+	return s.name
+}
+
+// Assign 按代价由小到大贪心分配
+func (s *greedyStrategy) Assign(problem *DispatchProblem) []DispatchAssignment {
+	type pair struct {
+		order, driver int
+		cost          float64
+	}
+
+	var pairs []pair
+	for i := range problem.Orders {
+		for j := range problem.Drivers {
+			if math.IsInf(problem.Distances[i][j], 1) {
+				continue
+			}
+			pairs = append(pairs, pair{order: i, driver: j, cost: s.cost(problem, i, j)})
+		}
+	}
+
+	// 代价相同时先到的订单优先
+	sort.SliceStable(pairs, func(a, b int) bool {
+		if pairs[a].cost != pairs[b].cost {
+			return pairs[a].cost < pairs[b].cost
+		}
+		return pairs[a].order < pairs[b].order
+	})
+
+	assignedOrders := make(map[int]bool)
+	assignedDrivers := make(map[int]bool)
+	var assignments []DispatchAssignment
+	for _, p := range pairs {
+		if assignedOrders[p.order] || assignedDrivers[p.driver] {
+			continue
+		}
+		assignedOrders[p.order] = true
+		assignedDrivers[p.driver] = true
+		assignments = append(assignments, DispatchAssignment{Order: p.order, Driver: p.driver, Distance: problem.Distances[p.order][p.driver]})
+	}
+	return assignments
+}
+
+// batchStrategy 批量派单策略
+// 将时间窗口内的订单和司机作为一个整体，使用匈牙利算法求总代价最小的分配
+type batchStrategy struct {
+	cost costFunc
+}
+
+// infeasibleCost 不能匹配的订单和司机之间的代价，求解后丢弃这些分配
+const infeasibleCost = 1e9
+
+// Name 返回策略名称
+func (s *batchStrategy) Name() string {
+	return StrategyBatch
+}
+
+// Assign 求总代价最小的分配
+func (s *batchStrategy) Assign(problem *DispatchProblem) []DispatchAssignment {
+	rows, cols := len(problem.Orders), len(problem.Drivers)
+	if rows == 0 || cols == 0 {
+		return nil
+	}
+
+	// 匈牙利算法要求行数不多于列数，订单多于司机时转置求解
+	transposed := rows > cols
+	if transposed {
+		rows, cols = cols, rows
+	}
+	cost := make([][]float64, rows)
+	for r := range cost {
+		cost[r] = make([]float64, cols)
+		for c := range cost[r] {
+			i, j := r, c
+			if transposed {
+				i, j = c, r
+			}
+			if math.IsInf(problem.Distances[i][j], 1) {
+				cost[r][c] = infeasibleCost
+			} else {
+				cost[r][c] = s.cost(problem, i, j)
+			}
+		}
+	}
+
+	var assignments []DispatchAssignment
+	for r, c := range hungarian(cost) {
+		i, j := r, c
+		if transposed {
+			i, j = c, r
+		}
+		if math.IsInf(problem.Distances[i][j], 1) {
+			continue
+		}
+		assignments = append(assignments, DispatchAssignment{Order: i, Driver: j, Distance: problem.Distances[i][j]})
+	}
+
+	// 按订单先后返回分配结果
+	sort.Slice(assignments, func(a, b int) bool {
+		return assignments[a].Order < assignments[b].Order
+	})
+	return assignments
+}
+
+// hungarian 使用匈牙利算法求解行数不多于列数的最小代价分配问题
+// 返回每一行分配到的列
+func hungarian(cost [][]float64) []int {
+	n, m := len(cost), len(cost[0])
+	u := make([]float64, n+1)
+	v := make([]float64, m+1)
+	p := make([]int, m+1)   // p[j] 为第j列分配到的行，从1开始，0表示未分配
+	way := make([]int, m+1) // 增广路径上第j列的前驱列
+
+	for i := 1; i <= n; i++ {
+		p[0] = i
+		j0 := 0
+		minv := make([]float64, m+1)
+		used := make([]bool, m+1)
+		for j := range minv {
+			minv[j] = math.Inf(1)
+		}
+
+		for {
+			used[j0] = true
+			i0, delta, j1 := p[j0], math.Inf(1), 0
+			for j := 1; j <= m; j++ {
+				if used[j] {
+					continue
+				}
+				if cur := cost[i0-1][j-1] - u[i0] - v[j]; cur < minv[j] {
+					minv[j] = cur
+					way[j] = j0
+				}
+				if minv[j] < delta {
+					delta = minv[j]
+					j1 = j
+				}
+			}
+			for j := 0; j <= m; j++ {
+				if used[j] {
+					u[p[j]] += delta
+					v[j] -= delta
+				} else {
+					minv[j] -= delta
+				}
+			}
+			j0 = j1
+			if p[j0] == 0 {
+				break
+			}
+		}
+
+		// 沿增广路径更新分配
+		for j0 != 0 {
+			j1 := way[j0]
+			p[j0] = p[j1]
+			j0 = j1
+		}
+	}
+
+	result := make([]int, n)
+	for j := 1; j <= m; j++ {
+		if p[j] != 0 {
+			result[p[j]-1] = j - 1
+		}
+	}
+	return result
+}
+
+// newDispatchProblem 构建派单问题，补充乘客信誉、预约单逾期情况和司机的评分、空闲时间
+func newDispatchProblem(orders []*model.Order, driverOpenIDs []string, distances [][]float64) *DispatchProblem {
+	problem := &DispatchProblem{
+		Orders:    make([]DispatchOrder, len(orders)),
+		Drivers:   make([]DispatchDriver, len(driverOpenIDs)),
+		Distances: distances,
+		Now:       time.Now(),
+	}
+
+	// 低信誉乘客的订单降低优先级
+	passengerOpenIDs := make([]string, len(orders))
+	for i, orderModel := range orders {
+		passengerOpenIDs[i] = orderModel.UserOpenID
+	}
+	lowReputation, err := order.LowReputationPassengers(passengerOpenIDs)
+	if err != nil {
+		log.Error("查询乘客信誉失败，按距离派单", "error", err)
+	}
+	penalty := config.Get().Reputation.DispatchPenalty
+	boost := config.Get().Reservation.OverdueBoost
+	for i, orderModel := range orders {
+		problem.Orders[i] = DispatchOrder{Order: orderModel}
+		if lowReputation[orderModel.UserOpenID] {
+			problem.Orders[i].Penalty = penalty
+		}
+		// 逾期的预约单提高优先级
+		if isOverdueReservation(orderModel, problem.Now) {
+			problem.Orders[i].Boost = boost
+		}
+	}
+
+	for j, driverOpenID := range driverOpenIDs {
+		problem.Drivers[j] = DispatchDriver{OpenID: driverOpenID}
+	}
+	if len(driverOpenIDs) == 0 {
+		return problem
+	}
+
+	// 补充司机评分
+	var drivers []model.Driver
+	if err := database.DB.Where("open_id IN ?", driverOpenIDs).Find(&drivers).Error; err != nil {
+		log.Error("查询司机评分失败", "error", err)
+	}
+	ratings := make(map[string]model.Driver, len(drivers))
+	for _, driver := range drivers {
+		ratings[driver.OpenID] = driver
+	}
+
+	// 补充司机空闲时间
+	keys := make([]string, len(driverOpenIDs))
+	for j, driverOpenID := range driverOpenIDs {
+		keys[j] = driverOnlineKeyBase + driverOpenID
+	}
+	values, err := redis.RedisClient.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		log.Error("查询司机在线信息失败", "error", err)
+		values = nil
+	}
+
+	for j := range problem.Drivers {
+		driver := &problem.Drivers[j]
+		if rating, ok := ratings[driver.OpenID]; ok {
+			driver.Rating = rating.Rating
+			driver.RatingCount = rating.RatingCount
+		}
+		if j >= len(values) {
+			continue
+		}
+		statusJSON, ok := values[j].(string)
+		if !ok {
+			continue
+		}
+		var status DriverStatus
+		if err := json.Unmarshal([]byte(statusJSON), &status); err == nil && status.IdleSince > 0 {
+			driver.IdleSince = time.Unix(status.IdleSince, 0)
+		}
+	}
+	return problem
+}
@@ -0,0 +1,141 @@
+package ride
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// inf 表示订单和司机之间不能匹配
+var inf = math.Inf(1)
+
+// newTestProblem 根据距离矩阵创建派单问题，Distances[i][j] 为司机j到订单i起点的距离
+func newTestProblem(distances [][]float64) *DispatchProblem {
+	problem := &DispatchProblem{Distances: distances}
+	problem.Orders = make([]DispatchOrder, len(distances))
+	if len(distances) > 0 {
+		problem.Drivers = make([]DispatchDriver, len(distances[0]))
+	}
+	return problem
+}
+
+func TestBatchStrategyAssign(t *testing.T) {
+	tests := []struct {
+		name      string
+		distances [][]float64
+		penalties []float64
+		expected  []DispatchAssignment
+	}{
+		{
+			name:      "没有订单",
+			distances: [][]float64{},
+			expected:  nil,
+		},
+		{
+			name:      "没有司机",
+			distances: [][]float64{{}, {}},
+			expected:  nil,
+		},
+		{
+			// 贪心会先分配距离1的订单0和司机0，订单1只能分配距离100的司机1
+			name:      "总距离最小而不是逐个最近",
+			distances: [][]float64{{1, 2}, {2, 100}},
+			expected:  []DispatchAssignment{{Order: 0, Driver: 1, Distance: 2}, {Order: 1, Driver: 0, Distance: 2}},
+		},
+		{
+			name:      "司机多于订单",
+			distances: [][]float64{{5, 1, 3}},
+			expected:  []DispatchAssignment{{Order: 0, Driver: 1, Distance: 1}},
+		},
+		{
+			name:      "订单多于司机时转置求解",
+			distances: [][]float64{{5}, {1}, {3}},
+			expected:  []DispatchAssignment{{Order: 1, Driver: 0, Distance: 1}},
+		},
+		{
+			name:      "订单多于司机时总距离最小",
+			distances: [][]float64{{1, 2}, {2, 100}, {3, 3}},
+			expected:  []DispatchAssignment{{Order: 0, Driver: 1, Distance: 2}, {Order: 1, Driver: 0, Distance: 2}},
+		},
+		{
+			name:      "司机多于订单时丢弃不能匹配的订单",
+			distances: [][]float64{{inf, inf, inf}, {2, inf, 1}},
+			expected:  []DispatchAssignment{{Order: 1, Driver: 2, Distance: 1}},
+		},
+		{
+			name:      "订单多于司机时丢弃不能匹配的司机",
+			distances: [][]float64{{1, inf}, {2, inf}, {inf, inf}},
+			expected:  []DispatchAssignment{{Order: 0, Driver: 0, Distance: 1}},
+		},
+		{
+			// 订单0只能匹配司机0，即使司机0到订单1更近也要让给订单0
+			name:      "优先保证可以匹配的数量",
+			distances: [][]float64{{9, inf}, {1, 8}},
+			expected:  []DispatchAssignment{{Order: 0, Driver: 0, Distance: 9}, {Order: 1, Driver: 1, Distance: 8}},
+		},
+		{
+			name:      "全部不能匹配",
+			distances: [][]float64{{inf, inf}, {inf, inf}},
+			expected:  nil,
+		},
+		{
+			// 订单0的乘客信誉较低，排序距离增加5公里，司机改派给订单1
+			name:      "低信誉乘客的订单增加代价",
+			distances: [][]float64{{1}, {2}},
+			penalties: []float64{5, 0},
+			expected:  []DispatchAssignment{{Order: 1, Driver: 0, Distance: 2}},
+		},
+	}
+
+	strategy := dispatchStrategies[StrategyBatch]
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problem := newTestProblem(tt.distances)
+			for i, penalty := range tt.penalties {
+				problem.Orders[i].Penalty = penalty
+			}
+
+			assignments := strategy.Assign(problem)
+			if !reflect.DeepEqual(assignments, tt.expected) {
+				t.Errorf("分配结果 = %+v，期望 %+v", assignments, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHungarian(t *testing.T) {
+	tests := []struct {
+		name     string
+		cost     [][]float64
+		expected []int
+	}{
+		{
+			name:     "单行",
+			cost:     [][]float64{{3, 1, 2}},
+			expected: []int{1},
+		},
+		{
+			name:     "方阵",
+			cost:     [][]float64{{4, 1, 3}, {2, 0, 5}, {3, 2, 2}},
+			expected: []int{1, 0, 2},
+		},
+		{
+			name:     "行数少于列数",
+			cost:     [][]float64{{10, 1, 10, 10}, {1, 10, 10, 10}},
+			expected: []int{1, 0},
+		},
+		{
+			name:     "不能匹配的代价不被选中",
+			cost:     [][]float64{{infeasibleCost, 5}, {1, infeasibleCost}},
+			expected: []int{1, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := hungarian(tt.cost); !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("分配结果 = %v，期望 %v", result, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,206 @@
+package ride
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// trailTTL 订单轨迹在Redis中的保留时间，行程异常未结束时轨迹会在过期后丢弃
+const trailTTL = 24 * time.Hour
+
+// RouteReplayResponse 定义订单路线回放响应的结构体
+type RouteReplayResponse struct {
+	OrderID         uint                 `json:"order_id"`
+	Status          string               `json:"status"`
+	PlannedRoute    model.LocationPoints `json:"planned_route"`    // 下单时规划的路线
+	PlannedDistance float64              `json:"planned_distance"` // 规划路线长度（公里）
+	PickupRoute     model.LocationPoints `json:"pickup_route"`     // 司机接驾段的实际轨迹
+	ActualRoute     model.LocationPoints `json:"actual_route"`     // 乘客上车后的实际轨迹
+	ActualDistance  float64              `json:"actual_distance"`  // 实际轨迹长度（公里）
+	Points          model.TrailPoints    `json:"points"`           // 带时间和订单状态的完整轨迹点，用于按时间回放
+	Persisted       bool                 `json:"persisted"`        // 轨迹是否已写入数据库，行程进行中为 false
+}
+
+// trailKey 返回订单轨迹在Redis中的key
+func trailKey(orderID uint) string {
+	return fmt.Sprintf("order_trail:%d", orderID)
+}
+
+// appendTrailPoint 将司机上传的位置追加到订单轨迹
+func appendTrailPoint(orderID uint, point model.TrailPoint) error {
+	pointJSON, err := json.Marshal(point)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	pipe := redis.RedisClient.TxPipeline()
+	pipe.RPush(ctx, trailKey(orderID), pointJSON)
+	pipe.Expire(ctx, trailKey(orderID), trailTTL)
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// loadCachedTrail 从Redis读取行程进行中的订单轨迹
+func loadCachedTrail(orderID uint) (model.TrailPoints, error) {
+	values, err := redis.RedisClient.LRange(context.Background(), trailKey(orderID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	points := make(model.TrailPoints, 0, len(values))
+	for _, value := range values {
+		var point model.TrailPoint
+		if err := json.Unmarshal([]byte(value), &point); err != nil {
+			log.Error("解析订单轨迹点失败", "error", err, "order_id", orderID)
+			continue
+		}
+		points = append(points, point)
+	}
+	return points, nil
+}
+
+// flushTrail 行程结束或取消后将Redis中的订单轨迹写入数据库并删除缓存
+// 同一订单重复写入时保留第一次写入的轨迹
+func flushTrail(orderModel *model.Order) error {
+	points, err := loadCachedTrail(orderModel.ID)
+	if err != nil {
+		return err
+	}
+
+	trail := model.OrderTrail{
+		OrderID:      orderModel.ID,
+		DriverOpenID: orderModel.DriverOpenID,
+		Points:       points,
+		PointCount:   len(points),
+	}
+	if err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "order_id"}},
+		DoNothing: true,
+	}).Create(&trail).Error; err != nil {
+		return err
+	}
+
+	return redis.RedisClient.Del(context.Background(), trailKey(orderModel.ID)).Err()
+}
+
+// persistTrail 行程结束或订单取消后将订单轨迹写入数据库，并删除订单的定位处理状态
+// 注册为订单状态变更处理函数，接驾途中取消的订单同样保存已上传的轨迹；
+// 保存失败时轨迹仍保留在Redis中，可通过路线回放查看
+func persistTrail(orderModel *model.Order, from, to string) {
+	if to != model.OrderStatusWaitingForPayment && to != model.OrderStatusCancelled {
+		return
+	}
+	// 没有司机承接的订单没有轨迹
+	if orderModel.DriverOpenID == "" {
+		return
+	}
+
+	if err := flushTrail(orderModel); err != nil {
+		log.Error("保存订单轨迹失败", "error", err, "order_id", orderModel.ID, "status", to)
+	}
+	if err := clearOdometer(orderModel.ID); err != nil {
+		log.Error("删除订单里程状态失败", "error", err, "order_id", orderModel.ID)
+	}
+}
+
+// GetOrderRoute 处理查询订单路线回放的请求
+// 返回规划路线和司机实际行驶轨迹，乘客、承接订单的司机和管理员可以查看
+func GetOrderRoute(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 查找订单，非管理员只能查看自己下单或承接的订单
+	query := database.DB.Where("id = ?", c.Param("id"))
+	if payload.RoleID != 3 {
+		query = query.Where("(user_open_id = ? OR driver_open_id = ?)", payload.OpenID, payload.OpenID)
+	}
+	var orderModel model.Order
+	if err := query.First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 优先读取已写入数据库的轨迹，行程进行中时读取Redis中的轨迹
+	persisted := true
+	var trail model.OrderTrail
+	if err := database.DB.Where("order_id = ?", orderModel.ID).First(&trail).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+			return
+		}
+		persisted = false
+		points, err := loadCachedTrail(orderModel.ID)
+		if err != nil {
+			response.Fail(c, response.ErrServerInternal.WithOrigin(err))
+			return
+		}
+		trail.Points = points
+	}
+
+	// 按上传时的订单状态拆分接驾段和送驾段
+	pickupRoute := model.LocationPoints{}
+	actualRoute := model.LocationPoints{}
+	for _, point := range trail.Points {
+		locationPoint := model.LocationPoint{Latitude: point.Latitude, Longitude: point.Longitude}
+		if point.Status == model.OrderStatusInProgress {
+			actualRoute = append(actualRoute, locationPoint)
+		} else {
+			pickupRoute = append(pickupRoute, locationPoint)
+		}
+	}
+	if trail.Points == nil {
+		trail.Points = model.TrailPoints{}
+	}
+
+	// 返回成功响应
+	response.Success(c, RouteReplayResponse{
+		OrderID:         orderModel.ID,
+		Status:          orderModel.Status,
+		PlannedRoute:    orderModel.RoutePoints,
+		PlannedDistance: polylineDistance(orderModel.RoutePoints),
+		PickupRoute:     pickupRoute,
+		ActualRoute:     actualRoute,
+		ActualDistance:  polylineDistance(actualRoute),
+		Points:          trail.Points,
+		Persisted:       persisted,
+	})
+}
+
+// polylineDistance 计算折线的总长度（单位：公里），保留两位小数
+func polylineDistance(points model.LocationPoints) float64 {
+	total := 0.0
+	for i := 1; i < len(points); i++ {
+		total += calculateDistance(
+			points[i-1].Latitude, points[i-1].Longitude,
+			points[i].Latitude, points[i].Longitude)
+	}
+	return math.Round(total*100) / 100
+}
@@ -0,0 +1,247 @@
+package ride
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/fare"
+	"cab-hive/internal/module/order"
+	"math"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// TripRequest 定义司机接到乘客/结束行程请求的结构体
+type TripRequest struct {
+	OrderID uint `json:"order_id" binding:"required"`
+}
+
+// TripResponse 定义行程状态变更后的响应结构体
+type TripResponse struct {
+	OrderID    uint                `json:"order_id"`
+	Status     string              `json:"status"`
+	StartTime  *string             `json:"start_time"`
+	EndTime    *string             `json:"end_time"`
+	Distance   float64             `json:"distance"`
+	Fare       float64             `json:"fare"`
+	FareDetail model.FareBreakdown `json:"fare_detail"`
+}
+
+// PickupPassenger 处理司机接到乘客、开始行程的请求
+// 订单状态从 driver_arrived 变更为 in_progress
+func PickupPassenger(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req TripRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 查找属于该司机的订单
+	orderModel, err := getDriverOrder(req.OrderID, payload.OpenID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 只有司机已到达起点的订单才能开始行程
+	if orderModel.Status != model.OrderStatusDriverArrived {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单状态不是司机已到达，无法开始行程"))
+		return
+	}
+
+	// 更新订单状态和出发时间
+	if err := order.Transition(orderModel, model.OrderStatusInProgress, driverActor(payload.OpenID, "司机接到乘客"), map[string]interface{}{
+		"start_time": time.Now(),
+	}); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("司机接到乘客，行程开始", "order_id", orderModel.ID, "driver_open_id", payload.OpenID)
+	response.Success(c, newTripResponse(orderModel))
+}
+
+// CompleteTrip 处理司机到达终点、结束行程的请求
+// 订单状态从 in_progress 变更为 waiting_for_payment
+func CompleteTrip(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 检查用户角色是否为司机
+	if payload.RoleID != 2 {
+		response.Fail(c, response.ErrUnauthorized)
+		return
+	}
+
+	// 解析请求参数
+	var req TripRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 查找属于该司机的订单
+	orderModel, err := getDriverOrder(req.OrderID, payload.OpenID)
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 只有行程中的订单才能结束行程
+	if orderModel.Status != model.OrderStatusInProgress {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("订单状态不是行程中，无法结束行程"))
+		return
+	}
+
+	// 实际行驶距离以行程中按定位累加的里程为准，没有足够定位时按规划路线估算
+	distance, ok, err := odometerDistance(orderModel.ID)
+	if err != nil {
+		log.Error("读取订单里程失败", "error", err, "order_id", orderModel.ID)
+	}
+	if !ok {
+		dropOff, err := getDriverLocation(payload.OpenID)
+		if err != nil {
+			log.Warn("获取司机位置失败，按完整路线计算实际距离", "error", err, "order_id", orderModel.ID)
+			dropOff = nil
+		}
+		distance = calculateActualDistance(orderModel, dropOff)
+		log.Warn("行程定位不足，按规划路线估算实际距离", "order_id", orderModel.ID, "distance", distance)
+	}
+
+	// 按实际距离、时长和等待时间计算最终费用
+	endTime := time.Now()
+	orderModel.Distance = distance
+	breakdown, err := fare.Final(orderModel, endTime)
+	if err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 更新订单状态、结束时间、实际距离和最终费用
+	if err := order.Transition(orderModel, model.OrderStatusWaitingForPayment, driverActor(payload.OpenID, "行程结束"), map[string]interface{}{
+		"end_time":    endTime,
+		"distance":    distance,
+		"fare":        breakdown.Total,
+		"fare_detail": breakdown,
+	}); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("行程结束，等待乘客付款", "order_id", orderModel.ID, "driver_open_id", payload.OpenID, "distance", distance, "fare", orderModel.Fare)
+	response.Success(c, newTripResponse(orderModel))
+}
+
+// getDriverOrder 查找指定司机名下的订单
+// 订单不存在或不属于该司机时返回对应的业务错误
+func getDriverOrder(orderID uint, driverOpenID string) (*model.Order, error) {
+	var orderModel model.Order
+	if err := database.DB.Where("id = ?", orderID).First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ErrNotFound.WithTips("订单不存在")
+		}
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+
+	// 验证订单是否由当前司机承接
+	if orderModel.DriverOpenID != driverOpenID {
+		log.Error("订单不属于当前司机", "order_id", orderID, "driver_open_id", driverOpenID)
+		return nil, response.ErrForbidden.WithTips("订单不属于当前司机")
+	}
+
+	return &orderModel, nil
+}
+
+// calculateActualDistance 按规划路线估算订单的实际行驶距离（单位：公里），行程中定位不足时使用
+// 沿规划路线累加到离下车点最近的路线点，没有路线点时沿用订单原有距离
+func calculateActualDistance(orderModel *model.Order, dropOff *DriverLocation) float64 {
+	points := orderModel.RoutePoints
+	if len(points) < 2 {
+		return orderModel.Distance
+	}
+
+	// 找到离下车点最近的路线点，没有下车点时使用完整路线
+	endIndex := len(points) - 1
+	if dropOff != nil {
+		minDistance := math.MaxFloat64
+		for i, point := range points {
+			distance := calculateDistance(dropOff.Latitude, dropOff.Longitude, point.Latitude, point.Longitude)
+			if distance < minDistance {
+				minDistance = distance
+				endIndex = i
+			}
+		}
+	}
+
+	// 累加路线各段距离
+	total := 0.0
+	for i := 1; i <= endIndex; i++ {
+		total += calculateDistance(
+			points[i-1].Latitude, points[i-1].Longitude,
+			points[i].Latitude, points[i].Longitude)
+	}
+
+	// 保留两位小数，与数据库字段精度一致
+	return math.Round(total*100) / 100
+}
+
+// newTripResponse 将订单转换为行程响应格式
+func newTripResponse(orderModel *model.Order) TripResponse {
+	return TripResponse{
+		OrderID: orderModel.ID,
+		Status:  orderModel.Status,
+		StartTime: func() *string {
+			if orderModel.StartTime != nil {
+				formatted := orderModel.StartTime.Format("2006/01/02 15:04:05")
+				return &formatted
+			}
+			return nil
+		}(),
+		EndTime: func() *string {
+			if orderModel.EndTime != nil {
+				formatted := orderModel.EndTime.Format("2006/01/02 15:04:05")
+				return &formatted
+			}
+			return nil
+		}(),
+		Distance:   orderModel.Distance,
+		Fare:       orderModel.Fare,
+		FareDetail: orderModel.FareDetail,
+	}
+}
@@ -0,0 +1,288 @@
+package safety
+
+import (
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"cab-hive/internal/module/realtime"
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// AlertResponse 定义安全告警响应的结构体
+type AlertResponse struct {
+	ID             uint    `json:"id"`
+	OrderID        uint    `json:"order_id"`
+	UserOpenID     string  `json:"user_open_id"`
+	DriverOpenID   string  `json:"driver_open_id"`
+	Type           string  `json:"type"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Distance       float64 `json:"distance"`
+	Message        string  `json:"message"`
+	Status         string  `json:"status"`
+	AcknowledgedBy string  `json:"acknowledged_by"`
+	AcknowledgedAt *string `json:"acknowledged_at"`
+	ResolvedBy     string  `json:"resolved_by"`
+	ResolvedAt     *string `json:"resolved_at"`
+	Resolution     string  `json:"resolution"`
+	CreateTime     string  `json:"create_time"`
+}
+
+// AlertListResponse 定义安全告警列表响应的结构体
+type AlertListResponse struct {
+	Alerts     []AlertResponse  `json:"alerts"`
+	Pagination order.Pagination `json:"pagination"`
+}
+
+// ResolveAlertRequest 定义处理安全告警请求的结构体
+type ResolveAlertRequest struct {
+	Resolution string `json:"resolution" binding:"required"`
+}
+
+// RaiseAlert 创建安全告警并推送给管理员和订单乘客
+// 同一订单同一类型已有未处理完成的告警时不重复创建，返回是否创建了新告警
+func RaiseAlert(alert *model.SafetyAlert) (bool, error) {
+	var count int64
+	if err := database.DB.Model(&model.SafetyAlert{}).
+		Where("order_id = ? AND type = ? AND status <> ?", alert.OrderID, alert.Type, model.SafetyAlertStatusResolved).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	alert.Status = model.SafetyAlertStatusOpen
+	if err := database.DB.Create(alert).Error; err != nil {
+		return false, err
+	}
+	log.Warn("产生行程安全告警", "alert_id", alert.ID, "order_id", alert.OrderID, "type", alert.Type, "message", alert.Message)
+
+	publishAlert(alert)
+	return true, nil
+}
+
+// GetAlerts 处理管理员查询安全告警列表的请求
+func GetAlerts(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.SafetyAlert{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if alertType := c.Query("type"); alertType != "" {
+		query = query.Where("type = ?", alertType)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 查询告警
+	var alerts []model.SafetyAlert
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("id DESC").Find(&alerts).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	alertList := make([]AlertResponse, len(alerts))
+	for i := range alerts {
+		alertList[i] = newAlertResponse(&alerts[i])
+	}
+
+	// 返回成功响应
+	response.Success(c, AlertListResponse{
+		Alerts: alertList,
+		Pagination: order.Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	})
+}
+
+// AcknowledgeAlert 处理管理员确认安全告警的请求
+// 只有待确认的告警可以确认
+func AcknowledgeAlert(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	alert, err := findAlert(c.Param("id"))
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	now := time.Now()
+	if err := updateAlert(alert, model.SafetyAlertStatusOpen, map[string]interface{}{
+		"status":          model.SafetyAlertStatusAcknowledged,
+		"acknowledged_by": payload.OpenID,
+		"acknowledged_at": now,
+	}); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("管理员确认安全告警", "alert_id", alert.ID, "admin_open_id", payload.OpenID)
+	response.Success(c, newAlertResponse(alert))
+}
+
+// ResolveAlert 处理管理员处理完成安全告警的请求
+// 未确认的告警处理完成时同时记录为已确认
+func ResolveAlert(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 解析请求参数
+	var req ResolveAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	alert, err := findAlert(c.Param("id"))
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":      model.SafetyAlertStatusResolved,
+		"resolved_by": payload.OpenID,
+		"resolved_at": now,
+		"resolution":  req.Resolution,
+	}
+	if alert.Status == model.SafetyAlertStatusOpen {
+		updates["acknowledged_by"] = payload.OpenID
+		updates["acknowledged_at"] = now
+	}
+	if err := updateAlert(alert, alert.Status, updates); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("管理员处理完成安全告警", "alert_id", alert.ID, "admin_open_id", payload.OpenID)
+	response.Success(c, newAlertResponse(alert))
+}
+
+// findAlert 查找安全告警
+func findAlert(alertID string) (*model.SafetyAlert, error) {
+	var alert model.SafetyAlert
+	if err := database.DB.Where("id = ?", alertID).First(&alert).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ErrNotFound.WithTips("告警不存在")
+		}
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+	return &alert, nil
+}
+
+// updateAlert 以告警当前状态为条件更新告警，并推送最新状态
+// 已处理完成的告警不能再次变更，告警状态已被其他管理员修改时返回冲突错误
+func updateAlert(alert *model.SafetyAlert, from string, updates map[string]interface{}) error {
+	if from == model.SafetyAlertStatusResolved {
+		return response.ErrInvalidRequest.WithTips("告警已处理完成")
+	}
+	if from != alert.Status {
+		return response.ErrInvalidRequest.WithTips("告警已被确认")
+	}
+
+	result := database.DB.Model(&model.SafetyAlert{}).Where("id = ? AND status = ?", alert.ID, from).Updates(updates)
+	if result.Error != nil {
+		return response.ErrDatabase.WithOrigin(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return response.ErrAlreadyExists.WithTips("告警状态已被其他管理员修改")
+	}
+	if err := database.DB.First(alert, alert.ID).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+
+	publishAlert(alert)
+	return nil
+}
+
+// publishAlert 推送安全告警的最新状态，推送失败只记录日志
+func publishAlert(alert *model.SafetyAlert) {
+	if err := realtime.PublishAlert(alert.OrderID, realtime.AlertData{
+		AlertID:      alert.ID,
+		Type:         alert.Type,
+		Status:       alert.Status,
+		DriverOpenID: alert.DriverOpenID,
+		Latitude:     alert.Latitude,
+		Longitude:    alert.Longitude,
+		Message:      alert.Message,
+	}); err != nil {
+		log.Error("推送安全告警失败", "error", err, "alert_id", alert.ID)
+	}
+}
+
+// newAlertResponse 将安全告警转换为响应格式
+func newAlertResponse(alert *model.SafetyAlert) AlertResponse {
+	return AlertResponse{
+		ID:             alert.ID,
+		OrderID:        alert.OrderID,
+		UserOpenID:     alert.UserOpenID,
+		DriverOpenID:   alert.DriverOpenID,
+		Type:           alert.Type,
+		Latitude:       alert.Latitude,
+		Longitude:      alert.Longitude,
+		Distance:       alert.Distance,
+		Message:        alert.Message,
+		Status:         alert.Status,
+		AcknowledgedBy: alert.AcknowledgedBy,
+		AcknowledgedAt: formatTime(alert.AcknowledgedAt),
+		ResolvedBy:     alert.ResolvedBy,
+		ResolvedAt:     formatTime(alert.ResolvedAt),
+		Resolution:     alert.Resolution,
+		CreateTime:     alert.CreatedAt.Format("2006/01/02 15:04:05"),
+	}
+}
+
+// formatTime 格式化可为空的时间
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	formatted := t.Format("2006/01/02 15:04:05")
+	return &formatted
+}
@@ -0,0 +1,634 @@
+package safety
+
+import (
+	"cab-hive/config"
+	"cab-hive/internal/global/database"
+	"cab-hive/internal/global/jwt"
+	"cab-hive/internal/global/redis"
+	"cab-hive/internal/global/response"
+	"cab-hive/internal/model"
+	"cab-hive/internal/module/order"
+	"cab-hive/internal/module/realtime"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	go_redis "github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 紧急求助相关的Redis key
+const (
+	incidentOpenKey       = "incident:open"        // 未处理完成的紧急求助，有序集合，成员为紧急求助ID，分数为标记过期的时间戳
+	incidentRemindLockKey = "incident:remind:lock" // 重复推送未确认紧急求助的调度锁
+)
+
+// defaultIncidentRemind 紧急求助未被确认时重复推送给管理员的默认间隔
+const defaultIncidentRemind = 30 * time.Second
+
+// incidentActiveTTL 紧急求助标记的最长保留时间，事件处理完成后立即删除
+const incidentActiveTTL = 24 * time.Hour
+
+// sosStatuses 可以发起紧急求助的订单状态，即司机已承接且行程尚未结束
+var sosStatuses = []string{
+	model.OrderStatusWaitingForPickup,
+	model.OrderStatusDriverArrived,
+	model.OrderStatusInProgress,
+}
+
+// SOSRequest 定义发起紧急求助请求的结构体
+type SOSRequest struct {
+	OrderID   uint    `json:"order_id" binding:"required"`
+	Message   string  `json:"message"`
+	Latitude  float64 `json:"latitude"`  // 发起人当前纬度，可选
+	Longitude float64 `json:"longitude"` // 发起人当前经度，可选
+}
+
+// ResolveIncidentRequest 定义处理紧急求助请求的结构体
+type ResolveIncidentRequest struct {
+	Resolution string `json:"resolution" binding:"required"`
+}
+
+// IncidentEventResponse 定义紧急求助处理记录响应的结构体
+type IncidentEventResponse struct {
+	ID          uint   `json:"id"`
+	ActorOpenID string `json:"actor_open_id"`
+	ActorRole   string `json:"actor_role"`
+	FromStatus  string `json:"from_status"`
+	ToStatus    string `json:"to_status"`
+	Note        string `json:"note"`
+	CreateTime  string `json:"create_time"`
+}
+
+// IncidentResponse 定义紧急求助响应的结构体
+type IncidentResponse struct {
+	ID             uint                    `json:"id"`
+	OrderID        uint                    `json:"order_id"`
+	ReporterOpenID string                  `json:"reporter_open_id"`
+	ReporterRole   string                  `json:"reporter_role"`
+	UserOpenID     string                  `json:"user_open_id"`
+	DriverOpenID   string                  `json:"driver_open_id"`
+	Priority       string                  `json:"priority"`
+	Status         string                  `json:"status"`
+	Message        string                  `json:"message"`
+	Snapshot       model.IncidentSnapshot  `json:"snapshot"`
+	AcknowledgedBy string                  `json:"acknowledged_by"`
+	AcknowledgedAt *string                 `json:"acknowledged_at"`
+	ResolvedBy     string                  `json:"resolved_by"`
+	ResolvedAt     *string                 `json:"resolved_at"`
+	Resolution     string                  `json:"resolution"`
+	CreateTime     string                  `json:"create_time"`
+	Events         []IncidentEventResponse `json:"events,omitempty"`
+}
+
+// IncidentListResponse 定义紧急求助列表响应的结构体
+type IncidentListResponse struct {
+	Incidents  []IncidentResponse `json:"incidents"`
+	Pagination order.Pagination   `json:"pagination"`
+}
+
+// HasOpenIncident 判断系统中是否有未处理完成的紧急求助
+// 不区分订单和发起人，所有进行中订单同时提高位置上传频率，避免司机从上传频率的变化得知乘客求助
+func HasOpenIncident() bool {
+	count, err := redis.RedisClient.ZCount(context.Background(), incidentOpenKey,
+		strconv.FormatInt(time.Now().Unix(), 10), "+inf").Result()
+	if err != nil {
+		log.Error("查询紧急求助标记失败", "error", err)
+		return false
+	}
+	return count > 0
+}
+
+// TriggerSOS 处理乘客或司机发起紧急求助的请求
+// 冻结现场快照并创建高优先级的紧急求助事件，同一订单已有未处理完成的紧急求助时直接返回该事件
+func TriggerSOS(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 解析请求参数
+	var req SOSRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	// 查找当前用户下单或承接的订单
+	var orderModel model.Order
+	if err := database.DB.Where("id = ? AND (user_open_id = ? OR driver_open_id = ?)", req.OrderID, payload.OpenID, payload.OpenID).
+		First(&orderModel).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("订单不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+	if !isSOSStatus(orderModel.Status) {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("只有进行中的订单可以发起紧急求助"))
+		return
+	}
+
+	// 同一发起人在同一订单已有未处理完成的紧急求助时不重复创建，避免连续点击产生多个事件
+	// 不返回订单另一方发起的紧急求助，避免司机得知乘客求助
+	var existing model.Incident
+	err := database.DB.Where("order_id = ? AND reporter_open_id = ? AND status <> ?", orderModel.ID, payload.OpenID, model.IncidentStatusResolved).
+		Order("id DESC").First(&existing).Error
+	if err == nil {
+		response.Success(c, newIncidentResponse(&existing, nil))
+		return
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	reporterRole := model.ActorRoleDriver
+	if orderModel.UserOpenID == payload.OpenID {
+		reporterRole = model.ActorRolePassenger
+	}
+
+	incident := model.Incident{
+		OrderID:        orderModel.ID,
+		ReporterOpenID: payload.OpenID,
+		ReporterRole:   reporterRole,
+		UserOpenID:     orderModel.UserOpenID,
+		DriverOpenID:   orderModel.DriverOpenID,
+		Priority:       model.IncidentPriorityHigh,
+		Status:         model.IncidentStatusOpen,
+		Message:        strings.TrimSpace(req.Message),
+		Snapshot:       captureSnapshot(&orderModel, req),
+	}
+
+	// 事件和发起记录在同一事务中写入
+	if err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&incident).Error; err != nil {
+			return err
+		}
+		return appendIncidentEvent(tx, incident.ID, payload.OpenID, reporterRole, "", model.IncidentStatusOpen, incident.Message)
+	}); err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 标记有未处理完成的紧急求助，司机端据此提高位置上传频率
+	if err := redis.RedisClient.ZAdd(context.Background(), incidentOpenKey, go_redis.Z{
+		Score:  float64(time.Now().Add(incidentActiveTTL).Unix()),
+		Member: incident.ID,
+	}).Err(); err != nil {
+		log.Error("标记紧急求助失败", "error", err, "incident_id", incident.ID)
+	}
+	publishIncident(&incident)
+
+	// 返回成功响应
+	log.Warn("发起紧急求助", "incident_id", incident.ID, "order_id", orderModel.ID, "reporter_open_id", payload.OpenID, "reporter_role", reporterRole)
+	response.Success(c, newIncidentResponse(&incident, nil))
+}
+
+// GetIncident 处理查询紧急求助详情的请求
+// 管理员可以查看所有事件，乘客和司机只能查看自己发起的事件
+func GetIncident(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	query := database.DB.Where("id = ?", c.Param("id"))
+	if payload.RoleID != 3 {
+		query = query.Where("reporter_open_id = ?", payload.OpenID)
+	}
+	var incident model.Incident
+	if err := query.First(&incident).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			response.Fail(c, response.ErrNotFound.WithTips("紧急求助不存在"))
+		} else {
+			response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		}
+		return
+	}
+
+	// 按时间顺序查询处理记录
+	var events []model.IncidentEvent
+	if err := database.DB.Where("incident_id = ?", incident.ID).Order("id ASC").Find(&events).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	// 返回成功响应
+	response.Success(c, newIncidentResponse(&incident, events))
+}
+
+// GetIncidents 处理管理员查询紧急求助列表的请求
+func GetIncidents(c *gin.Context) {
+	// 构建查询条件
+	query := database.DB.Model(&model.Incident{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if orderID := c.Query("order_id"); orderID != "" {
+		query = query.Where("order_id = ?", orderID)
+	}
+
+	// 解析分页参数
+	pageNum := 1
+	size := 10
+	fmt.Sscanf(c.DefaultQuery("page", "1"), "%d", &pageNum)
+	fmt.Sscanf(c.DefaultQuery("page_size", "10"), "%d", &size)
+
+	// 计算总数
+	var total int64
+	query.Count(&total)
+
+	// 查询紧急求助
+	var incidents []model.Incident
+	if err := query.Offset((pageNum - 1) * size).Limit(size).Order("id DESC").Find(&incidents).Error; err != nil {
+		response.Fail(c, response.ErrDatabase.WithOrigin(err))
+		return
+	}
+
+	incidentList := make([]IncidentResponse, len(incidents))
+	for i := range incidents {
+		incidentList[i] = newIncidentResponse(&incidents[i], nil)
+	}
+
+	// 返回成功响应
+	response.Success(c, IncidentListResponse{
+		Incidents: incidentList,
+		Pagination: order.Pagination{
+			CurrentPage: pageNum,
+			PageSize:    size,
+			TotalCount:  total,
+			TotalPages:  int((total + int64(size) - 1) / int64(size)),
+		},
+	})
+}
+
+// AcknowledgeIncident 处理管理员确认紧急求助的请求
+// 只有待确认的事件可以确认
+func AcknowledgeIncident(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	incident, err := findIncident(c.Param("id"))
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+	if incident.Status != model.IncidentStatusOpen {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("紧急求助已被确认"))
+		return
+	}
+
+	if err := transitionIncident(incident, model.IncidentStatusAcknowledged, payload.OpenID, "管理员确认", map[string]interface{}{
+		"acknowledged_by": payload.OpenID,
+		"acknowledged_at": time.Now(),
+	}); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	// 返回成功响应
+	log.Info("管理员确认紧急求助", "incident_id", incident.ID, "admin_open_id", payload.OpenID)
+	response.Success(c, newIncidentResponse(incident, nil))
+}
+
+// ResolveIncident 处理管理员处理完成紧急求助的请求
+// 未确认的事件处理完成时同时记录为已确认，处理完成后恢复正常的位置上传频率
+func ResolveIncident(c *gin.Context) {
+	// 从上下文中获取载荷
+	payloadInterface, exists := c.Get("payload")
+	if !exists {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	payload, ok := payloadInterface.(*jwt.Claims)
+	if !ok {
+		response.Fail(c, response.ErrTokenInvalid)
+		return
+	}
+
+	// 解析请求参数
+	var req ResolveIncidentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, response.ErrInvalidRequest.WithOrigin(err))
+		return
+	}
+
+	incident, err := findIncident(c.Param("id"))
+	if err != nil {
+		response.Fail(c, err)
+		return
+	}
+	if incident.Status == model.IncidentStatusResolved {
+		response.Fail(c, response.ErrInvalidRequest.WithTips("紧急求助已处理完成"))
+		return
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"resolved_by": payload.OpenID,
+		"resolved_at": now,
+		"resolution":  req.Resolution,
+	}
+	if incident.Status == model.IncidentStatusOpen {
+		updates["acknowledged_by"] = payload.OpenID
+		updates["acknowledged_at"] = now
+	}
+	if err := transitionIncident(incident, model.IncidentStatusResolved, payload.OpenID, req.Resolution, updates); err != nil {
+		response.Fail(c, err)
+		return
+	}
+
+	if err := redis.RedisClient.ZRem(context.Background(), incidentOpenKey, incident.ID).Err(); err != nil {
+		log.Error("删除紧急求助标记失败", "error", err, "incident_id", incident.ID)
+	}
+
+	// 返回成功响应
+	log.Info("管理员处理完成紧急求助", "incident_id", incident.ID, "admin_open_id", payload.OpenID)
+	response.Success(c, newIncidentResponse(incident, nil))
+}
+
+// remindIncidents 定时重复推送未确认的紧急求助，直到管理员确认
+// 多实例部署时通过Redis锁保证同一时间只有一个实例推送
+func remindIncidents() {
+	interval := incidentRemindInterval()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// 获取调度锁，锁在一个推送间隔后自动释放
+		locked, err := redis.RedisClient.SetNX(context.Background(), incidentRemindLockKey, time.Now().Unix(), interval).Result()
+		if err != nil {
+			log.Error("获取紧急求助提醒锁失败", "error", err)
+			continue
+		}
+		if !locked {
+			continue
+		}
+
+		// 清理已过期的紧急求助标记
+		if err := redis.RedisClient.ZRemRangeByScore(context.Background(), incidentOpenKey,
+			"-inf", strconv.FormatInt(time.Now().Unix(), 10)).Err(); err != nil {
+			log.Error("清理紧急求助标记失败", "error", err)
+		}
+
+		var incidents []model.Incident
+		if err := database.DB.Where("status = ? AND created_at <= ?", model.IncidentStatusOpen, time.Now().Add(-interval)).
+			Find(&incidents).Error; err != nil {
+			log.Error("查询未确认的紧急求助失败", "error", err)
+			continue
+		}
+		for i := range incidents {
+			// 重复推送只发给管理员
+			elapsed := time.Since(incidents[i].CreatedAt).Round(time.Second)
+			alert := newIncidentAlert(&incidents[i], fmt.Sprintf("已%s未确认", elapsed))
+			if err := realtime.PublishAdminAlert(incidents[i].OrderID, alert); err != nil {
+				log.Error("推送紧急求助失败", "error", err, "incident_id", incidents[i].ID)
+			}
+		}
+		if len(incidents) > 0 {
+			log.Warn("紧急求助未被确认", "count", len(incidents))
+		}
+	}
+}
+
+// incidentRemindInterval 返回紧急求助未被确认时重复推送的间隔
+func incidentRemindInterval() time.Duration {
+	if remind := config.Get().Safety.IncidentRemind; remind > 0 {
+		return time.Duration(remind) * time.Second
+	}
+	return defaultIncidentRemind
+}
+
+// captureSnapshot 冻结发起紧急求助时的订单、双方信息、车辆和最后位置
+// 单项信息获取失败时留空，不影响发起紧急求助
+func captureSnapshot(orderModel *model.Order, req SOSRequest) model.IncidentSnapshot {
+	snapshot := model.IncidentSnapshot{
+		OrderStatus:   orderModel.Status,
+		StartLocation: orderModel.StartLocation,
+		EndLocation:   orderModel.EndLocation,
+		StartTime:     orderModel.StartTime,
+		CapturedAt:    time.Now(),
+	}
+
+	var user model.User
+	if err := database.DB.Where("open_id = ?", orderModel.UserOpenID).First(&user).Error; err == nil {
+		snapshot.PassengerName = user.NickName
+	} else {
+		log.Error("查询乘客信息失败", "error", err, "order_id", orderModel.ID)
+	}
+
+	var driver model.Driver
+	if err := database.DB.Where("open_id = ?", orderModel.DriverOpenID).First(&driver).Error; err == nil {
+		snapshot.DriverName = driver.Name
+		snapshot.DriverPhone = driver.Phone
+	} else {
+		log.Error("查询司机信息失败", "error", err, "order_id", orderModel.ID)
+	}
+
+	var vehicle model.Vehicle
+	if err := database.DB.Where("id = ?", orderModel.VehicleID).First(&vehicle).Error; err == nil {
+		snapshot.PlateNumber = vehicle.PlateNumber
+		snapshot.VehicleDesc = strings.TrimSpace(fmt.Sprintf("%s %s %s", vehicle.Brand, vehicle.ModelName, vehicle.Color))
+	} else {
+		log.Error("查询车辆信息失败", "error", err, "order_id", orderModel.ID)
+	}
+
+	if req.Latitude != 0 || req.Longitude != 0 {
+		snapshot.ReporterLocation = &model.IncidentLocation{
+			Latitude:  req.Latitude,
+			Longitude: req.Longitude,
+			Time:      snapshot.CapturedAt.Unix(),
+		}
+	}
+
+	// 司机最后上传的位置，key与乘车模块保存司机位置时一致
+	if locationJSON, err := redis.RedisClient.Get(context.Background(), "driver:location:"+orderModel.DriverOpenID).Result(); err == nil {
+		var location struct {
+			Latitude   float64 `json:"latitude"`
+			Longitude  float64 `json:"longitude"`
+			UpdateTime int64   `json:"update_time"`
+		}
+		if err := json.Unmarshal([]byte(locationJSON), &location); err == nil {
+			snapshot.DriverLocation = &model.IncidentLocation{
+				Latitude:  location.Latitude,
+				Longitude: location.Longitude,
+				Time:      location.UpdateTime,
+			}
+		}
+	}
+
+	return snapshot
+}
+
+// findIncident 查找紧急求助
+func findIncident(incidentID string) (*model.Incident, error) {
+	var incident model.Incident
+	if err := database.DB.Where("id = ?", incidentID).First(&incident).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, response.ErrNotFound.WithTips("紧急求助不存在")
+		}
+		return nil, response.ErrDatabase.WithOrigin(err)
+	}
+	return &incident, nil
+}
+
+// transitionIncident 由管理员变更紧急求助状态，并在同一事务中追加处理记录
+// 以事件当前状态为更新条件，状态已被其他管理员修改时返回冲突错误
+func transitionIncident(incident *model.Incident, to, adminOpenID, note string, fields map[string]interface{}) error {
+	from := incident.Status
+	updates := make(map[string]interface{}, len(fields)+1)
+	for key, value := range fields {
+		updates[key] = value
+	}
+	updates["status"] = to
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Incident{}).Where("id = ? AND status = ?", incident.ID, from).Updates(updates)
+		if result.Error != nil {
+			return response.ErrDatabase.WithOrigin(result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return response.ErrAlreadyExists.WithTips("紧急求助状态已被其他管理员修改")
+		}
+		if err := appendIncidentEvent(tx, incident.ID, adminOpenID, model.ActorRoleAdmin, from, to, note); err != nil {
+			return response.ErrDatabase.WithOrigin(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := database.DB.First(incident, incident.ID).Error; err != nil {
+		return response.ErrDatabase.WithOrigin(err)
+	}
+	publishIncident(incident)
+	return nil
+}
+
+// appendIncidentEvent 在指定的数据库会话中追加一条紧急求助处理记录
+func appendIncidentEvent(tx *gorm.DB, incidentID uint, actorOpenID, actorRole, from, to, note string) error {
+	event := model.IncidentEvent{
+		IncidentID:  incidentID,
+		ActorOpenID: actorOpenID,
+		ActorRole:   actorRole,
+		FromStatus:  from,
+		ToStatus:    to,
+		Note:        note,
+	}
+	return tx.Create(&event).Error
+}
+
+// publishIncident 推送紧急求助的最新状态给管理员和发起人，推送失败只记录日志
+// 不推送给订单的另一方，避免司机看到乘客的求助内容和管理员的处理备注
+func publishIncident(incident *model.Incident) {
+	if err := realtime.PublishIncident(incident.OrderID, incident.ReporterOpenID, newIncidentAlert(incident, "")); err != nil {
+		log.Error("推送紧急求助失败", "error", err, "incident_id", incident.ID)
+	}
+}
+
+// newIncidentAlert 将紧急求助转换为告警事件内容，remark 为附加在消息末尾的说明
+func newIncidentAlert(incident *model.Incident, remark string) realtime.AlertData {
+	message := "乘客发起紧急求助"
+	if incident.ReporterRole == model.ActorRoleDriver {
+		message = "司机发起紧急求助"
+	}
+	if incident.Message != "" {
+		message += "：" + incident.Message
+	}
+	if remark != "" {
+		message += "（" + remark + "）"
+	}
+
+	data := realtime.AlertData{
+		IncidentID:   incident.ID,
+		Type:         "sos",
+		Priority:     incident.Priority,
+		Status:       incident.Status,
+		DriverOpenID: incident.DriverOpenID,
+		Message:      message,
+	}
+	if location := incident.Snapshot.DriverLocation; location != nil {
+		data.Latitude = location.Latitude
+		data.Longitude = location.Longitude
+	}
+	return data
+}
+
+// newIncidentResponse 将紧急求助转换为响应格式，events 为空时不返回处理记录
+func newIncidentResponse(incident *model.Incident, events []model.IncidentEvent) IncidentResponse {
+	resp := IncidentResponse{
+		ID:             incident.ID,
+		OrderID:        incident.OrderID,
+		ReporterOpenID: incident.ReporterOpenID,
+		ReporterRole:   incident.ReporterRole,
+		UserOpenID:     incident.UserOpenID,
+		DriverOpenID:   incident.DriverOpenID,
+		Priority:       incident.Priority,
+		Status:         incident.Status,
+		Message:        incident.Message,
+		Snapshot:       incident.Snapshot,
+		AcknowledgedBy: incident.AcknowledgedBy,
+		AcknowledgedAt: formatTime(incident.AcknowledgedAt),
+		ResolvedBy:     incident.ResolvedBy,
+		ResolvedAt:     formatTime(incident.ResolvedAt),
+		Resolution:     incident.Resolution,
+		CreateTime:     incident.CreatedAt.Format("2006/01/02 15:04:05"),
+	}
+	for _, event := range events {
+		resp.Events = append(resp.Events, IncidentEventResponse{
+			ID:          event.ID,
+			ActorOpenID: event.ActorOpenID,
+			ActorRole:   event.ActorRole,
+			FromStatus:  event.FromStatus,
+			ToStatus:    event.ToStatus,
+			Note:        event.Note,
+			CreateTime:  event.CreatedAt.Format("2006/01/02 15:04:05"),
+		})
+	}
+	return resp
+}
+
+// isSOSStatus 判断订单状态是否可以发起紧急求助
+func isSOSStatus(status string) bool {
+	for _, s := range sosStatuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,24 @@
+package safety
+
+import (
+	"cab-hive/internal/global/logger"
+	"log/slog"
+)
+
+var log *slog.Logger
+
+// ModuleSafety 行程安全模块结构体
+type ModuleSafety struct{}
+
+// GetName 获取模块名称
+func (m *ModuleSafety) GetName() string {
+	return "safety"
+}
+
+// Init 初始化行程安全模块
+func (m *ModuleSafety) Init() {
+	log = logger.New("safety")
+
+	// 重复推送未确认的紧急求助，直到管理员确认
+	go remindIncidents()
+}
@@ -0,0 +1,36 @@
+package safety
+
+import (
+	"cab-hive/internal/global/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InitRouter 初始化行程安全模块的路由
+func (m *ModuleSafety) InitRouter(r *gin.RouterGroup) {
+	// 定义行程安全模块的路由组，所有行程安全相关端点以 /safety 为前缀
+	safetyGroup := r.Group("/safety")
+
+	// 乘客或司机在进行中的订单上发起紧急求助 - 需要用户认证
+	safetyGroup.POST("/sos", middleware.Auth(1), TriggerSOS)
+
+	// 查询紧急求助详情和处理记录 - 需要用户认证，仅限订单双方和管理员
+	safetyGroup.GET("/incidents/:id", middleware.Auth(1), GetIncident)
+
+	// 管理员路由 - 需要管理员权限
+	safetyGroup.Use(middleware.Auth(3))
+	{
+		// 查询安全告警列表
+		safetyGroup.GET("/alerts", GetAlerts)
+		// 确认安全告警
+		safetyGroup.POST("/alerts/:id/acknowledge", AcknowledgeAlert)
+		// 处理完成安全告警
+		safetyGroup.POST("/alerts/:id/resolve", ResolveAlert)
+		// 查询紧急求助列表
+		safetyGroup.GET("/incidents", GetIncidents)
+		// 确认紧急求助
+		safetyGroup.POST("/incidents/:id/acknowledge", AcknowledgeIncident)
+		// 处理完成紧急求助
+		safetyGroup.POST("/incidents/:id/resolve", ResolveIncident)
+	}
+}
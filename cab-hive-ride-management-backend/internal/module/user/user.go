@@ -19,6 +19,15 @@ type UserResponse struct {
 	OpenID    string `json:"open_id"`
 }
 
+// AdminUserResponse 定义管理员查询用户列表时的响应结构体，包含乘客信誉
+type AdminUserResponse struct {
+	UserResponse
+	Reputation      float64 `json:"reputation"`       // 司机评价的平均评分
+	ReputationCount int     `json:"reputation_count"` // 司机评价次数
+	FlagCount       int     `json:"flag_count"`       // 被标记爽约或不文明的次数
+	ArrearsSince    *string `json:"arrears_since"`    // 欠费开始时间，未欠费时为空
+}
+
 // UpdateProfileRequest 定义更新用户信息请求的结构体
 type UpdateProfileRequest struct {
 	NickName  string `json:"nick_name"`
@@ -66,14 +75,25 @@ func GetAllUsers(c *gin.Context) {
 	}
 
 	// 转换为响应格式
-	userList := make([]UserResponse, len(users))
+	userList := make([]AdminUserResponse, len(users))
 	for i, u := range users {
-		userList[i] = UserResponse{
-			ID:        u.ID,
-			RoleID:    u.RoleID,
-			NickName:  u.NickName,
-			AvatarURL: u.AvatarURL,
-			OpenID:    u.OpenID,
+		var arrearsSince *string
+		if u.ArrearsSince != nil {
+			formatted := u.ArrearsSince.Format("2006/01/02 15:04:05")
+			arrearsSince = &formatted
+		}
+		userList[i] = AdminUserResponse{
+			UserResponse: UserResponse{
+				ID:        u.ID,
+				RoleID:    u.RoleID,
+				NickName:  u.NickName,
+				AvatarURL: u.AvatarURL,
+				OpenID:    u.OpenID,
+			},
+			Reputation:      u.Reputation,
+			ReputationCount: u.ReputationCount,
+			FlagCount:       u.FlagCount,
+			ArrearsSince:    arrearsSince,
 		}
 	}
 